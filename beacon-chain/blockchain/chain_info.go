@@ -530,3 +530,13 @@ func (s *Service) recoverStateSummary(ctx context.Context, blockRoot [32]byte) (
 func (s *Service) BlockBeingSynced(root [32]byte) bool {
 	return s.blockBeingSynced.isSyncing(root)
 }
+
+// InFlightSyncingBlocks returns the number of blocks that are currently being synced
+func (s *Service) InFlightSyncingBlocks() int {
+	return s.blockBeingSynced.count()
+}
+
+// SyncingBlockRoots returns the roots of the blocks that are currently being synced
+func (s *Service) SyncingBlockRoots() [][32]byte {
+	return s.blockBeingSynced.list()
+}
@@ -1,16 +1,38 @@
 package blockchain
 
-import "sync"
+import (
+	"sync"
+	"time"
+
+	"github.com/prysmaticlabs/prysm/v4/config/params"
+)
 
 type currentlySyncingBlock struct {
 	sync.Mutex
-	roots map[[32]byte]struct{}
+	roots map[[32]byte]time.Time // the time at which each root started syncing
+	now   func() time.Time
+}
+
+func newCurrentlySyncingBlock() *currentlySyncingBlock {
+	return &currentlySyncingBlock{roots: make(map[[32]byte]time.Time), now: time.Now}
 }
 
 func (b *currentlySyncingBlock) set(root [32]byte) {
 	b.Lock()
 	defer b.Unlock()
-	b.roots[root] = struct{}{}
+	b.roots[root] = b.now()
+}
+
+// trySet marks the root as syncing and returns true, unless it is already
+// syncing, in which case it returns false.
+func (b *currentlySyncingBlock) trySet(root [32]byte) bool {
+	b.Lock()
+	defer b.Unlock()
+	if _, ok := b.roots[root]; ok {
+		return false
+	}
+	b.roots[root] = b.now()
+	return true
 }
 
 func (b *currentlySyncingBlock) unset(root [32]byte) {
@@ -25,3 +47,56 @@ func (b *currentlySyncingBlock) isSyncing(root [32]byte) bool {
 	_, ok := b.roots[root]
 	return ok
 }
+
+func (b *currentlySyncingBlock) count() int {
+	b.Lock()
+	defer b.Unlock()
+	return len(b.roots)
+}
+
+// list returns a copy of the roots that are currently syncing.
+func (b *currentlySyncingBlock) list() [][32]byte {
+	b.Lock()
+	defer b.Unlock()
+	roots := make([][32]byte, 0, len(b.roots))
+	for root := range b.roots {
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// sweepExpired removes the roots that have been syncing for longer than maxAge
+// and returns the number of removed roots.
+func (b *currentlySyncingBlock) sweepExpired(maxAge time.Duration) int {
+	b.Lock()
+	defer b.Unlock()
+	removed := 0
+	now := b.now()
+	for root, t := range b.roots {
+		if now.Sub(t) > maxAge {
+			delete(b.roots, root)
+			removed++
+		}
+	}
+	return removed
+}
+
+// runSyncingBlockSweeper periodically removes the roots that have been syncing for more than
+// an epoch, so that a root left behind by a failed block processing can be processed again.
+func (s *Service) runSyncingBlockSweeper() {
+	slotDuration := time.Duration(params.BeaconConfig().SecondsPerSlot) * time.Second
+	maxAge := time.Duration(params.BeaconConfig().SlotsPerEpoch) * slotDuration
+	ticker := time.NewTicker(slotDuration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if removed := s.blockBeingSynced.sweepExpired(maxAge); removed > 0 {
+				log.WithField("count", removed).Warn("Removed stale syncing block roots")
+			}
+		case <-s.ctx.Done():
+			log.Debug("Context closed, exiting routine")
+			return
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package blockchain
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prysmaticlabs/prysm/v4/testing/require"
+)
+
+func TestService_InFlightSyncingBlocks(t *testing.T) {
+	s, _ := minimalTestService(t)
+	require.Equal(t, 0, s.InFlightSyncingBlocks())
+
+	s.blockBeingSynced.set([32]byte{'a'})
+	s.blockBeingSynced.set([32]byte{'b'})
+	require.Equal(t, 2, s.InFlightSyncingBlocks())
+
+	s.blockBeingSynced.set([32]byte{'a'})
+	require.Equal(t, 2, s.InFlightSyncingBlocks())
+
+	s.blockBeingSynced.unset([32]byte{'a'})
+	require.Equal(t, 1, s.InFlightSyncingBlocks())
+	s.blockBeingSynced.unset([32]byte{'b'})
+	require.Equal(t, 0, s.InFlightSyncingBlocks())
+}
+
+func TestCurrentlySyncingBlock_TrySet(t *testing.T) {
+	b := newCurrentlySyncingBlock()
+	root := [32]byte{'a'}
+
+	const numGoroutines = 50
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			if b.trySet(root) {
+				wins.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), wins.Load())
+	require.Equal(t, true, b.isSyncing(root))
+
+	b.unset(root)
+	require.Equal(t, true, b.trySet(root))
+}
+
+func TestCurrentlySyncingBlock_SweepExpired(t *testing.T) {
+	b := newCurrentlySyncingBlock()
+	now := time.Unix(1000, 0)
+	b.now = func() time.Time { return now }
+
+	b.set([32]byte{'a'})
+	now = now.Add(30 * time.Second)
+	b.set([32]byte{'b'})
+	require.Equal(t, 0, b.sweepExpired(time.Minute))
+
+	now = now.Add(45 * time.Second)
+	require.Equal(t, 1, b.sweepExpired(time.Minute))
+	require.Equal(t, false, b.isSyncing([32]byte{'a'}))
+	require.Equal(t, true, b.isSyncing([32]byte{'b'}))
+
+	now = now.Add(time.Minute)
+	require.Equal(t, 1, b.sweepExpired(time.Minute))
+	require.Equal(t, 0, b.count())
+}
+
+func TestService_SyncingBlockRoots(t *testing.T) {
+	s, _ := minimalTestService(t)
+	require.Equal(t, 0, len(s.SyncingBlockRoots()))
+
+	s.blockBeingSynced.set([32]byte{'a'})
+	s.blockBeingSynced.set([32]byte{'b'})
+	roots := s.SyncingBlockRoots()
+	sort.Slice(roots, func(i, j int) bool {
+		return bytes.Compare(roots[i][:], roots[j][:]) < 0
+	})
+	require.DeepEqual(t, [][32]byte{{'a'}, {'b'}}, roots)
+
+	// The snapshot is not affected by later changes, and changing it does not affect the syncing roots.
+	s.blockBeingSynced.unset([32]byte{'a'})
+	require.Equal(t, 2, len(roots))
+	roots[1] = [32]byte{'c'}
+	require.DeepEqual(t, [][32]byte{{'b'}}, s.SyncingBlockRoots())
+}
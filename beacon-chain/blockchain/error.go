@@ -9,6 +9,16 @@ var (
 	ErrInvalidBlockHashPayloadStatus = invalidBlock{error: errors.New("received an INVALID_BLOCK_HASH payload from execution engine")}
 	// ErrUndefinedExecutionEngineError is returned when the execution engine returns an error that is not defined
 	ErrUndefinedExecutionEngineError = errors.New("received an undefined execution engine error")
+	// ErrBlobIndexOutOfRange is returned when a blob sidecar index is not below the maximum number of blobs per block.
+	ErrBlobIndexOutOfRange = errors.New("blob index out of range")
+	// ErrInvalidSyncAggregateSignature is returned when a sync aggregate signature is missing or malformed.
+	ErrInvalidSyncAggregateSignature = errors.New("invalid sync aggregate signature")
+	// ErrHeaderRootMismatch is returned when the latest block header of a state does not match the block of a light client update.
+	ErrHeaderRootMismatch = errors.New("light client header root does not match block root")
+	// ErrParentRootMismatch is returned when the attested header of a light client update is not the parent of the signature block.
+	ErrParentRootMismatch = errors.New("light client attested header root does not match block parent root")
+	// ErrInvalidSignatureSlot is returned when a light client update signature slot is not after its attested slot.
+	ErrInvalidSignatureSlot = errors.New("invalid light client update signature slot")
 	// errNilFinalizedInStore is returned when a nil finalized checkpt is returned from store.
 	errNilFinalizedInStore = errors.New("nil finalized checkpoint returned from store")
 	// errNilFinalizedCheckpoint is returned when a nil finalized checkpt is returned from a state.
@@ -19,15 +29,43 @@ var (
 	errBlockDoesNotExist = errors.New("could not find block in DB")
 	// errBlockNotFoundInCacheOrDB is returned when a block is not found in the cache or DB.
 	errBlockNotFoundInCacheOrDB = errors.New("block not found in cache or db")
+	// errBlockBeingSynced is returned when a block is received while it is already being synced.
+	errBlockBeingSynced = errors.New("block is already being synced")
+	// errInitSyncCacheCorrupted is returned when a block of the initial sync cache is not keyed by its root.
+	errInitSyncCacheCorrupted = errors.New("initial sync blocks cache is corrupted")
 	// errWSBlockNotFound is returned when a block is not found in the WS cache or DB.
 	errWSBlockNotFound = errors.New("weak subjectivity root not found in db")
 	// errWSBlockNotFoundInEpoch is returned when a block is not found in the WS cache or DB within epoch.
 	errWSBlockNotFoundInEpoch = errors.New("weak subjectivity root not found in db within epoch")
+	// errWSDBTimeout is returned when a database call of the weak subjectivity check does not complete in time.
+	errWSDBTimeout = errors.New("weak subjectivity db call timed out")
+	// errInvalidWSCheckpoint is returned when a weak subjectivity checkpoint string is not in the 0xroot:epoch form.
+	errInvalidWSCheckpoint = errors.New("invalid weak subjectivity checkpoint")
 	// ErrNotDescendantOfFinalized is returned when a block is not a descendant of the finalized checkpoint
 	ErrNotDescendantOfFinalized = invalidBlock{error: errors.New("not descendant of finalized checkpoint")}
 	// ErrNotCheckpoint is returned when a given checkpoint is not a
 	// checkpoint in any chain known to forkchoice
 	ErrNotCheckpoint = errors.New("not a checkpoint in forkchoice")
+	// errFinalizedRootNotCanonical is returned when a light client update is requested for a non-canonical finalized root.
+	errFinalizedRootNotCanonical = errors.New("finalized root is not canonical")
+	// errNoFinalityUpdateForRoot is returned when no canonical block finalizes the requested root.
+	errNoFinalityUpdateForRoot = errors.New("could not find a canonical block finalizing root")
+	// errSyncCommitteeMismatch is returned when a light client update does not continue the sync committee known to the store.
+	errSyncCommitteeMismatch = errors.New("light client update sync committee does not match store")
+	// errBlobRootMismatch is returned when a batch of blob sidecars belongs to more than one block.
+	errBlobRootMismatch = errors.New("blob sidecars do not share the same block root")
+	// errNoLightClientOptimisticUpdate is returned when no light client optimistic update has been cached yet.
+	errNoLightClientOptimisticUpdate = errors.New("no light client optimistic update available")
+	// errFinalizedRootMismatch is returned when a light client finality update does not finalize the pinned finalized root.
+	errFinalizedRootMismatch = errors.New("light client finalized root mismatch")
+	// errInvalidFinalityBranch is returned when a light client finality branch does not have the expected number or size of leaves.
+	errInvalidFinalityBranch = errors.New("invalid finality branch shape")
+	// errInvalidCurrentSyncCommitteeBranch is returned when a light client bootstrap sync committee is not proven by its branch.
+	errInvalidCurrentSyncCommitteeBranch = errors.New("invalid current sync committee branch")
+	// errInvalidExecutionBranch is returned when a light client execution payload header is not proven by its branch.
+	errInvalidExecutionBranch = errors.New("invalid execution branch")
+	// errNoLightClientBootstrapState is returned when the state needed to build a light client bootstrap is not available.
+	errNoLightClientBootstrapState = errors.New("light client bootstrap state not found")
 )
 
 // An invalid block is the block that fails state transition based on the core protocol rules.
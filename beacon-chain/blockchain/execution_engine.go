@@ -270,33 +270,90 @@ func (s *Service) pruneInvalidBlock(ctx context.Context, root, parentRoot, lvh [
 	}
 }
 
-// getPayloadAttributes returns the payload attributes for the given state and slot.
-// The attribute is required to initiate a payload build process in the context of an `engine_forkchoiceUpdated` call.
-func (s *Service) getPayloadAttribute(ctx context.Context, st state.BeaconState, slot primitives.Slot, headRoot []byte) (bool, payloadattribute.Attributer, primitives.ValidatorIndex) {
-	emptyAttri := payloadattribute.EmptyWithVersion(st.Version())
+// trackedProposer returns the proposer index tracked for the given slot and whether a
+// payload should be prepared for it. When all payloads are prepared, every slot is
+// considered tracked even if no proposer was registered for it.
+func (s *Service) trackedProposer(slot primitives.Slot) (primitives.ValidatorIndex, bool) {
 	// Root is `[32]byte{}` since we are retrieving proposer ID of a given slot. During insertion at assignment the root was not known.
 	proposerID, _, ok := s.cfg.ProposerSlotIndexCache.GetProposerPayloadIDs(slot, [32]byte{} /* root */)
-	if !ok && !features.Get().PrepareAllPayloads { // There's no need to build attribute if there is no proposer for slot.
-		return false, emptyAttri, 0
+	if !ok && features.Get().PrepareAllPayloads {
+		return 0, true
 	}
+	return proposerID, ok
+}
 
-	// Get previous randao.
-	st = st.Copy()
-	if slot > st.Slot() {
-		var err error
-		st, err = transition.ProcessSlotsUsingNextSlotCache(ctx, st, headRoot, slot)
+// trackedProposers returns the tracked proposers for all slots in the range [startSlot, endSlot]
+// that are active validators in the given state, reading the proposer cache once for the whole range.
+// Slots without a tracked proposer are not included in the result, unless all payloads are prepared.
+func (s *Service) trackedProposers(st state.ReadOnlyBeaconState, startSlot, endSlot primitives.Slot) (map[primitives.Slot]primitives.ValidatorIndex, error) {
+	if endSlot < startSlot {
+		return nil, fmt.Errorf("end slot %d is lower than start slot %d", endSlot, startSlot)
+	}
+	// Root is `[32]byte{}` since we are retrieving proposer IDs of given slots. During insertion at assignment the root was not known.
+	registered := s.cfg.ProposerSlotIndexCache.GetProposerIDsInRange(startSlot, endSlot, [32]byte{} /* root */)
+	prepareAll := features.Get().PrepareAllPayloads
+	proposers := make(map[primitives.Slot]primitives.ValidatorIndex)
+	for slot := startSlot; slot <= endSlot; slot++ {
+		id, ok := registered[slot]
+		if !ok {
+			if prepareAll {
+				proposers[slot] = 0
+			}
+			continue
+		}
+		v, err := st.ValidatorAtIndexReadOnly(id)
 		if err != nil {
-			log.WithError(err).Error("Could not process slots to get payload attribute")
-			return false, emptyAttri, 0
+			return nil, errors.Wrapf(err, "could not get tracked proposer %d at slot %d", id, slot)
+		}
+		if helpers.IsActiveValidatorUsingTrie(v, slots.ToEpoch(slot)) {
+			proposers[slot] = id
 		}
 	}
-	prevRando, err := helpers.RandaoMix(st, time.CurrentEpoch(st))
+	return proposers, nil
+}
+
+// TrackedProposersForEpoch returns the slots of the given epoch whose tracked proposer is
+// an active validator in the given state.
+func (s *Service) TrackedProposersForEpoch(st state.ReadOnlyBeaconState, epoch primitives.Epoch) ([]primitives.Slot, error) {
+	startSlot, err := slots.EpochStart(epoch)
 	if err != nil {
-		log.WithError(err).Error("Could not get randao mix to get payload attribute")
-		return false, emptyAttri, 0
+		return nil, err
 	}
+	endSlot, err := slots.EpochEnd(epoch)
+	if err != nil {
+		return nil, err
+	}
+	proposers, err := s.trackedProposers(st, startSlot, endSlot)
+	if err != nil {
+		return nil, err
+	}
+	trackedSlots := make([]primitives.Slot, 0, len(proposers))
+	for slot := startSlot; slot <= endSlot; slot++ {
+		if _, ok := proposers[slot]; ok {
+			trackedSlots = append(trackedSlots, slot)
+		}
+	}
+	return trackedSlots, nil
+}
 
-	// Get fee recipient.
+// trackedProposerFeeRecipient returns the tracked proposer of the given slot and its configured
+// fee recipient. It returns false if the slot has no tracked proposer.
+func (s *Service) trackedProposerFeeRecipient(ctx context.Context, slot primitives.Slot) (primitives.ValidatorIndex, common.Address, bool) {
+	proposerID, ok := s.trackedProposer(slot)
+	if !ok {
+		return 0, common.Address{}, false
+	}
+	feeRecipient, err := s.proposerFeeRecipient(ctx, proposerID)
+	if err != nil {
+		log.WithError(err).Error("Could not get fee recipient for tracked proposer")
+		return 0, common.Address{}, false
+	}
+	return proposerID, feeRecipient, true
+}
+
+// proposerFeeRecipient returns the fee recipient registered for the given proposer,
+// or the default fee recipient if the proposer did not register one.
+func (s *Service) proposerFeeRecipient(ctx context.Context, proposerID primitives.ValidatorIndex) (common.Address, error) {
 	feeRecipient := params.BeaconConfig().DefaultFeeRecipient
 	recipient, err := s.cfg.BeaconDB.FeeRecipientByValidatorID(ctx, proposerID)
 	switch {
@@ -310,11 +367,37 @@ func (s *Service) getPayloadAttribute(ctx context.Context, st state.BeaconState,
 				"Please set a different eth address as the fee recipient. " +
 				"Please refer to our documentation for instructions")
 		}
+		return feeRecipient, nil
 	case err != nil:
-		log.WithError(err).Error("Could not get fee recipient to get payload attribute")
-		return false, emptyAttri, 0
+		return common.Address{}, err
 	default:
-		feeRecipient = recipient
+		return recipient, nil
+	}
+}
+
+// getPayloadAttributes returns the payload attributes for the given state and slot.
+// The attribute is required to initiate a payload build process in the context of an `engine_forkchoiceUpdated` call.
+func (s *Service) getPayloadAttribute(ctx context.Context, st state.BeaconState, slot primitives.Slot, headRoot []byte) (bool, payloadattribute.Attributer, primitives.ValidatorIndex) {
+	emptyAttri := payloadattribute.EmptyWithVersion(st.Version())
+	proposerID, feeRecipient, ok := s.trackedProposerFeeRecipient(ctx, slot)
+	if !ok { // There's no need to build attribute if there is no proposer for slot.
+		return false, emptyAttri, 0
+	}
+
+	// Get previous randao.
+	st = st.Copy()
+	if slot > st.Slot() {
+		var err error
+		st, err = transition.ProcessSlotsUsingNextSlotCache(ctx, st, headRoot, slot)
+		if err != nil {
+			log.WithError(err).Error("Could not process slots to get payload attribute")
+			return false, emptyAttri, 0
+		}
+	}
+	prevRando, err := helpers.RandaoMix(st, time.CurrentEpoch(st))
+	if err != nil {
+		log.WithError(err).Error("Could not get randao mix to get payload attribute")
+		return false, emptyAttri, 0
 	}
 
 	// Get timestamp.
@@ -390,7 +473,7 @@ func (s *Service) removeInvalidBlockAndState(ctx context.Context, blkRoots [][32
 			return err
 		}
 		// No op if the sidecar does not exist.
-		if err := s.cfg.BeaconDB.DeleteBlobSidecars(ctx, root); err != nil {
+		if err := s.deleteBlobSidecars(ctx, root); err != nil {
 			return err
 		}
 	}
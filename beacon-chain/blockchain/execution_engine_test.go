@@ -806,6 +806,104 @@ func Test_GetPayloadAttribute(t *testing.T) {
 	require.Equal(t, suggestedAddr, common.BytesToAddress(attr.SuggestedFeeRecipient()))
 }
 
+func Test_TrackedProposers(t *testing.T) {
+	service, _ := minimalTestService(t, WithProposerIdsCache(cache.NewProposerPayloadIDsCache()))
+	st, _ := util.DeterministicGenesisState(t, 64)
+	v, err := st.ValidatorAtIndex(40)
+	require.NoError(t, err)
+	v.ActivationEpoch = params.BeaconConfig().FarFutureEpoch
+	require.NoError(t, st.UpdateValidatorAtIndex(40, v))
+	service.cfg.ProposerSlotIndexCache.SetProposerAndPayloadIDs(1, 10, [8]byte{}, [32]byte{})
+	service.cfg.ProposerSlotIndexCache.SetProposerAndPayloadIDs(3, 30, [8]byte{}, [32]byte{})
+	service.cfg.ProposerSlotIndexCache.SetProposerAndPayloadIDs(4, 40, [8]byte{}, [32]byte{})
+	service.cfg.ProposerSlotIndexCache.SetProposerAndPayloadIDs(6, 60, [8]byte{}, [32]byte{})
+
+	proposers, err := service.trackedProposers(st, 0, 5)
+	require.NoError(t, err)
+	// The proposer of slot 4 is not active.
+	require.DeepEqual(t, map[primitives.Slot]primitives.ValidatorIndex{1: 10, 3: 30}, proposers)
+	for _, slot := range []primitives.Slot{0, 1, 2, 3, 5} {
+		id, ok := service.trackedProposer(slot)
+		batchedId, batchedOk := proposers[slot]
+		require.Equal(t, ok, batchedOk)
+		require.Equal(t, id, batchedId)
+	}
+
+	_, err = service.trackedProposers(st, 5, 0)
+	require.ErrorContains(t, "end slot 0 is lower than start slot 5", err)
+}
+
+func Test_TrackedProposers_PrepareAllPayloads(t *testing.T) {
+	resetCfg := features.InitWithReset(&features.Flags{
+		PrepareAllPayloads: true,
+	})
+	defer resetCfg()
+
+	service, _ := minimalTestService(t, WithProposerIdsCache(cache.NewProposerPayloadIDsCache()))
+	service.cfg.ProposerSlotIndexCache.SetProposerAndPayloadIDs(2, 20, [8]byte{}, [32]byte{})
+
+	st, _ := util.DeterministicGenesisState(t, 64)
+	proposers, err := service.trackedProposers(st, 0, 3)
+	require.NoError(t, err)
+	require.DeepEqual(t, map[primitives.Slot]primitives.ValidatorIndex{0: 0, 1: 0, 2: 20, 3: 0}, proposers)
+}
+
+func TestService_TrackedProposersForEpoch(t *testing.T) {
+	service, _ := minimalTestService(t, WithProposerIdsCache(cache.NewProposerPayloadIDsCache()))
+	st, _ := util.DeterministicGenesisState(t, 64)
+	v, err := st.ValidatorAtIndex(3)
+	require.NoError(t, err)
+	v.ActivationEpoch = params.BeaconConfig().FarFutureEpoch
+	require.NoError(t, st.UpdateValidatorAtIndex(3, v))
+
+	start := params.BeaconConfig().SlotsPerEpoch
+	service.cfg.ProposerSlotIndexCache.SetProposerAndPayloadIDs(start-1, 1, [8]byte{}, [32]byte{})
+	service.cfg.ProposerSlotIndexCache.SetProposerAndPayloadIDs(start+1, 1, [8]byte{}, [32]byte{})
+	service.cfg.ProposerSlotIndexCache.SetProposerAndPayloadIDs(start+5, 2, [8]byte{}, [32]byte{})
+	service.cfg.ProposerSlotIndexCache.SetProposerAndPayloadIDs(start+9, 3, [8]byte{}, [32]byte{})
+	service.cfg.ProposerSlotIndexCache.SetProposerAndPayloadIDs(2*start, 4, [8]byte{}, [32]byte{})
+
+	trackedSlots, err := service.TrackedProposersForEpoch(st, 1)
+	require.NoError(t, err)
+	require.DeepEqual(t, []primitives.Slot{start + 1, start + 5}, trackedSlots)
+
+	service.cfg.ProposerSlotIndexCache.SetProposerAndPayloadIDs(start+10, 100, [8]byte{}, [32]byte{})
+	_, err = service.TrackedProposersForEpoch(st, 1)
+	require.ErrorContains(t, "could not get tracked proposer 100", err)
+}
+
+func Test_TrackedProposerFeeRecipient(t *testing.T) {
+	service, tr := minimalTestService(t, WithProposerIdsCache(cache.NewProposerPayloadIDsCache()))
+	ctx := tr.ctx
+
+	_, _, ok := service.trackedProposerFeeRecipient(ctx, 1)
+	require.Equal(t, false, ok)
+
+	service.cfg.ProposerSlotIndexCache.SetProposerAndPayloadIDs(1, 10, [8]byte{}, [32]byte{})
+	id, recipient, ok := service.trackedProposerFeeRecipient(ctx, 1)
+	require.Equal(t, true, ok)
+	require.Equal(t, primitives.ValidatorIndex(10), id)
+	require.Equal(t, params.BeaconConfig().DefaultFeeRecipient, recipient)
+
+	suggestedAddr := common.HexToAddress("123")
+	require.NoError(t, service.cfg.BeaconDB.SaveFeeRecipientsByValidatorIDs(ctx, []primitives.ValidatorIndex{10}, []common.Address{suggestedAddr}))
+	_, recipient, ok = service.trackedProposerFeeRecipient(ctx, 1)
+	require.Equal(t, true, ok)
+	require.Equal(t, suggestedAddr, recipient)
+}
+
+func Test_TrackedProposerFeeRecipient_PrepareAllPayloads(t *testing.T) {
+	resetCfg := features.InitWithReset(&features.Flags{
+		PrepareAllPayloads: true,
+	})
+	defer resetCfg()
+
+	service, tr := minimalTestService(t, WithProposerIdsCache(cache.NewProposerPayloadIDsCache()))
+	_, recipient, ok := service.trackedProposerFeeRecipient(tr.ctx, 1)
+	require.Equal(t, true, ok)
+	require.Equal(t, params.BeaconConfig().DefaultFeeRecipient, recipient)
+}
+
 func Test_GetPayloadAttribute_PrepareAllPayloads(t *testing.T) {
 	hook := logTest.NewGlobal()
 	resetCfg := features.InitWithReset(&features.Flags{
@@ -1077,7 +1175,7 @@ func TestService_getPayloadHash(t *testing.T) {
 	bb := util.NewBeaconBlockBellatrix()
 	h = [32]byte{'a'}
 	bb.Block.Body.ExecutionPayload.BlockHash = h[:]
-	r, err = b.Block.HashTreeRoot()
+	r, err = bb.Block.HashTreeRoot()
 	require.NoError(t, err)
 	wsb, err = consensusblocks.NewSignedBeaconBlock(bb)
 	require.NoError(t, err)
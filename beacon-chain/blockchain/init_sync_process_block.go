@@ -2,28 +2,87 @@ package blockchain
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/prysm/v4/beacon-chain/db/kv"
+	"github.com/prysmaticlabs/prysm/v4/config/features"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/blocks"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/interfaces"
+	"golang.org/x/sync/errgroup"
 )
 
 // This saves a beacon block to the initial sync blocks cache. It rate limits how many blocks
 // the cache keeps in memory (2 epochs worth of blocks) and saves them to DB when it hits this limit.
+// If the service only caches the blocks of tracked proposers, other blocks are saved to DB directly.
 func (s *Service) saveInitSyncBlock(ctx context.Context, r [32]byte, b interfaces.ReadOnlySignedBeaconBlock) error {
+	if s.cfg.InitSyncTrackedOnly && !s.isTrackedProposerBlock(ctx, b) {
+		return s.cfg.BeaconDB.SaveBlock(ctx, b)
+	}
 	s.initSyncBlocksLock.Lock()
+	if _, exists := s.initSyncBlocks[r]; exists {
+		s.initSyncBlocksLock.Unlock()
+		return nil
+	}
 	s.initSyncBlocks[r] = b
 	numBlocks := len(s.initSyncBlocks)
 	s.initSyncBlocksLock.Unlock()
+	initSyncBlockCacheSize.Set(float64(numBlocks))
 	if uint64(numBlocks) > initialSyncBlockCacheSize {
-		if err := s.cfg.BeaconDB.SaveBlocks(ctx, s.getInitSyncBlocks()); err != nil {
+		if err := s.saveInitSyncBlocksInBatches(ctx, s.getInitSyncBlocksSortedBySlot()); err != nil {
 			return err
 		}
 		s.clearInitSyncBlocks()
+		initSyncBlockCacheFlushCount.Inc()
 	}
 	return nil
 }
 
+// Returns true if the block was proposed by a tracked validator, that is a validator that
+// registered a fee recipient with this node. The proposer index of the block is used so that
+// blocks of any epoch are resolved, not only those with proposer assignments still cached.
+func (s *Service) isTrackedProposerBlock(ctx context.Context, b interfaces.ReadOnlySignedBeaconBlock) bool {
+	if features.Get().PrepareAllPayloads {
+		return true
+	}
+	_, err := s.cfg.BeaconDB.FeeRecipientByValidatorID(ctx, b.Block().ProposerIndex())
+	switch {
+	case errors.Is(err, kv.ErrNotFoundFeeRecipient):
+		return false
+	case err != nil:
+		log.WithError(err).Error("Could not get fee recipient of block proposer")
+		return true
+	default:
+		return true
+	}
+}
+
+// This saves the given blocks to the DB. If the service is configured with more than one
+// batch, the blocks are split in contiguous batches that are saved concurrently. An error
+// is returned if any of the batches fail to be saved.
+func (s *Service) saveInitSyncBlocksInBatches(ctx context.Context, blks []interfaces.ReadOnlySignedBeaconBlock) error {
+	numBatches := s.cfg.InitSyncSaveBatches
+	if numBatches <= 1 || len(blks) <= 1 {
+		return s.cfg.BeaconDB.SaveBlocks(ctx, blks)
+	}
+	batchSize := (len(blks) + numBatches - 1) / numBatches
+	eg, ctx := errgroup.WithContext(ctx)
+	for i := 0; i < len(blks); i += batchSize {
+		end := i + batchSize
+		if end > len(blks) {
+			end = len(blks)
+		}
+		batch := blks[i:end]
+		eg.Go(func() error {
+			return s.cfg.BeaconDB.SaveBlocks(ctx, batch)
+		})
+	}
+	return eg.Wait()
+}
+
 // This checks if a beacon block exists in the initial sync blocks cache using the root
 // of the block.
 func (s *Service) hasInitSyncBlock(r [32]byte) bool {
@@ -41,6 +100,9 @@ func (s *Service) hasBlockInInitSyncOrDB(ctx context.Context, r [32]byte) bool {
 	return s.cfg.BeaconDB.HasBlock(ctx, r)
 }
 
+// blockFetchDeadline bounds the DB read shared by concurrent getBlock calls.
+const blockFetchDeadline = 10 * time.Second
+
 // Returns block for a given root `r` from either the initial sync blocks cache or the DB.
 // Error is returned if the block is not found in either cache or DB.
 func (s *Service) getBlock(ctx context.Context, r [32]byte) (interfaces.ReadOnlySignedBeaconBlock, error) {
@@ -49,11 +111,22 @@ func (s *Service) getBlock(ctx context.Context, r [32]byte) (interfaces.ReadOnly
 	// Check cache first because it's faster.
 	b, ok := s.initSyncBlocks[r]
 	s.initSyncBlocksLock.RUnlock()
-	var err error
 	if !ok {
-		b, err = s.cfg.BeaconDB.Block(ctx, r)
-		if err != nil {
-			return nil, errors.Wrap(err, "could not retrieve block from db")
+		// Concurrent lookups for the same root share a single DB read. The read is not tied to the
+		// context of the caller that started it, so that canceling it does not fail the others.
+		res := s.blockFetchGroup.DoChan(string(r[:]), func() (interface{}, error) {
+			fetchCtx, cancel := context.WithTimeout(context.Background(), blockFetchDeadline)
+			defer cancel()
+			return s.cfg.BeaconDB.Block(fetchCtx, r)
+		})
+		select {
+		case v := <-res:
+			if v.Err != nil {
+				return nil, errors.Wrap(v.Err, "could not retrieve block from db")
+			}
+			b, _ = v.Val.(interfaces.ReadOnlySignedBeaconBlock)
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), "context done waiting for block from db")
 		}
 	}
 	if err := blocks.BeaconBlockIsNil(b); err != nil {
@@ -75,9 +148,49 @@ func (s *Service) getInitSyncBlocks() []interfaces.ReadOnlySignedBeaconBlock {
 	return blks
 }
 
+// This retrieves all the beacon blocks from the initial sync blocks cache, the returned
+// blocks are sorted in ascending order by slot.
+func (s *Service) getInitSyncBlocksSortedBySlot() []interfaces.ReadOnlySignedBeaconBlock {
+	blks := s.getInitSyncBlocks()
+	sort.Slice(blks, func(i, j int) bool {
+		return blks[i].Block().Slot() < blks[j].Block().Slot()
+	})
+	return blks
+}
+
+// This verifies that every block of the initial sync blocks cache is keyed by its own root, so that
+// no two cached entries claim the same block root with differing contents. All the mismatching
+// cache keys are reported in the returned error. It hashes every cached block and is meant for
+// debugging.
+func (s *Service) verifyInitSyncCache() error {
+	s.initSyncBlocksLock.RLock()
+	defer s.initSyncBlocksLock.RUnlock()
+
+	mismatches := make([]string, 0)
+	for r, b := range s.initSyncBlocks {
+		if err := blocks.BeaconBlockIsNil(b); err != nil {
+			mismatches = append(mismatches, fmt.Sprintf("%#x: nil block", r))
+			continue
+		}
+		root, err := b.Block().HashTreeRoot()
+		if err != nil {
+			return errors.Wrapf(err, "could not hash cached block %#x", r)
+		}
+		if root != r {
+			mismatches = append(mismatches, fmt.Sprintf("%#x: block root %#x", r, root))
+		}
+	}
+	if len(mismatches) == 0 {
+		return nil
+	}
+	sort.Strings(mismatches)
+	return errors.Wrapf(errInitSyncCacheCorrupted, "%d of %d entries mismatch: %s", len(mismatches), len(s.initSyncBlocks), strings.Join(mismatches, ", "))
+}
+
 // This clears out the initial sync blocks cache.
 func (s *Service) clearInitSyncBlocks() {
 	s.initSyncBlocksLock.Lock()
 	defer s.initSyncBlocksLock.Unlock()
 	s.initSyncBlocks = make(map[[32]byte]interfaces.ReadOnlySignedBeaconBlock)
+	initSyncBlockCacheSize.Set(0)
 }
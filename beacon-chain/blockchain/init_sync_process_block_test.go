@@ -2,10 +2,22 @@ package blockchain
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prysmaticlabs/prysm/v4/beacon-chain/db"
 	testDB "github.com/prysmaticlabs/prysm/v4/beacon-chain/db/testing"
+	"github.com/prysmaticlabs/prysm/v4/config/params"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/blocks"
+	"github.com/prysmaticlabs/prysm/v4/consensus-types/interfaces"
+	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
+	ethpb "github.com/prysmaticlabs/prysm/v4/proto/prysm/v1alpha1"
 	"github.com/prysmaticlabs/prysm/v4/testing/require"
 	"github.com/prysmaticlabs/prysm/v4/testing/util"
 )
@@ -41,6 +53,115 @@ func TestService_getBlock(t *testing.T) {
 	require.DeepEqual(t, b, got)
 }
 
+// blockingBlockDB counts the calls to Block and holds them until release is closed.
+type blockingBlockDB struct {
+	db.HeadAccessDatabase
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (d *blockingBlockDB) Block(ctx context.Context, r [32]byte) (interfaces.ReadOnlySignedBeaconBlock, error) {
+	d.calls.Add(1)
+	<-d.release
+	return d.HeadAccessDatabase.Block(ctx, r)
+}
+
+func TestService_getBlock_ConcurrentLookupsShareDBRead(t *testing.T) {
+	ctx := context.Background()
+	beaconDB := testDB.SetupDB(t)
+	s := setupBeaconChain(t, beaconDB)
+	b := util.NewBeaconBlock()
+	b.Block.Slot = 100
+	r, err := b.Block.HashTreeRoot()
+	require.NoError(t, err)
+	wsb := util.SaveBlock(t, ctx, beaconDB, b)
+
+	bdb := &blockingBlockDB{HeadAccessDatabase: beaconDB, release: make(chan struct{})}
+	s.cfg.BeaconDB = bdb
+
+	const numLookups = 50
+	var started, done sync.WaitGroup
+	started.Add(numLookups)
+	done.Add(numLookups)
+	results := make([]interfaces.ReadOnlySignedBeaconBlock, numLookups)
+	errs := make([]error, numLookups)
+	for i := 0; i < numLookups; i++ {
+		go func(i int) {
+			defer done.Done()
+			started.Done()
+			results[i], errs[i] = s.getBlock(ctx, r)
+		}(i)
+	}
+	started.Wait()
+	// Give all goroutines time to join the in flight lookup before releasing it.
+	time.Sleep(100 * time.Millisecond)
+	close(bdb.release)
+	done.Wait()
+
+	require.Equal(t, int32(1), bdb.calls.Load())
+	for i := 0; i < numLookups; i++ {
+		require.NoError(t, errs[i])
+		require.DeepEqual(t, wsb, results[i])
+	}
+}
+
+// ctxCheckingBlockDB holds the calls to Block until release is closed and records whether the
+// context of the read was done by then.
+type ctxCheckingBlockDB struct {
+	db.HeadAccessDatabase
+	started chan struct{}
+	release chan struct{}
+	ctxErr  error
+}
+
+func (d *ctxCheckingBlockDB) Block(ctx context.Context, r [32]byte) (interfaces.ReadOnlySignedBeaconBlock, error) {
+	close(d.started)
+	<-d.release
+	d.ctxErr = ctx.Err()
+	return d.HeadAccessDatabase.Block(ctx, r)
+}
+
+func TestService_getBlock_CanceledCallerDoesNotFailSharedRead(t *testing.T) {
+	ctx := context.Background()
+	beaconDB := testDB.SetupDB(t)
+	s := setupBeaconChain(t, beaconDB)
+	b := util.NewBeaconBlock()
+	b.Block.Slot = 100
+	r, err := b.Block.HashTreeRoot()
+	require.NoError(t, err)
+	wsb := util.SaveBlock(t, ctx, beaconDB, b)
+
+	bdb := &ctxCheckingBlockDB{HeadAccessDatabase: beaconDB, started: make(chan struct{}), release: make(chan struct{})}
+	s.cfg.BeaconDB = bdb
+
+	// The first caller starts the shared read and is canceled while it is in flight.
+	firstCtx, cancel := context.WithCancel(ctx)
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := s.getBlock(firstCtx, r)
+		firstErr <- err
+	}()
+	<-bdb.started
+	type result struct {
+		b   interfaces.ReadOnlySignedBeaconBlock
+		err error
+	}
+	second := make(chan result, 1)
+	go func() {
+		got, err := s.getBlock(ctx, r)
+		second <- result{b: got, err: err}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-firstErr, context.Canceled)
+
+	close(bdb.release)
+	res := <-second
+	require.NoError(t, res.err)
+	require.DeepEqual(t, wsb, res.b)
+	require.NoError(t, bdb.ctxErr)
+}
+
 func TestService_hasBlockInInitSyncOrDB(t *testing.T) {
 	ctx := context.Background()
 	beaconDB := testDB.SetupDB(t)
@@ -66,3 +187,232 @@ func TestService_hasBlockInInitSyncOrDB(t *testing.T) {
 	util.SaveBlock(t, ctx, s.cfg.BeaconDB, b2)
 	require.Equal(t, true, s.hasBlockInInitSyncOrDB(ctx, r2))
 }
+
+func TestService_getInitSyncBlocksSortedBySlot(t *testing.T) {
+	ctx := context.Background()
+	beaconDB := testDB.SetupDB(t)
+	s := setupBeaconChain(t, beaconDB)
+
+	for _, slot := range []primitives.Slot{5, 1, 4, 2, 3} {
+		b := util.NewBeaconBlock()
+		b.Block.Slot = slot
+		r, err := b.Block.HashTreeRoot()
+		require.NoError(t, err)
+		wsb, err := blocks.NewSignedBeaconBlock(b)
+		require.NoError(t, err)
+		require.NoError(t, s.saveInitSyncBlock(ctx, r, wsb))
+	}
+
+	blks := s.getInitSyncBlocksSortedBySlot()
+	require.Equal(t, 5, len(blks))
+	for i, b := range blks {
+		require.Equal(t, primitives.Slot(i+1), b.Block().Slot())
+	}
+}
+
+func TestService_saveInitSyncBlock_Metrics(t *testing.T) {
+	ctx := context.Background()
+	beaconDB := testDB.SetupDB(t)
+	s := setupBeaconChain(t, beaconDB)
+	flushes := testutil.ToFloat64(initSyncBlockCacheFlushCount)
+
+	for i := uint64(1); i <= initialSyncBlockCacheSize; i++ {
+		b := util.NewBeaconBlock()
+		b.Block.Slot = primitives.Slot(i)
+		r, err := b.Block.HashTreeRoot()
+		require.NoError(t, err)
+		wsb, err := blocks.NewSignedBeaconBlock(b)
+		require.NoError(t, err)
+		require.NoError(t, s.saveInitSyncBlock(ctx, r, wsb))
+	}
+	require.Equal(t, float64(initialSyncBlockCacheSize), testutil.ToFloat64(initSyncBlockCacheSize))
+	require.Equal(t, flushes, testutil.ToFloat64(initSyncBlockCacheFlushCount))
+
+	// One more block goes over the limit and flushes the cache to the DB.
+	b := util.NewBeaconBlock()
+	b.Block.Slot = primitives.Slot(initialSyncBlockCacheSize + 1)
+	r, err := b.Block.HashTreeRoot()
+	require.NoError(t, err)
+	wsb, err := blocks.NewSignedBeaconBlock(b)
+	require.NoError(t, err)
+	require.NoError(t, s.saveInitSyncBlock(ctx, r, wsb))
+	require.Equal(t, float64(0), testutil.ToFloat64(initSyncBlockCacheSize))
+	require.Equal(t, flushes+1, testutil.ToFloat64(initSyncBlockCacheFlushCount))
+	require.Equal(t, true, beaconDB.HasBlock(ctx, r))
+
+	require.NoError(t, s.saveInitSyncBlock(ctx, r, wsb))
+	require.Equal(t, float64(1), testutil.ToFloat64(initSyncBlockCacheSize))
+	s.clearInitSyncBlocks()
+	require.Equal(t, float64(0), testutil.ToFloat64(initSyncBlockCacheSize))
+}
+
+func TestService_saveInitSyncBlock_Duplicate(t *testing.T) {
+	ctx := context.Background()
+	beaconDB := testDB.SetupDB(t)
+	s := setupBeaconChain(t, beaconDB)
+	flushes := testutil.ToFloat64(initSyncBlockCacheFlushCount)
+
+	roots := fillInitSyncCache(t, s, initialSyncBlockCacheSize-1)
+	b := util.NewBeaconBlock()
+	b.Block.Slot = primitives.Slot(initialSyncBlockCacheSize)
+	r, err := b.Block.HashTreeRoot()
+	require.NoError(t, err)
+	wsb, err := blocks.NewSignedBeaconBlock(b)
+	require.NoError(t, err)
+	require.NoError(t, s.saveInitSyncBlock(ctx, r, wsb))
+	require.Equal(t, int(initialSyncBlockCacheSize), len(s.getInitSyncBlocks()))
+
+	// Saving cached roots again neither grows the cache nor triggers a flush.
+	require.NoError(t, s.saveInitSyncBlock(ctx, r, wsb))
+	cached, err := s.getBlock(ctx, roots[0])
+	require.NoError(t, err)
+	require.NoError(t, s.saveInitSyncBlock(ctx, roots[0], cached))
+	require.Equal(t, int(initialSyncBlockCacheSize), len(s.getInitSyncBlocks()))
+	require.Equal(t, flushes, testutil.ToFloat64(initSyncBlockCacheFlushCount))
+	require.Equal(t, false, beaconDB.HasBlock(ctx, r))
+}
+
+func TestService_verifyInitSyncCache(t *testing.T) {
+	beaconDB := testDB.SetupDB(t)
+	s := setupBeaconChain(t, beaconDB)
+	roots := fillInitSyncCache(t, s, 3)
+	require.NoError(t, s.verifyInitSyncCache())
+
+	// Store the block of slot 3 under the root of slot 1, as if its content was corrupted.
+	corrupted, err := s.getBlock(context.Background(), roots[2])
+	require.NoError(t, err)
+	s.initSyncBlocksLock.Lock()
+	s.initSyncBlocks[roots[0]] = corrupted
+	s.initSyncBlocksLock.Unlock()
+	err = s.verifyInitSyncCache()
+	require.ErrorIs(t, err, errInitSyncCacheCorrupted)
+	require.ErrorContains(t, fmt.Sprintf("1 of 3 entries mismatch: %#x: block root %#x", roots[0], roots[2]), err)
+
+	s.initSyncBlocksLock.Lock()
+	s.initSyncBlocks[roots[1]] = nil
+	s.initSyncBlocksLock.Unlock()
+	require.ErrorContains(t, "2 of 3 entries mismatch", s.verifyInitSyncCache())
+}
+
+// batchSaveDB records the batches passed to SaveBlocks and fails any batch containing failSlot.
+type batchSaveDB struct {
+	db.HeadAccessDatabase
+	sync.Mutex
+	batches  int
+	failSlot primitives.Slot
+}
+
+var errBatchSave = errors.New("could not save batch")
+
+func (d *batchSaveDB) SaveBlocks(ctx context.Context, blks []interfaces.ReadOnlySignedBeaconBlock) error {
+	d.Lock()
+	d.batches++
+	d.Unlock()
+	for _, b := range blks {
+		if d.failSlot != 0 && b.Block().Slot() == d.failSlot {
+			return errBatchSave
+		}
+	}
+	return d.HeadAccessDatabase.SaveBlocks(ctx, blks)
+}
+
+func fillInitSyncCache(t *testing.T, s *Service, numBlocks uint64) [][32]byte {
+	roots := make([][32]byte, 0, numBlocks)
+	for i := uint64(1); i <= numBlocks; i++ {
+		b := util.NewBeaconBlock()
+		b.Block.Slot = primitives.Slot(i)
+		r, err := b.Block.HashTreeRoot()
+		require.NoError(t, err)
+		wsb, err := blocks.NewSignedBeaconBlock(b)
+		require.NoError(t, err)
+		s.initSyncBlocksLock.Lock()
+		s.initSyncBlocks[r] = wsb
+		s.initSyncBlocksLock.Unlock()
+		roots = append(roots, r)
+	}
+	return roots
+}
+
+func TestService_saveInitSyncBlock_Batches(t *testing.T) {
+	ctx := context.Background()
+	beaconDB := testDB.SetupDB(t)
+	s := setupBeaconChain(t, beaconDB)
+	bdb := &batchSaveDB{HeadAccessDatabase: beaconDB}
+	s.cfg.BeaconDB = bdb
+	s.cfg.InitSyncSaveBatches = 4
+
+	roots := fillInitSyncCache(t, s, initialSyncBlockCacheSize)
+	b := util.NewBeaconBlock()
+	b.Block.Slot = primitives.Slot(initialSyncBlockCacheSize + 1)
+	r, err := b.Block.HashTreeRoot()
+	require.NoError(t, err)
+	wsb, err := blocks.NewSignedBeaconBlock(b)
+	require.NoError(t, err)
+	require.NoError(t, s.saveInitSyncBlock(ctx, r, wsb))
+
+	require.Equal(t, 4, bdb.batches)
+	require.Equal(t, 0, len(s.getInitSyncBlocks()))
+	for _, root := range append(roots, r) {
+		require.Equal(t, true, beaconDB.HasBlock(ctx, root))
+	}
+}
+
+func TestService_saveInitSyncBlock_BatchFailureKeepsCache(t *testing.T) {
+	ctx := context.Background()
+	beaconDB := testDB.SetupDB(t)
+	s := setupBeaconChain(t, beaconDB)
+	bdb := &batchSaveDB{HeadAccessDatabase: beaconDB, failSlot: 3}
+	s.cfg.BeaconDB = bdb
+	s.cfg.InitSyncSaveBatches = 4
+
+	fillInitSyncCache(t, s, initialSyncBlockCacheSize)
+	b := util.NewBeaconBlock()
+	b.Block.Slot = primitives.Slot(initialSyncBlockCacheSize + 1)
+	r, err := b.Block.HashTreeRoot()
+	require.NoError(t, err)
+	wsb, err := blocks.NewSignedBeaconBlock(b)
+	require.NoError(t, err)
+	require.ErrorIs(t, s.saveInitSyncBlock(ctx, r, wsb), errBatchSave)
+
+	require.Equal(t, int(initialSyncBlockCacheSize+1), len(s.getInitSyncBlocks()))
+	require.Equal(t, true, s.hasInitSyncBlock(r))
+}
+
+func TestService_saveInitSyncBlock_TrackedProposersOnly(t *testing.T) {
+	ctx := context.Background()
+	// Both blocks are older than the current epoch, so their proposers are no longer in the proposer cache.
+	tracked := util.NewBeaconBlock()
+	tracked.Block.Slot = 1
+	tracked.Block.ProposerIndex = 7
+	untracked := util.NewBeaconBlock()
+	untracked.Block.Slot = 2
+	untracked.Block.ProposerIndex = 8
+
+	for _, trackedOnly := range []bool{false, true} {
+		t.Run(fmt.Sprintf("tracked only %v", trackedOnly), func(t *testing.T) {
+			beaconDB := testDB.SetupDB(t)
+			s := setupBeaconChain(t, beaconDB)
+			s.genesisTime = time.Now().Add(-time.Duration(10*uint64(params.BeaconConfig().SlotsPerEpoch)*params.BeaconConfig().SecondsPerSlot) * time.Second)
+			s.cfg.InitSyncTrackedOnly = trackedOnly
+			require.NoError(t, beaconDB.SaveFeeRecipientsByValidatorIDs(ctx, []primitives.ValidatorIndex{7}, []common.Address{{'a'}}))
+
+			for _, b := range []*ethpb.SignedBeaconBlock{tracked, untracked} {
+				r, err := b.Block.HashTreeRoot()
+				require.NoError(t, err)
+				wsb, err := blocks.NewSignedBeaconBlock(b)
+				require.NoError(t, err)
+				require.NoError(t, s.saveInitSyncBlock(ctx, r, wsb))
+			}
+
+			trackedRoot, err := tracked.Block.HashTreeRoot()
+			require.NoError(t, err)
+			untrackedRoot, err := untracked.Block.HashTreeRoot()
+			require.NoError(t, err)
+			require.Equal(t, true, s.hasInitSyncBlock(trackedRoot))
+			require.Equal(t, false, beaconDB.HasBlock(ctx, trackedRoot))
+			require.Equal(t, !trackedOnly, s.hasInitSyncBlock(untrackedRoot))
+			require.Equal(t, trackedOnly, beaconDB.HasBlock(ctx, untrackedRoot))
+			require.Equal(t, true, s.hasBlockInInitSyncOrDB(ctx, untrackedRoot))
+		})
+	}
+}
@@ -4,19 +4,43 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"runtime"
 
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/prysm/v4/beacon-chain/core/feed"
+	statefeed "github.com/prysmaticlabs/prysm/v4/beacon-chain/core/feed/state"
 	"github.com/prysmaticlabs/prysm/v4/beacon-chain/state"
+	statenative "github.com/prysmaticlabs/prysm/v4/beacon-chain/state/state-native"
+	fieldparams "github.com/prysmaticlabs/prysm/v4/config/fieldparams"
 	"github.com/prysmaticlabs/prysm/v4/config/params"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/interfaces"
+	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
+	"github.com/prysmaticlabs/prysm/v4/container/trie"
+	"github.com/prysmaticlabs/prysm/v4/crypto/hash"
 	"github.com/prysmaticlabs/prysm/v4/encoding/bytesutil"
+	"github.com/prysmaticlabs/prysm/v4/encoding/ssz"
 	ethpbv1 "github.com/prysmaticlabs/prysm/v4/proto/eth/v1"
 	ethpbv2 "github.com/prysmaticlabs/prysm/v4/proto/eth/v2"
 	"github.com/prysmaticlabs/prysm/v4/proto/migration"
+	ethpb "github.com/prysmaticlabs/prysm/v4/proto/prysm/v1alpha1"
+	"github.com/prysmaticlabs/prysm/v4/runtime/version"
 	"github.com/prysmaticlabs/prysm/v4/time/slots"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/protobuf/proto"
 )
 
 const (
-	finalityBranchNumOfLeaves = 6
+	finalityBranchNumOfLeaves  = 6
+	executionBranchNumOfLeaves = 4
+	// currentSyncCommitteeGeneralizedIndex is CURRENT_SYNC_COMMITTEE_GINDEX, the generalized index of the
+	// current sync committee in the beacon state.
+	currentSyncCommitteeGeneralizedIndex = 54
+	// nextSyncCommitteeGeneralizedIndex is NEXT_SYNC_COMMITTEE_GINDEX, the generalized index of the
+	// next sync committee in the beacon state.
+	nextSyncCommitteeGeneralizedIndex = 55
+	// executionPayloadGeneralizedIndex is EXECUTION_PAYLOAD_GINDEX, the generalized index of the
+	// execution payload in the beacon block body.
+	executionPayloadGeneralizedIndex = 25
 )
 
 // CreateLightClientFinalityUpdate - implements https://github.com/ethereum/consensus-specs/blob/3d235740e5f1e641d3b160c8688f26e7dc5a1894/specs/altair/light-client/full-node.md#create_light_client_finality_update
@@ -55,6 +79,235 @@ func CreateLightClientOptimisticUpdate(update *ethpbv2.LightClientUpdate) *ethpb
 	}
 }
 
+// VerifyExecutionBranch checks that the execution payload header of a Capella or later light client
+// header is included in the body of its beacon block header, as in the spec is_valid_light_client_header.
+func VerifyExecutionBranch(header *ethpbv1.BeaconBlockHeader, execution interfaces.ExecutionData, executionBranch [][]byte) error {
+	if header == nil {
+		return errors.New("nil beacon block header")
+	}
+	if execution == nil || execution.IsNil() {
+		return errors.New("nil execution payload header")
+	}
+	if len(executionBranch) != executionBranchNumOfLeaves {
+		return errors.Wrapf(errInvalidExecutionBranch, "got %d leaves, want %d", len(executionBranch), executionBranchNumOfLeaves)
+	}
+	for i, leaf := range executionBranch {
+		if len(leaf) != fieldparams.RootLength {
+			return errors.Wrapf(errInvalidExecutionBranch, "leaf %d has %d bytes, want %d", i, len(leaf), fieldparams.RootLength)
+		}
+	}
+	// return is_valid_merkle_branch(
+	//     leaf=get_lc_execution_root(header),
+	//     branch=header.execution_branch,
+	//     depth=floorlog2(EXECUTION_PAYLOAD_GINDEX),
+	//     index=get_subtree_index(EXECUTION_PAYLOAD_GINDEX),
+	//     root=header.beacon.body_root,
+	// )
+	executionRoot, err := execution.HashTreeRoot()
+	if err != nil {
+		return errors.Wrap(err, "could not get execution payload header root")
+	}
+	if !trie.VerifyMerkleProof(header.BodyRoot, executionRoot[:], executionPayloadGeneralizedIndex, executionBranch) {
+		return errors.Wrap(errInvalidExecutionBranch, "execution payload header is not included in the block body")
+	}
+	return nil
+}
+
+// lightClientHeaderRoot returns the hash tree root of the light client header container of the given fork.
+// Before Capella the container only holds the beacon block header, so its root is the beacon block header root.
+// From Capella on it also holds the execution payload header and its branch in the beacon block body.
+func lightClientHeaderRoot(header *ethpb.BeaconBlockHeader, execution interfaces.ExecutionData, executionBranch [][]byte, fork int) ([32]byte, error) {
+	beaconRoot, err := header.HashTreeRoot()
+	if err != nil {
+		return [32]byte{}, errors.Wrap(err, "could not get beacon block header root")
+	}
+	if fork < version.Capella {
+		return beaconRoot, nil
+	}
+	if execution == nil || execution.IsNil() {
+		return [32]byte{}, errors.New("nil execution payload header")
+	}
+	if len(executionBranch) != executionBranchNumOfLeaves {
+		return [32]byte{}, errors.Wrapf(errInvalidExecutionBranch, "got %d leaves, want %d", len(executionBranch), executionBranchNumOfLeaves)
+	}
+	executionRoot, err := execution.HashTreeRoot()
+	if err != nil {
+		return [32]byte{}, errors.Wrap(err, "could not get execution payload header root")
+	}
+	branch := make([][32]byte, len(executionBranch))
+	for i, b := range executionBranch {
+		branch[i] = bytesutil.ToBytes32(b)
+	}
+	branchRoot := ssz.MerkleizeVector(branch, uint64(len(branch)))
+	return ssz.MerkleizeVector([][32]byte{beaconRoot, executionRoot, branchRoot}, 3), nil
+}
+
+// executionBranchFromBody returns the branch of the execution payload in a Capella or later beacon
+// block body, which is the execution_branch of the light client header of that block.
+func executionBranchFromBody(body interfaces.ReadOnlyBeaconBlockBody, fork int) ([][]byte, error) {
+	layer, err := blockBodyFieldRoots(body, fork)
+	if err != nil {
+		return nil, err
+	}
+	index := executionPayloadGeneralizedIndex - len(layer)
+	branch := make([][]byte, 0, executionBranchNumOfLeaves)
+	for len(layer) > 1 {
+		sibling := layer[index^1]
+		branch = append(branch, sibling[:])
+		parents := make([][32]byte, len(layer)/2)
+		for i := range parents {
+			parents[i] = hash.Hash(append(layer[2*i][:], layer[2*i+1][:]...))
+		}
+		layer = parents
+		index /= 2
+	}
+	// The field roots are computed here rather than by the generated code, so check them against it.
+	bodyRoot, err := body.HashTreeRoot()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get block body root")
+	}
+	if layer[0] != bodyRoot {
+		return nil, fmt.Errorf("block body field roots give root %#x, want %#x", layer[0], bodyRoot)
+	}
+	return branch, nil
+}
+
+// blockBodyFieldRoots returns the hash tree roots of the fields of a Capella or Deneb beacon block body,
+// padded with zero roots to the 1<<executionBranchNumOfLeaves leaves of the body tree.
+func blockBodyFieldRoots(body interfaces.ReadOnlyBeaconBlockBody, fork int) ([][32]byte, error) {
+	if fork < version.Capella || fork > version.Deneb {
+		return nil, fmt.Errorf("no execution branch for block body of version %s", version.String(fork))
+	}
+	cfg := params.BeaconConfig()
+	roots := make([][32]byte, 1<<executionBranchNumOfLeaves)
+	randao := body.RandaoReveal()
+	randaoChunks, err := ssz.PackByChunk([][]byte{randao[:]})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not pack randao reveal")
+	}
+	roots[0] = ssz.MerkleizeVector(randaoChunks, uint64(len(randaoChunks)))
+	if roots[1], err = body.Eth1Data().HashTreeRoot(); err != nil {
+		return nil, errors.Wrap(err, "could not get eth1 data root")
+	}
+	roots[2] = body.Graffiti()
+	if roots[3], err = hashTreeRootList(body.ProposerSlashings(), cfg.MaxProposerSlashings); err != nil {
+		return nil, errors.Wrap(err, "could not get proposer slashings root")
+	}
+	if roots[4], err = hashTreeRootList(body.AttesterSlashings(), cfg.MaxAttesterSlashings); err != nil {
+		return nil, errors.Wrap(err, "could not get attester slashings root")
+	}
+	if roots[5], err = hashTreeRootList(body.Attestations(), cfg.MaxAttestations); err != nil {
+		return nil, errors.Wrap(err, "could not get attestations root")
+	}
+	if roots[6], err = hashTreeRootList(body.Deposits(), cfg.MaxDeposits); err != nil {
+		return nil, errors.Wrap(err, "could not get deposits root")
+	}
+	if roots[7], err = hashTreeRootList(body.VoluntaryExits(), cfg.MaxVoluntaryExits); err != nil {
+		return nil, errors.Wrap(err, "could not get voluntary exits root")
+	}
+	syncAggregate, err := body.SyncAggregate()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get sync aggregate")
+	}
+	if roots[8], err = syncAggregate.HashTreeRoot(); err != nil {
+		return nil, errors.Wrap(err, "could not get sync aggregate root")
+	}
+	execution, err := body.Execution()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get execution payload")
+	}
+	if roots[9], err = execution.HashTreeRoot(); err != nil {
+		return nil, errors.Wrap(err, "could not get execution payload root")
+	}
+	changes, err := body.BLSToExecutionChanges()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get bls to execution changes")
+	}
+	if roots[10], err = hashTreeRootList(changes, cfg.MaxBlsToExecutionChanges); err != nil {
+		return nil, errors.Wrap(err, "could not get bls to execution changes root")
+	}
+	if fork < version.Deneb {
+		return roots, nil
+	}
+	commitments, err := body.BlobKzgCommitments()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get blob kzg commitments")
+	}
+	commitmentRoots := make([][]byte, len(commitments))
+	for i, c := range commitments {
+		chunks, err := ssz.PackByChunk([][]byte{c})
+		if err != nil {
+			return nil, errors.Wrap(err, "could not pack blob kzg commitment")
+		}
+		root := ssz.MerkleizeVector(chunks, uint64(len(chunks)))
+		commitmentRoots[i] = root[:]
+	}
+	if roots[11], err = ssz.ByteArrayRootWithLimit(commitmentRoots, fieldparams.MaxBlobCommitmentsPerBlock); err != nil {
+		return nil, errors.Wrap(err, "could not get blob kzg commitments root")
+	}
+	return roots, nil
+}
+
+// hashTreeRootList returns the hash tree root of an SSZ list of containers with the given limit.
+func hashTreeRootList[T interface{ HashTreeRoot() ([32]byte, error) }](elems []T, limit uint64) ([32]byte, error) {
+	roots := make([][]byte, len(elems))
+	for i, elem := range elems {
+		root, err := elem.HashTreeRoot()
+		if err != nil {
+			return [32]byte{}, err
+		}
+		roots[i] = root[:]
+	}
+	return ssz.ByteArrayRootWithLimit(roots, limit)
+}
+
+// verifySignatureSlot checks that the signature slot of a light client update is strictly after the
+// attested header slot, as the sync aggregate signs over the attested header in a later slot.
+func verifySignatureSlot(signatureSlot, attestedSlot primitives.Slot) error {
+	if signatureSlot <= attestedSlot {
+		return errors.Wrapf(ErrInvalidSignatureSlot, "signature slot %d is not after attested slot %d", signatureSlot, attestedSlot)
+	}
+	return nil
+}
+
+// LightClientStore is the minimal light client view needed to follow sync committee rotations.
+type LightClientStore struct {
+	FinalizedHeader      *ethpbv1.BeaconBlockHeader
+	CurrentSyncCommittee *ethpbv2.SyncCommittee
+	NextSyncCommittee    *ethpbv2.SyncCommittee
+}
+
+// VerifyStoreCommitteeContinuity checks that the sync committees of an update continue the ones learned by the store.
+// `currentSyncCommittee` is the current sync committee of the update's attested state, which signed the update.
+// An update from the store period must agree with the next sync committee already known to the store, while an update from
+// the following period must be signed by that next sync committee, since it becomes the update's current one.
+func VerifyStoreCommitteeContinuity(store *LightClientStore, update *ethpbv2.LightClientUpdate, currentSyncCommittee *ethpbv2.SyncCommittee) error {
+	if store == nil || store.FinalizedHeader == nil {
+		return errors.New("nil light client store")
+	}
+	if update == nil || update.AttestedHeader == nil {
+		return errors.New("nil light client update")
+	}
+	storePeriod := slots.SyncCommitteePeriod(slots.ToEpoch(store.FinalizedHeader.Slot))
+	updatePeriod := slots.SyncCommitteePeriod(slots.ToEpoch(update.AttestedHeader.Slot))
+	switch updatePeriod {
+	case storePeriod:
+		if store.NextSyncCommittee != nil && update.NextSyncCommittee != nil && !proto.Equal(store.NextSyncCommittee, update.NextSyncCommittee) {
+			return errors.Wrapf(errSyncCommitteeMismatch, "next sync committee differs in period %d", updatePeriod)
+		}
+	case storePeriod + 1:
+		if store.NextSyncCommittee == nil {
+			return errors.Wrapf(errSyncCommitteeMismatch, "next sync committee of period %d is unknown", storePeriod)
+		}
+		if !proto.Equal(store.NextSyncCommittee, currentSyncCommittee) {
+			return errors.Wrapf(errSyncCommitteeMismatch, "current sync committee of period %d differs from the store next sync committee", updatePeriod)
+		}
+	default:
+		return errors.Wrapf(errSyncCommitteeMismatch, "update period %d does not follow store period %d", updatePeriod, storePeriod)
+	}
+	return nil
+}
+
 func NewLightClientOptimisticUpdateFromBeaconState(
 	ctx context.Context,
 	state state.BeaconState,
@@ -75,6 +328,9 @@ func NewLightClientOptimisticUpdateFromBeaconState(
 	if syncAggregate.SyncCommitteeBits.Count() < params.BeaconConfig().MinSyncCommitteeParticipants {
 		return nil, fmt.Errorf("invalid sync committee bits count %d", syncAggregate.SyncCommitteeBits.Count())
 	}
+	if err := verifySyncAggregateSignature(syncAggregate.SyncCommitteeSignature); err != nil {
+		return nil, err
+	}
 
 	// assert state.slot == state.latest_block_header.slot
 	if state.Slot() != state.LatestBlockHeader().Slot {
@@ -89,18 +345,38 @@ func NewLightClientOptimisticUpdateFromBeaconState(
 	}
 	header.StateRoot = stateRoot[:]
 
-	headerRoot, err := header.HashTreeRoot()
+	// From Capella on both sides are light client header containers, so the execution payload header
+	// of the state must also be the one of the block.
+	var stateExecution, blockExecution interfaces.ExecutionData
+	var executionBranch [][]byte
+	if block.Version() >= version.Capella {
+		if stateExecution, err = state.LatestExecutionPayloadHeader(); err != nil {
+			return nil, fmt.Errorf("could not get latest execution payload header %v", err)
+		}
+		if blockExecution, err = block.Block().Body().Execution(); err != nil {
+			return nil, fmt.Errorf("could not get block execution payload %v", err)
+		}
+		if executionBranch, err = executionBranchFromBody(block.Block().Body(), block.Version()); err != nil {
+			return nil, fmt.Errorf("could not get execution branch %v", err)
+		}
+	}
+
+	headerRoot, err := lightClientHeaderRoot(header, stateExecution, executionBranch, block.Version())
 	if err != nil {
 		return nil, fmt.Errorf("could not get header root %v", err)
 	}
 
-	blockRoot, err := block.Block().HashTreeRoot()
+	signedBlockHeader, err := block.Header()
+	if err != nil {
+		return nil, fmt.Errorf("could not get block header %v", err)
+	}
+	blockRoot, err := lightClientHeaderRoot(signedBlockHeader.Header, blockExecution, executionBranch, block.Version())
 	if err != nil {
 		return nil, fmt.Errorf("could not get block root %v", err)
 	}
 
 	if headerRoot != blockRoot {
-		return nil, fmt.Errorf("header root %#x not equal to block root %#x", headerRoot, blockRoot)
+		return nil, errors.Wrapf(ErrHeaderRootMismatch, "header root %#x not equal to block root %#x", headerRoot, blockRoot)
 	}
 
 	// assert attested_state.slot == attested_state.latest_block_header.slot
@@ -111,6 +387,11 @@ func NewLightClientOptimisticUpdateFromBeaconState(
 	// attested_header = attested_state.latest_block_header.copy()
 	attestedHeader := attestedState.LatestBlockHeader()
 
+	// assert update.signature_slot > update.attested_header.slot
+	if err := verifySignatureSlot(block.Block().Slot(), attestedHeader.Slot); err != nil {
+		return nil, err
+	}
+
 	// attested_header.state_root = hash_tree_root(attested_state)
 	attestedStateRoot, err := attestedState.HashTreeRoot(ctx)
 	if err != nil {
@@ -125,7 +406,7 @@ func NewLightClientOptimisticUpdateFromBeaconState(
 	}
 
 	if attestedHeaderRoot != block.Block().ParentRoot() {
-		return nil, fmt.Errorf("attested header root %#x not equal to block parent root %#x", attestedHeaderRoot, block.Block().ParentRoot())
+		return nil, errors.Wrapf(ErrParentRootMismatch, "attested header root %#x not equal to block parent root %#x", attestedHeaderRoot, block.Block().ParentRoot())
 	}
 
 	// Return result
@@ -151,12 +432,45 @@ func NewLightClientOptimisticUpdateFromBeaconState(
 	return result, nil
 }
 
+// LightClientUpdateOption configures how a light client update is built from beacon states.
+type LightClientUpdateOption func(*lightClientUpdateConfig)
+
+type lightClientUpdateConfig struct {
+	optimisticFallback bool
+	finalizedRoot      *[32]byte
+}
+
+// WithOptimisticFallback makes NewLightClientFinalityUpdateFromBeaconState return the optimistic
+// update unchanged when there is no finalized block, instead of filling a zeroed finalized header
+// and finality branch.
+func WithOptimisticFallback() LightClientUpdateOption {
+	return func(cfg *lightClientUpdateConfig) {
+		cfg.optimisticFallback = true
+	}
+}
+
+// WithFinalizedRoot pins the finalized header of NewLightClientFinalityUpdateFromBeaconState to the
+// given root: the finalized block must have this root instead of being checked against the
+// finalized checkpoint of the attested state. As the finality branch proves the finalized
+// checkpoint of the attested state, that checkpoint must still be the pinned root. A missing or
+// genesis finalized block, which gives a zeroed finalized header, never matches the pinned root.
+func WithFinalizedRoot(root [32]byte) LightClientUpdateOption {
+	return func(cfg *lightClientUpdateConfig) {
+		cfg.finalizedRoot = &root
+	}
+}
+
 func NewLightClientFinalityUpdateFromBeaconState(
 	ctx context.Context,
 	state state.BeaconState,
 	block interfaces.ReadOnlySignedBeaconBlock,
 	attestedState state.BeaconState,
-	finalizedBlock interfaces.ReadOnlySignedBeaconBlock) (*ethpbv2.LightClientUpdate, error) {
+	finalizedBlock interfaces.ReadOnlySignedBeaconBlock,
+	opts ...LightClientUpdateOption) (*ethpbv2.LightClientUpdate, error) {
+	cfg := &lightClientUpdateConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
 	result, err := NewLightClientOptimisticUpdateFromBeaconState(
 		ctx,
 		state,
@@ -166,6 +480,12 @@ func NewLightClientFinalityUpdateFromBeaconState(
 	if err != nil {
 		return nil, err
 	}
+	if cfg.finalizedRoot != nil && (finalizedBlock == nil || finalizedBlock.IsNil()) {
+		return nil, errors.Wrapf(errFinalizedRootMismatch, "no finalized block for pinned finalized root %#x", *cfg.finalizedRoot)
+	}
+	if cfg.optimisticFallback && (finalizedBlock == nil || finalizedBlock.IsNil()) {
+		return result, nil
+	}
 
 	// Indicate finality whenever possible
 	var finalizedHeader *ethpbv1.BeaconBlockHeader
@@ -184,10 +504,21 @@ func NewLightClientFinalityUpdateFromBeaconState(
 				return nil, fmt.Errorf("could not get finalized header root %v", err)
 			}
 
-			if finalizedHeaderRoot != bytesutil.ToBytes32(attestedState.FinalizedCheckpoint().Root) {
-				return nil, fmt.Errorf("finalized header root %#x not equal to attested finalized checkpoint root %#x", finalizedHeaderRoot, bytesutil.ToBytes32(attestedState.FinalizedCheckpoint().Root))
+			attestedFinalizedRoot := bytesutil.ToBytes32(attestedState.FinalizedCheckpoint().Root)
+			if cfg.finalizedRoot != nil {
+				if finalizedHeaderRoot != *cfg.finalizedRoot {
+					return nil, errors.Wrapf(errFinalizedRootMismatch, "finalized header root %#x not equal to pinned finalized root %#x", finalizedHeaderRoot, *cfg.finalizedRoot)
+				}
+				if attestedFinalizedRoot != *cfg.finalizedRoot {
+					return nil, errors.Wrapf(errFinalizedRootMismatch, "pinned finalized root %#x not equal to attested finalized checkpoint root %#x", *cfg.finalizedRoot, attestedFinalizedRoot)
+				}
+			} else if finalizedHeaderRoot != attestedFinalizedRoot {
+				return nil, fmt.Errorf("finalized header root %#x not equal to attested finalized checkpoint root %#x", finalizedHeaderRoot, attestedFinalizedRoot)
 			}
 		} else {
+			if cfg.finalizedRoot != nil {
+				return nil, errors.Wrapf(errFinalizedRootMismatch, "genesis finalized block does not match pinned finalized root %#x", *cfg.finalizedRoot)
+			}
 			if !bytes.Equal(attestedState.FinalizedCheckpoint().Root, make([]byte, 32)) {
 				return nil, fmt.Errorf("invalid finalized header root %v", attestedState.FinalizedCheckpoint().Root)
 			}
@@ -226,14 +557,200 @@ func NewLightClientFinalityUpdateFromBeaconState(
 	return result, nil
 }
 
-func NewLightClientUpdateFromFinalityUpdate(update *ethpbv2.LightClientFinalityUpdate) *ethpbv2.LightClientUpdate {
+// UpdateInput holds the arguments of a single NewLightClientFinalityUpdateFromBeaconState call.
+type UpdateInput struct {
+	State          state.BeaconState
+	Block          interfaces.ReadOnlySignedBeaconBlock
+	AttestedState  state.BeaconState
+	FinalizedBlock interfaces.ReadOnlySignedBeaconBlock
+	Opts           []LightClientUpdateOption
+}
+
+// CreateFinalityUpdatesConcurrent builds the finality update of each input with at most workers
+// concurrent calls to NewLightClientFinalityUpdateFromBeaconState, GOMAXPROCS if workers is not
+// positive. The returned slices hold the update and the error of each input at its index, the last
+// return value is only set if the context is done. Every call builds its own update and only reads
+// its input, so the same states and blocks may be shared by several inputs.
+func CreateFinalityUpdatesConcurrent(ctx context.Context, inputs []UpdateInput, workers int) ([]*ethpbv2.LightClientUpdate, []error, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	updates := make([]*ethpbv2.LightClientUpdate, len(inputs))
+	errs := make([]error, len(inputs))
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(workers)
+	for i, input := range inputs {
+		if egCtx.Err() != nil {
+			break
+		}
+		i, input := i, input
+		eg.Go(func() error {
+			if err := egCtx.Err(); err != nil {
+				return err
+			}
+			updates[i], errs[i] = NewLightClientFinalityUpdateFromBeaconState(egCtx, input.State, input.Block, input.AttestedState, input.FinalizedBlock, input.Opts...)
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	return updates, errs, nil
+}
+
+// NewLightClientUpdateFromBeaconState builds a full light client update: the finality update of
+// NewLightClientFinalityUpdateFromBeaconState together with the next sync committee of the attested
+// state and its branch. As in the spec, the next sync committee is only attached when the attested
+// block and the signature are in the same sync committee period, as it is otherwise not signed by
+// the committee that precedes it.
+func NewLightClientUpdateFromBeaconState(
+	ctx context.Context,
+	state state.BeaconState,
+	block interfaces.ReadOnlySignedBeaconBlock,
+	attestedState state.BeaconState,
+	finalizedBlock interfaces.ReadOnlySignedBeaconBlock) (*ethpbv2.LightClientUpdate, error) {
+	result, err := NewLightClientFinalityUpdateFromBeaconState(ctx, state, block, attestedState, finalizedBlock)
+	if err != nil {
+		return nil, err
+	}
+	if syncCommitteePeriodAtSlot(result.AttestedHeader.Slot) != syncCommitteePeriodAtSlot(result.SignatureSlot) {
+		return result, nil
+	}
+
+	nextSyncCommittee, err := attestedState.NextSyncCommittee()
+	if err != nil {
+		return nil, fmt.Errorf("could not get next sync committee %v", err)
+	}
+	nextSyncCommitteeBranch, err := attestedState.NextSyncCommitteeProof(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get next sync committee proof %v", err)
+	}
+	result.NextSyncCommittee = &ethpbv2.SyncCommittee{
+		Pubkeys:         nextSyncCommittee.Pubkeys,
+		AggregatePubkey: nextSyncCommittee.AggregatePubkey,
+	}
+	result.NextSyncCommitteeBranch = nextSyncCommitteeBranch
+	return result, nil
+}
+
+// CreateLightClientBootstrap builds the light client bootstrap of the given block from its post
+// state, as in the spec create_light_client_bootstrap: the block header with the state root
+// filled, the current sync committee of the state and its branch.
+func CreateLightClientBootstrap(
+	ctx context.Context,
+	state state.BeaconState,
+	block interfaces.ReadOnlySignedBeaconBlock) (*ethpbv2.LightClientBootstrap, error) {
+	// assert compute_epoch_at_slot(state.slot) >= ALTAIR_FORK_EPOCH
+	epoch := slots.ToEpoch(state.Slot())
+	if epoch < params.BeaconConfig().AltairForkEpoch {
+		return nil, fmt.Errorf("invalid state epoch %d", epoch)
+	}
+
+	// assert state.slot == state.latest_block_header.slot
+	if state.Slot() != state.LatestBlockHeader().Slot {
+		return nil, fmt.Errorf("state slot %d not equal to latest block header slot %d", state.Slot(), state.LatestBlockHeader().Slot)
+	}
+
+	// header = state.latest_block_header.copy()
+	// header.state_root = hash_tree_root(state)
+	header := state.LatestBlockHeader()
+	stateRoot, err := state.HashTreeRoot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get state root %v", err)
+	}
+	header.StateRoot = stateRoot[:]
+
+	// assert hash_tree_root(header) == hash_tree_root(block.message)
+	headerRoot, err := header.HashTreeRoot()
+	if err != nil {
+		return nil, fmt.Errorf("could not get header root %v", err)
+	}
+	blockRoot, err := block.Block().HashTreeRoot()
+	if err != nil {
+		return nil, fmt.Errorf("could not get block root %v", err)
+	}
+	if headerRoot != blockRoot {
+		return nil, errors.Wrapf(ErrHeaderRootMismatch, "header root %#x not equal to block root %#x", headerRoot, blockRoot)
+	}
+
+	currentSyncCommittee, err := state.CurrentSyncCommittee()
+	if err != nil {
+		return nil, fmt.Errorf("could not get current sync committee %v", err)
+	}
+	currentSyncCommitteeBranch, err := state.CurrentSyncCommitteeProof(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get current sync committee proof %v", err)
+	}
+
+	return &ethpbv2.LightClientBootstrap{
+		Header: &ethpbv1.BeaconBlockHeader{
+			Slot:          header.Slot,
+			ProposerIndex: header.ProposerIndex,
+			ParentRoot:    header.ParentRoot,
+			StateRoot:     header.StateRoot,
+			BodyRoot:      header.BodyRoot,
+		},
+		CurrentSyncCommittee: &ethpbv2.SyncCommittee{
+			Pubkeys:         currentSyncCommittee.Pubkeys,
+			AggregatePubkey: currentSyncCommittee.AggregatePubkey,
+		},
+		CurrentSyncCommitteeBranch: currentSyncCommitteeBranch,
+	}, nil
+}
+
+// VerifyBootstrap checks that the current sync committee of the light client bootstrap is the one
+// saved in the state of its header, as in the spec initialize_light_client_store.
+func VerifyBootstrap(bootstrap *ethpbv2.LightClientBootstrap) error {
+	if bootstrap == nil || bootstrap.Header == nil || bootstrap.CurrentSyncCommittee == nil {
+		return errors.New("nil light client bootstrap")
+	}
+	// assert is_valid_merkle_branch(
+	//     leaf=hash_tree_root(bootstrap.current_sync_committee),
+	//     branch=bootstrap.current_sync_committee_branch,
+	//     depth=floorlog2(CURRENT_SYNC_COMMITTEE_GINDEX),
+	//     index=get_subtree_index(CURRENT_SYNC_COMMITTEE_GINDEX),
+	//     root=bootstrap.header.beacon.state_root,
+	// )
+	currentSyncCommitteeRoot, err := bootstrap.CurrentSyncCommittee.HashTreeRoot()
+	if err != nil {
+		return fmt.Errorf("could not get current sync committee root %v", err)
+	}
+	if !trie.VerifyMerkleProof(bootstrap.Header.StateRoot, currentSyncCommitteeRoot[:], currentSyncCommitteeGeneralizedIndex, bootstrap.CurrentSyncCommitteeBranch) {
+		return errInvalidCurrentSyncCommitteeBranch
+	}
+	return nil
+}
+
+// NewLightClientUpdateFromFinalityUpdate converts a finality update into a light client update,
+// after checking that its finality branch has the expected shape.
+func NewLightClientUpdateFromFinalityUpdate(update *ethpbv2.LightClientFinalityUpdate) (*ethpbv2.LightClientUpdate, error) {
+	if err := validateFinalityBranchShape(update.FinalityBranch); err != nil {
+		return nil, err
+	}
 	return &ethpbv2.LightClientUpdate{
 		AttestedHeader:  update.AttestedHeader,
 		FinalizedHeader: update.FinalizedHeader,
 		FinalityBranch:  update.FinalityBranch,
 		SyncAggregate:   update.SyncAggregate,
 		SignatureSlot:   update.SignatureSlot,
+	}, nil
+}
+
+// validateFinalityBranchShape checks that the finality branch has exactly finalityBranchNumOfLeaves
+// leaves of 32 bytes each.
+func validateFinalityBranchShape(branch [][]byte) error {
+	if len(branch) != finalityBranchNumOfLeaves {
+		return errors.Wrapf(errInvalidFinalityBranch, "got %d leaves, want %d", len(branch), finalityBranchNumOfLeaves)
+	}
+	for i, leaf := range branch {
+		if len(leaf) != fieldparams.RootLength {
+			return errors.Wrapf(errInvalidFinalityBranch, "leaf %d has %d bytes, want %d", i, len(leaf), fieldparams.RootLength)
+		}
 	}
+	return nil
 }
 
 func NewLightClientUpdateFromOptimisticUpdate(update *ethpbv2.LightClientOptimisticUpdate) *ethpbv2.LightClientUpdate {
@@ -243,3 +760,520 @@ func NewLightClientUpdateFromOptimisticUpdate(update *ethpbv2.LightClientOptimis
 		SignatureSlot:  update.SignatureSlot,
 	}
 }
+
+// IsBetterUpdate - implements https://github.com/ethereum/consensus-specs/blob/3d235740e5f1e641d3b160c8688f26e7dc5a1894/specs/altair/light-client/sync-protocol.md#is_better_update
+// It reports whether newUpdate should replace oldUpdate as the best update of a sync committee period.
+func IsBetterUpdate(newUpdate, oldUpdate *ethpbv2.LightClientUpdate) bool {
+	// Compare supermajority (> 2/3) sync committee participation
+	maxActiveParticipants := newUpdate.SyncAggregate.SyncCommitteeBits.Len()
+	newNumActiveParticipants := newUpdate.SyncAggregate.SyncCommitteeBits.Count()
+	oldNumActiveParticipants := oldUpdate.SyncAggregate.SyncCommitteeBits.Count()
+	newHasSupermajority := newNumActiveParticipants*3 >= maxActiveParticipants*2
+	oldHasSupermajority := oldNumActiveParticipants*3 >= maxActiveParticipants*2
+	if newHasSupermajority != oldHasSupermajority {
+		return newHasSupermajority
+	}
+	if !newHasSupermajority && newNumActiveParticipants != oldNumActiveParticipants {
+		return newNumActiveParticipants > oldNumActiveParticipants
+	}
+
+	// Compare presence of relevant sync committee
+	newHasRelevantSyncCommittee := isSyncCommitteeUpdate(newUpdate) &&
+		syncCommitteePeriodAtSlot(newUpdate.AttestedHeader.Slot) == syncCommitteePeriodAtSlot(newUpdate.SignatureSlot)
+	oldHasRelevantSyncCommittee := isSyncCommitteeUpdate(oldUpdate) &&
+		syncCommitteePeriodAtSlot(oldUpdate.AttestedHeader.Slot) == syncCommitteePeriodAtSlot(oldUpdate.SignatureSlot)
+	if newHasRelevantSyncCommittee != oldHasRelevantSyncCommittee {
+		return newHasRelevantSyncCommittee
+	}
+
+	// Compare indication of any finality
+	newHasFinality := isFinalityUpdate(newUpdate)
+	oldHasFinality := isFinalityUpdate(oldUpdate)
+	if newHasFinality != oldHasFinality {
+		return newHasFinality
+	}
+
+	// Compare sync committee finality
+	if newHasFinality {
+		newHasSyncCommitteeFinality := syncCommitteePeriodAtSlot(newUpdate.FinalizedHeader.Slot) == syncCommitteePeriodAtSlot(newUpdate.AttestedHeader.Slot)
+		oldHasSyncCommitteeFinality := syncCommitteePeriodAtSlot(oldUpdate.FinalizedHeader.Slot) == syncCommitteePeriodAtSlot(oldUpdate.AttestedHeader.Slot)
+		if newHasSyncCommitteeFinality != oldHasSyncCommitteeFinality {
+			return newHasSyncCommitteeFinality
+		}
+	}
+
+	// Tiebreaker 1: Sync committee participation beyond supermajority
+	if newNumActiveParticipants != oldNumActiveParticipants {
+		return newNumActiveParticipants > oldNumActiveParticipants
+	}
+
+	// Tiebreaker 2: Prefer older data (fewer changes to best)
+	if newUpdate.AttestedHeader.Slot != oldUpdate.AttestedHeader.Slot {
+		return newUpdate.AttestedHeader.Slot < oldUpdate.AttestedHeader.Slot
+	}
+	return newUpdate.SignatureSlot < oldUpdate.SignatureSlot
+}
+
+func syncCommitteePeriodAtSlot(slot primitives.Slot) uint64 {
+	return slots.SyncCommitteePeriod(slots.ToEpoch(slot))
+}
+
+func isSyncCommitteeUpdate(update *ethpbv2.LightClientUpdate) bool {
+	return hasNonZeroBranch(update.NextSyncCommitteeBranch)
+}
+
+func isFinalityUpdate(update *ethpbv2.LightClientUpdate) bool {
+	return hasNonZeroBranch(update.FinalityBranch)
+}
+
+func hasNonZeroBranch(branch [][]byte) bool {
+	for _, leaf := range branch {
+		if !bytes.Equal(leaf, make([]byte, len(leaf))) {
+			return true
+		}
+	}
+	return false
+}
+
+// SyncCommitteeParticipation returns the number of sync committee members that signed the update.
+func SyncCommitteeParticipation(update *ethpbv2.LightClientUpdate) uint64 {
+	if update == nil || update.SyncAggregate == nil {
+		return 0
+	}
+	return update.SyncAggregate.SyncCommitteeBits.Count()
+}
+
+// verifySyncAggregateSignature checks that the sync aggregate signature has the length of a BLS
+// signature and is not all zeros. It does not verify the signature itself.
+func verifySyncAggregateSignature(sig []byte) error {
+	if len(sig) != fieldparams.BLSSignatureLength {
+		return errors.Wrapf(ErrInvalidSyncAggregateSignature, "length %d, expected %d", len(sig), fieldparams.BLSSignatureLength)
+	}
+	if bytes.Equal(sig, make([]byte, fieldparams.BLSSignatureLength)) {
+		return errors.Wrap(ErrInvalidSyncAggregateSignature, "empty signature")
+	}
+	return nil
+}
+
+// HasRealFinality returns false if the update carries the placeholder finality produced by
+// NewLightClientFinalityUpdateFromBeaconState when no finalized block is known: a zero finalized
+// header together with an all-zero finality branch.
+func HasRealFinality(update *ethpbv2.LightClientUpdate) bool {
+	if update == nil {
+		return false
+	}
+	return !isZeroHeader(update.FinalizedHeader) || hasNonZeroBranch(update.FinalityBranch)
+}
+
+func isZeroHeader(header *ethpbv1.BeaconBlockHeader) bool {
+	if header == nil {
+		return true
+	}
+	return header.Slot == 0 && header.ProposerIndex == 0 &&
+		bytes.Equal(header.ParentRoot, make([]byte, len(header.ParentRoot))) &&
+		bytes.Equal(header.StateRoot, make([]byte, len(header.StateRoot))) &&
+		bytes.Equal(header.BodyRoot, make([]byte, len(header.BodyRoot)))
+}
+
+// validateLightClientUpdate checks the consistency of a light client update on its own: the sync committee
+// participation, the ordering of its slots and the finality branch against the attested header state root.
+// The sync aggregate signature is not verified as it requires the sync committee of a light client store.
+func validateLightClientUpdate(update *ethpbv2.LightClientUpdate) error {
+	if update == nil || update.AttestedHeader == nil || update.SyncAggregate == nil {
+		return errors.New("nil light client update")
+	}
+	// assert sum(sync_aggregate.sync_committee_bits) >= MIN_SYNC_COMMITTEE_PARTICIPANTS
+	if update.SyncAggregate.SyncCommitteeBits.Count() < params.BeaconConfig().MinSyncCommitteeParticipants {
+		return fmt.Errorf("invalid sync committee bits count %d", update.SyncAggregate.SyncCommitteeBits.Count())
+	}
+	// assert current_slot >= update.signature_slot > update_attested_slot >= update_finalized_slot
+	if err := verifySignatureSlot(update.SignatureSlot, update.AttestedHeader.Slot); err != nil {
+		return err
+	}
+	// Verify that the `next_sync_committee`, if present, actually is the next sync committee saved in the
+	// state of the `attested_header`.
+	if isSyncCommitteeUpdate(update) {
+		if update.NextSyncCommittee == nil {
+			return errors.New("nil next sync committee")
+		}
+		nextSyncCommitteeRoot, err := update.NextSyncCommittee.HashTreeRoot()
+		if err != nil {
+			return fmt.Errorf("could not get next sync committee root %v", err)
+		}
+		if !trie.VerifyMerkleProof(update.AttestedHeader.StateRoot, nextSyncCommitteeRoot[:], nextSyncCommitteeGeneralizedIndex, update.NextSyncCommitteeBranch) {
+			return errors.New("invalid next sync committee branch")
+		}
+	}
+	if !isFinalityUpdate(update) {
+		return nil
+	}
+	if update.FinalizedHeader == nil {
+		return errors.New("nil finalized header")
+	}
+	if update.AttestedHeader.Slot < update.FinalizedHeader.Slot {
+		return fmt.Errorf("attested slot %d is lower than finalized slot %d", update.AttestedHeader.Slot, update.FinalizedHeader.Slot)
+	}
+	// Verify that the `finality_branch`, if present, confirms `finalized_header`
+	// to match the finalized checkpoint root saved in the state of `attested_header`.
+	finalizedRoot := params.BeaconConfig().ZeroHash
+	if update.FinalizedHeader.Slot != params.BeaconConfig().GenesisSlot {
+		var err error
+		finalizedRoot, err = update.FinalizedHeader.HashTreeRoot()
+		if err != nil {
+			return fmt.Errorf("could not get finalized header root %v", err)
+		}
+	}
+	if !trie.VerifyMerkleProof(update.AttestedHeader.StateRoot, finalizedRoot[:], statenative.FinalizedRootGeneralizedIndex(), update.FinalityBranch) {
+		return errors.New("invalid finality branch")
+	}
+	return nil
+}
+
+// ValidateUpdates validates the given light client updates concurrently. The returned slice holds the
+// validation error of each update at its index, the second return value is only set if the context is done.
+func (s *Service) ValidateUpdates(ctx context.Context, updates []*ethpbv2.LightClientUpdate) ([]error, error) {
+	errs := make([]error, len(updates))
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(runtime.GOMAXPROCS(0))
+	for i, update := range updates {
+		if egCtx.Err() != nil {
+			break
+		}
+		i, update := i, update
+		eg.Go(func() error {
+			if err := egCtx.Err(); err != nil {
+				return err
+			}
+			errs[i] = validateLightClientUpdate(update)
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+// MaybeUpdateBestForPeriod builds a full light client update, with the next sync committee, from the
+// current head for the given sync committee period, and caches it as the best update of that period if it is better than the cached
+// one according to IsBetterUpdate. It returns whether the cached update was replaced. Nothing is
+// cached when the head does not attest a block of the given period.
+func (s *Service) MaybeUpdateBestForPeriod(ctx context.Context, period uint64) (bool, error) {
+	headRoot, err := s.HeadRoot(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "could not get head root")
+	}
+	blockRoot := bytesutil.ToBytes32(headRoot)
+	block, err := s.getBlock(ctx, blockRoot)
+	if err != nil {
+		return false, errors.Wrap(err, "could not get head block")
+	}
+	attestedRoot := block.Block().ParentRoot()
+	attestedBlock, err := s.getBlock(ctx, attestedRoot)
+	if err != nil {
+		return false, errors.Wrap(err, "could not get attested block")
+	}
+	if syncCommitteePeriodAtSlot(attestedBlock.Block().Slot()) != period {
+		return false, nil
+	}
+	st, err := s.cfg.StateGen.StateByRoot(ctx, blockRoot)
+	if err != nil {
+		return false, errors.Wrap(err, "could not get head state")
+	}
+	attestedState, err := s.cfg.StateGen.StateByRoot(ctx, attestedRoot)
+	if err != nil {
+		return false, errors.Wrap(err, "could not get attested state")
+	}
+	var finalizedBlock interfaces.ReadOnlySignedBeaconBlock
+	finalizedRoot := bytesutil.ToBytes32(attestedState.FinalizedCheckpoint().Root)
+	if finalizedRoot != params.BeaconConfig().ZeroHash {
+		finalizedBlock, err = s.getBlock(ctx, finalizedRoot)
+		if err != nil {
+			return false, errors.Wrap(err, "could not get finalized block")
+		}
+	}
+	update, err := NewLightClientUpdateFromBeaconState(ctx, st, block, attestedState, finalizedBlock)
+	if err != nil {
+		return false, errors.Wrap(err, "could not create light client update")
+	}
+
+	s.lcBestUpdates.Lock()
+	defer s.lcBestUpdates.Unlock()
+	best, ok := s.lcBestUpdates.updates[period]
+	if ok && !IsBetterUpdate(update, best) {
+		return false, nil
+	}
+	s.lcBestUpdates.updates[period] = update
+	return true, nil
+}
+
+// CacheLightClientOptimisticUpdate stores a copy of the given optimistic update as the latest one
+// if its attested slot is higher than the one of the cached update. It returns whether the cache
+// was replaced.
+func (s *Service) CacheLightClientOptimisticUpdate(update *ethpbv2.LightClientOptimisticUpdate) bool {
+	if update == nil || update.AttestedHeader == nil {
+		return false
+	}
+	s.lcOptimisticUpdate.Lock()
+	defer s.lcOptimisticUpdate.Unlock()
+	cached := s.lcOptimisticUpdate.update
+	if cached != nil && update.AttestedHeader.Slot <= cached.AttestedHeader.Slot {
+		return false
+	}
+	s.lcOptimisticUpdate.previous = cached
+	s.lcOptimisticUpdate.update = proto.Clone(update).(*ethpbv2.LightClientOptimisticUpdate)
+	return true
+}
+
+// LatestOptimisticUpdate returns a copy of the cached light client optimistic update with the
+// highest attested slot. The optimistic update of the current head is built and cached first if it
+// was not yet. When optimistic updates are delayed, an update attested in the current slot is
+// withheld and the update it replaced is returned instead.
+func (s *Service) LatestOptimisticUpdate(ctx context.Context) (*ethpbv2.LightClientOptimisticUpdate, error) {
+	s.cacheHeadLightClientOptimisticUpdate(ctx)
+	s.lcOptimisticUpdate.RLock()
+	defer s.lcOptimisticUpdate.RUnlock()
+	update := s.lcOptimisticUpdate.update
+	if update != nil && s.cfg.DelayOptimisticUpdates {
+		currentSlot := s.CurrentSlot()
+		if update.AttestedHeader.Slot >= currentSlot {
+			update = s.lcOptimisticUpdate.previous
+		}
+		if update != nil && update.AttestedHeader.Slot >= currentSlot {
+			update = nil
+		}
+	}
+	if update == nil {
+		return nil, errNoLightClientOptimisticUpdate
+	}
+	return proto.Clone(update).(*ethpbv2.LightClientOptimisticUpdate), nil
+}
+
+// FinalityUpdateForFinalizedRoot builds a light client finality update whose finalized header is
+// the canonical block with the given root. A state can only finalize the root from the second
+// epoch after the one of the finalized block, so the canonical chain is walked back from head
+// without replaying states down to that epoch. States are then replayed from there, and the
+// first block whose parent state finalized `finalizedRoot` is used as the signature block and its
+// parent as the attested block. The walk fails once finalization moves past the root.
+func (s *Service) FinalityUpdateForFinalizedRoot(ctx context.Context, finalizedRoot [32]byte) (*ethpbv2.LightClientFinalityUpdate, error) {
+	canonical, err := s.IsCanonical(ctx, finalizedRoot)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not check if finalized root is canonical")
+	}
+	if !canonical {
+		return nil, errors.Wrapf(errFinalizedRootNotCanonical, "root %#x", finalizedRoot)
+	}
+	finalizedBlock, err := s.getBlock(ctx, finalizedRoot)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get finalized block")
+	}
+	finalizedEpoch := slots.ToEpoch(finalizedBlock.Block().Slot())
+	firstAttestedSlot, err := slots.EpochStart(finalizedEpoch + 2)
+	if err != nil {
+		return nil, err
+	}
+
+	headRoot, err := s.HeadRoot(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get head root")
+	}
+	blockRoot := bytesutil.ToBytes32(headRoot)
+	block, err := s.getBlock(ctx, blockRoot)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get head block")
+	}
+	// Signature blocks whose parent may have finalized the root, from the most recent to the oldest.
+	var signatureRoots [][32]byte
+	var signatureBlocks []interfaces.ReadOnlySignedBeaconBlock
+	for block.Block().Slot() > firstAttestedSlot {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		attestedRoot := block.Block().ParentRoot()
+		attestedBlock, err := s.getBlock(ctx, attestedRoot)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not get attested block")
+		}
+		if attestedBlock.Block().Slot() < firstAttestedSlot {
+			break
+		}
+		signatureRoots = append(signatureRoots, blockRoot)
+		signatureBlocks = append(signatureBlocks, block)
+		block, blockRoot = attestedBlock, attestedRoot
+	}
+
+	for i := len(signatureBlocks) - 1; i >= 0; i-- {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		block, blockRoot = signatureBlocks[i], signatureRoots[i]
+		attestedState, err := s.cfg.StateGen.StateByRoot(ctx, block.Block().ParentRoot())
+		if err != nil {
+			return nil, errors.Wrap(err, "could not get attested state")
+		}
+		cp := attestedState.FinalizedCheckpoint()
+		if bytesutil.ToBytes32(cp.Root) != finalizedRoot {
+			// The checkpoint of an epoch after the one of the finalized block can only be a
+			// different root once finalization has moved past it.
+			if cp.Epoch > finalizedEpoch {
+				return nil, errors.Wrapf(errNoFinalityUpdateForRoot, "root %#x, finalized checkpoint moved to epoch %d at slot %d", finalizedRoot, cp.Epoch, attestedState.Slot())
+			}
+			continue
+		}
+		st, err := s.cfg.StateGen.StateByRoot(ctx, blockRoot)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not get signature block state")
+		}
+		update, err := NewLightClientFinalityUpdateFromBeaconState(ctx, st, block, attestedState, finalizedBlock)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create light client update")
+		}
+		return CreateLightClientFinalityUpdate(update), nil
+	}
+	return nil, errors.Wrapf(errNoFinalityUpdateForRoot, "root %#x", finalizedRoot)
+}
+
+// sendLightClientFinalityUpdate publishes a light client finality update over the state feed when the
+// given block advances finalization, using it as the signature block and its parent as the attested
+// block. The update is skipped, without error, before Altair, when the block does not have enough
+// sync committee participants, or when the attested state or the block it finalized is not available
+// yet.
+func (s *Service) sendLightClientFinalityUpdate(ctx context.Context, signed interfaces.ReadOnlySignedBeaconBlock, postState state.BeaconState) error {
+	if signed.Version() < version.Altair {
+		return nil
+	}
+	syncAggregate, err := signed.Block().Body().SyncAggregate()
+	if err != nil {
+		return errors.Wrap(err, "could not get sync aggregate")
+	}
+	if participants := syncAggregate.SyncCommitteeBits.Count(); participants < params.BeaconConfig().MinSyncCommitteeParticipants {
+		log.WithField("participants", participants).Debug("Skipping light client finality update, not enough sync committee participants")
+		return nil
+	}
+	attestedState, err := s.lightClientAttestedState(ctx, signed)
+	if err != nil {
+		return err
+	}
+	if attestedState == nil {
+		log.WithField("root", fmt.Sprintf("%#x", signed.Block().ParentRoot())).Debug("Skipping light client finality update, attested state not available")
+		return nil
+	}
+	finalizedRoot := bytesutil.ToBytes32(attestedState.FinalizedCheckpoint().Root)
+	finalizedBlock, err := s.getBlock(ctx, finalizedRoot)
+	if errors.Is(err, errBlockNotFoundInCacheOrDB) {
+		log.WithField("root", fmt.Sprintf("%#x", finalizedRoot)).Debug("Skipping light client finality update, finalized block not available")
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not get finalized block")
+	}
+	update, err := NewLightClientFinalityUpdateFromBeaconState(ctx, postState, signed, attestedState, finalizedBlock)
+	if err != nil {
+		return errors.Wrap(err, "could not create light client update")
+	}
+	s.cfg.StateNotifier.StateFeed().Send(&feed.Event{
+		Type: statefeed.LightClientFinalityUpdate,
+		Data: CreateLightClientFinalityUpdate(update),
+	})
+	return nil
+}
+
+// cacheHeadLightClientOptimisticUpdate caches the light client optimistic update of the current head
+// block, working on a copy of the head state. It is only built once per head.
+func (s *Service) cacheHeadLightClientOptimisticUpdate(ctx context.Context) {
+	s.headLock.RLock()
+	if !s.hasHeadState() || s.head.block == nil {
+		s.headLock.RUnlock()
+		return
+	}
+	headRoot := s.headRoot()
+	s.lcOptimisticUpdate.RLock()
+	built := s.lcOptimisticUpdate.headRoot == headRoot
+	s.lcOptimisticUpdate.RUnlock()
+	if built {
+		s.headLock.RUnlock()
+		return
+	}
+	headBlock, err := s.headBlock()
+	if err != nil {
+		s.headLock.RUnlock()
+		log.WithError(err).Debug("Could not get head block")
+		return
+	}
+	headState := s.headState(ctx)
+	s.headLock.RUnlock()
+
+	if err := s.cacheLightClientOptimisticUpdate(ctx, headBlock, headState); err != nil {
+		log.WithError(err).Debug("Could not cache light client optimistic update")
+	}
+	s.lcOptimisticUpdate.Lock()
+	s.lcOptimisticUpdate.headRoot = headRoot
+	s.lcOptimisticUpdate.Unlock()
+}
+
+// cacheLightClientOptimisticUpdate builds the light client optimistic update of the given block, using
+// its parent as the attested block, and caches it as the latest optimistic update. The update is
+// skipped, without error, before Altair or when the attested state is not available.
+func (s *Service) cacheLightClientOptimisticUpdate(ctx context.Context, signed interfaces.ReadOnlySignedBeaconBlock, postState state.BeaconState) error {
+	if signed.Version() < version.Altair {
+		return nil
+	}
+	attestedState, err := s.lightClientAttestedState(ctx, signed)
+	if err != nil {
+		return err
+	}
+	if attestedState == nil {
+		log.WithField("root", fmt.Sprintf("%#x", signed.Block().ParentRoot())).Debug("Skipping light client optimistic update, attested state not available")
+		return nil
+	}
+	update, err := NewLightClientOptimisticUpdateFromBeaconState(ctx, postState, signed, attestedState)
+	if err != nil {
+		return errors.Wrap(err, "could not create light client update")
+	}
+	s.CacheLightClientOptimisticUpdate(CreateLightClientOptimisticUpdate(update))
+	return nil
+}
+
+// lightClientAttestedState returns the state of the parent of the given block, which is the attested
+// state of the light client updates signed in the block. It returns a nil state if the parent state
+// is neither stored nor replayable.
+func (s *Service) lightClientAttestedState(ctx context.Context, signed interfaces.ReadOnlySignedBeaconBlock) (state.BeaconState, error) {
+	attestedRoot := signed.Block().ParentRoot()
+	hasState, err := s.cfg.StateGen.HasState(ctx, attestedRoot)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not check attested state availability")
+	}
+	if !hasState && !s.cfg.BeaconDB.HasStateSummary(ctx, attestedRoot) {
+		return nil, nil
+	}
+	attestedState, err := s.cfg.StateGen.StateByRoot(ctx, attestedRoot)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get attested state")
+	}
+	return attestedState, nil
+}
+
+// LightClientBootstrap builds the light client bootstrap of the block with the given root from its
+// post state, replaying it from its state summary if needed. It returns an error wrapping
+// errNoLightClientBootstrapState if the state is neither stored nor replayable.
+func (s *Service) LightClientBootstrap(ctx context.Context, blockRoot [32]byte) (*ethpbv2.LightClientBootstrap, error) {
+	hasState, err := s.cfg.StateGen.HasState(ctx, blockRoot)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not check state availability")
+	}
+	if !hasState && !s.cfg.BeaconDB.HasStateSummary(ctx, blockRoot) {
+		return nil, errors.Wrapf(errNoLightClientBootstrapState, "root %#x", blockRoot)
+	}
+	st, err := s.cfg.StateGen.StateByRoot(ctx, blockRoot)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get state")
+	}
+	block, err := s.getBlock(ctx, blockRoot)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get block")
+	}
+	return CreateLightClientBootstrap(ctx, st, block)
+}
@@ -3,17 +3,28 @@ package blockchain
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/prysmaticlabs/go-bitfield"
+	blockchainTesting "github.com/prysmaticlabs/prysm/v4/beacon-chain/blockchain/testing"
+	statefeed "github.com/prysmaticlabs/prysm/v4/beacon-chain/core/feed/state"
 	"github.com/prysmaticlabs/prysm/v4/beacon-chain/state"
+	fieldparams "github.com/prysmaticlabs/prysm/v4/config/fieldparams"
 	"github.com/prysmaticlabs/prysm/v4/config/params"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/blocks"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/interfaces"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
+	"github.com/prysmaticlabs/prysm/v4/crypto/hash"
+	"github.com/prysmaticlabs/prysm/v4/encoding/bytesutil"
+	enginev1 "github.com/prysmaticlabs/prysm/v4/proto/engine/v1"
 	v1 "github.com/prysmaticlabs/prysm/v4/proto/eth/v1"
 	ethpbv2 "github.com/prysmaticlabs/prysm/v4/proto/eth/v2"
+	"github.com/prysmaticlabs/prysm/v4/proto/migration"
 	ethpb "github.com/prysmaticlabs/prysm/v4/proto/prysm/v1alpha1"
+	"github.com/prysmaticlabs/prysm/v4/runtime/version"
 	"github.com/prysmaticlabs/prysm/v4/testing/require"
 	"github.com/prysmaticlabs/prysm/v4/testing/util"
+	"google.golang.org/protobuf/proto"
 )
 
 type testlc struct {
@@ -22,6 +33,7 @@ type testlc struct {
 	state          state.BeaconState
 	block          interfaces.ReadOnlySignedBeaconBlock
 	attestedState  state.BeaconState
+	attestedBlock  interfaces.ReadOnlySignedBeaconBlock
 	attestedHeader *ethpb.BeaconBlockHeader
 }
 
@@ -30,6 +42,13 @@ func newTestLc(t *testing.T) *testlc {
 }
 
 func (l *testlc) setupTest() *testlc {
+	return l.setupTestWithFinalizedCheckpoint(nil)
+}
+
+// setupTestWithFinalizedCheckpoint prepares the test data with the given
+// finalized checkpoint set on the attested state and the attested block as a
+// child of the checkpoint root. A nil checkpoint leaves the default one.
+func (l *testlc) setupTestWithFinalizedCheckpoint(cp *ethpb.Checkpoint) *testlc {
 	ctx := context.Background()
 
 	slot := primitives.Slot(params.BeaconConfig().AltairForkEpoch * primitives.Epoch(params.BeaconConfig().SlotsPerEpoch)).Add(1)
@@ -38,9 +57,15 @@ func (l *testlc) setupTest() *testlc {
 	require.NoError(l.t, err)
 	err = attestedState.SetSlot(slot)
 	require.NoError(l.t, err)
+	if cp != nil {
+		require.NoError(l.t, attestedState.SetFinalizedCheckpoint(cp))
+	}
 
 	parent := util.NewBeaconBlockCapella()
 	parent.Block.Slot = slot
+	if cp != nil {
+		parent.Block.ParentRoot = bytesutil.SafeCopyBytes(cp.Root)
+	}
 
 	signedParent, err := blocks.NewSignedBeaconBlock(parent)
 	require.NoError(l.t, err)
@@ -59,25 +84,36 @@ func (l *testlc) setupTest() *testlc {
 	signedParent, err = blocks.NewSignedBeaconBlock(parent)
 	require.NoError(l.t, err)
 
+	// the signature block is in the slot following the attested block
 	state, err := util.NewBeaconStateCapella()
 	require.NoError(l.t, err)
-	err = state.SetSlot(slot)
+	err = state.SetSlot(slot + 1)
 	require.NoError(l.t, err)
 
 	parentRoot, err := signedParent.Block().HashTreeRoot()
 	require.NoError(l.t, err)
 
 	block := util.NewBeaconBlockCapella()
-	block.Block.Slot = slot
+	block.Block.Slot = slot + 1
 	block.Block.ParentRoot = parentRoot[:]
 
 	for i := uint64(0); i < params.BeaconConfig().MinSyncCommitteeParticipants; i++ {
 		block.Block.Body.SyncAggregate.SyncCommitteeBits.SetBitAt(i, true)
 	}
+	block.Block.Body.SyncAggregate.SyncCommitteeSignature = bytesutil.PadTo([]byte{'s'}, fieldparams.BLSSignatureLength)
 
 	signedBlock, err := blocks.NewSignedBeaconBlock(block)
 	require.NoError(l.t, err)
 
+	// the state holds the execution payload header of the block, as a post state would
+	execution, err := signedBlock.Block().Body().Execution()
+	require.NoError(l.t, err)
+	executionHeader, err := blocks.PayloadToHeaderCapella(execution)
+	require.NoError(l.t, err)
+	wrappedHeader, err := blocks.WrappedExecutionPayloadHeaderCapella(executionHeader, 0)
+	require.NoError(l.t, err)
+	require.NoError(l.t, state.SetLatestExecutionPayloadHeader(wrappedHeader))
+
 	h, err := signedBlock.Header()
 	require.NoError(l.t, err)
 
@@ -93,6 +129,7 @@ func (l *testlc) setupTest() *testlc {
 
 	l.state = state
 	l.attestedState = attestedState
+	l.attestedBlock = signedParent
 	l.attestedHeader = attestedHeader
 	l.block = signedBlock
 	l.ctx = ctx
@@ -158,3 +195,1004 @@ func TestLightClient_NewLightClientFinalityUpdateFromBeaconState(t *testing.T) {
 		require.DeepSSZEqual(t, zeroHash, leaf, "Leaf is not zero")
 	}
 }
+
+func TestLightClient_NewLightClientFinalityUpdateFromBeaconState_OptimisticFallback(t *testing.T) {
+	t.Run("no finalized block", func(t *testing.T) {
+		l := newTestLc(t).setupTest()
+
+		update, err := NewLightClientFinalityUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState, nil, WithOptimisticFallback())
+		require.NoError(t, err)
+		optimistic, err := NewLightClientOptimisticUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState)
+		require.NoError(t, err)
+		require.DeepEqual(t, optimistic, update)
+		require.Equal(t, (*v1.BeaconBlockHeader)(nil), update.FinalizedHeader, "Finalized header is not nil")
+		require.Equal(t, 0, len(update.FinalityBranch), "Finality branch is not empty")
+	})
+	t.Run("finalized block", func(t *testing.T) {
+		finalized := util.NewBeaconBlockCapella()
+		finalized.Block.Slot = 1
+		signedFinalized, err := blocks.NewSignedBeaconBlock(finalized)
+		require.NoError(t, err)
+		finalizedRoot, err := signedFinalized.Block().HashTreeRoot()
+		require.NoError(t, err)
+		l := newTestLc(t).setupTestWithFinalizedCheckpoint(&ethpb.Checkpoint{Epoch: 1, Root: finalizedRoot[:]})
+
+		update, err := NewLightClientFinalityUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState, signedFinalized, WithOptimisticFallback())
+		require.NoError(t, err)
+		require.Equal(t, true, HasRealFinality(update))
+		require.Equal(t, finalityBranchNumOfLeaves, len(update.FinalityBranch), "Invalid finality branch leaves")
+	})
+}
+
+func TestLightClient_NewLightClientOptimisticUpdateFromBeaconState_RootMismatch(t *testing.T) {
+	t.Run("header root", func(t *testing.T) {
+		l := newTestLc(t).setupTest()
+		header := l.state.LatestBlockHeader()
+		header.ProposerIndex++
+		require.NoError(t, l.state.SetLatestBlockHeader(header))
+
+		_, err := NewLightClientOptimisticUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState)
+		require.ErrorIs(t, err, ErrHeaderRootMismatch)
+	})
+	t.Run("execution payload header", func(t *testing.T) {
+		l := newTestLc(t).setupTest()
+		executionHeader, err := l.state.LatestExecutionPayloadHeader()
+		require.NoError(t, err)
+		pb, ok := executionHeader.Proto().(*enginev1.ExecutionPayloadHeaderCapella)
+		require.Equal(t, true, ok)
+		pb = proto.Clone(pb).(*enginev1.ExecutionPayloadHeaderCapella)
+		pb.BlockNumber++
+		tampered, err := blocks.WrappedExecutionPayloadHeaderCapella(pb, 0)
+		require.NoError(t, err)
+		require.NoError(t, l.state.SetLatestExecutionPayloadHeader(tampered))
+
+		_, err = NewLightClientOptimisticUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState)
+		require.ErrorIs(t, err, ErrHeaderRootMismatch)
+	})
+	t.Run("parent root", func(t *testing.T) {
+		l := newTestLc(t).setupTest()
+		header := l.attestedState.LatestBlockHeader()
+		header.ProposerIndex++
+		require.NoError(t, l.attestedState.SetLatestBlockHeader(header))
+
+		_, err := NewLightClientOptimisticUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState)
+		require.ErrorIs(t, err, ErrParentRootMismatch)
+	})
+}
+
+func TestLightClient_NewLightClientFinalityUpdateFromBeaconState_FinalizedRoot(t *testing.T) {
+	finalized := util.NewBeaconBlockCapella()
+	finalized.Block.Slot = 1
+	signedFinalized, err := blocks.NewSignedBeaconBlock(finalized)
+	require.NoError(t, err)
+	finalizedRoot, err := signedFinalized.Block().HashTreeRoot()
+	require.NoError(t, err)
+
+	t.Run("matching pinned root", func(t *testing.T) {
+		l := newTestLc(t).setupTestWithFinalizedCheckpoint(&ethpb.Checkpoint{Epoch: 1, Root: finalizedRoot[:]})
+		update, err := NewLightClientFinalityUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState, signedFinalized, WithFinalizedRoot(finalizedRoot))
+		require.NoError(t, err)
+		headerRoot, err := update.FinalizedHeader.HashTreeRoot()
+		require.NoError(t, err)
+		require.Equal(t, finalizedRoot, headerRoot)
+	})
+	t.Run("mismatching pinned root", func(t *testing.T) {
+		l := newTestLc(t).setupTestWithFinalizedCheckpoint(&ethpb.Checkpoint{Epoch: 1, Root: finalizedRoot[:]})
+		_, err := NewLightClientFinalityUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState, signedFinalized, WithFinalizedRoot([32]byte{'a'}))
+		require.ErrorIs(t, err, errFinalizedRootMismatch)
+	})
+	t.Run("pinned root without finalized block", func(t *testing.T) {
+		l := newTestLc(t).setupTest()
+		_, err := NewLightClientFinalityUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState, nil, WithFinalizedRoot(finalizedRoot))
+		require.ErrorIs(t, err, errFinalizedRootMismatch)
+		_, err = NewLightClientFinalityUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState, nil, WithFinalizedRoot(finalizedRoot), WithOptimisticFallback())
+		require.ErrorIs(t, err, errFinalizedRootMismatch)
+	})
+	t.Run("pinned root with genesis finalized block", func(t *testing.T) {
+		l := newTestLc(t).setupTest()
+		genesis, err := blocks.NewSignedBeaconBlock(util.NewBeaconBlockCapella())
+		require.NoError(t, err)
+		genesisRoot, err := genesis.Block().HashTreeRoot()
+		require.NoError(t, err)
+		// Without the pinned root a zeroed finalized header is used.
+		_, err = NewLightClientFinalityUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState, genesis)
+		require.NoError(t, err)
+		_, err = NewLightClientFinalityUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState, genesis, WithFinalizedRoot(genesisRoot))
+		require.ErrorIs(t, err, errFinalizedRootMismatch)
+	})
+	t.Run("pinned root not finalized by the attested state", func(t *testing.T) {
+		l := newTestLc(t).setupTestWithFinalizedCheckpoint(&ethpb.Checkpoint{Epoch: 1, Root: bytesutil.PadTo([]byte{'a'}, 32)})
+		// Without the pinned root the attested checkpoint is used.
+		_, err := NewLightClientFinalityUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState, signedFinalized)
+		require.ErrorContains(t, "not equal to attested finalized checkpoint root", err)
+		_, err = NewLightClientFinalityUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState, signedFinalized, WithFinalizedRoot(finalizedRoot))
+		require.ErrorIs(t, err, errFinalizedRootMismatch)
+	})
+}
+
+func TestLightClient_NewLightClientUpdateFromFinalityUpdate(t *testing.T) {
+	l := newTestLc(t).setupTest()
+	update, err := NewLightClientFinalityUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState, nil)
+	require.NoError(t, err)
+	finalityUpdate := CreateLightClientFinalityUpdate(update)
+
+	t.Run("correct branch", func(t *testing.T) {
+		converted, err := NewLightClientUpdateFromFinalityUpdate(finalityUpdate)
+		require.NoError(t, err)
+		require.DeepEqual(t, finalityUpdate.FinalityBranch, converted.FinalityBranch)
+		require.DeepEqual(t, finalityUpdate.FinalizedHeader, converted.FinalizedHeader)
+		require.Equal(t, finalityUpdate.SignatureSlot, converted.SignatureSlot)
+	})
+	t.Run("short branch", func(t *testing.T) {
+		short := proto.Clone(finalityUpdate).(*ethpbv2.LightClientFinalityUpdate)
+		short.FinalityBranch = short.FinalityBranch[:finalityBranchNumOfLeaves-1]
+		_, err := NewLightClientUpdateFromFinalityUpdate(short)
+		require.ErrorIs(t, err, errInvalidFinalityBranch)
+	})
+	t.Run("wrong leaf size", func(t *testing.T) {
+		wrongLeaf := proto.Clone(finalityUpdate).(*ethpbv2.LightClientFinalityUpdate)
+		wrongLeaf.FinalityBranch[2] = make([]byte, 31)
+		_, err := NewLightClientUpdateFromFinalityUpdate(wrongLeaf)
+		require.ErrorIs(t, err, errInvalidFinalityBranch)
+	})
+}
+
+func TestLightClient_verifySignatureSlot(t *testing.T) {
+	require.ErrorIs(t, verifySignatureSlot(10, 10), ErrInvalidSignatureSlot)
+	require.ErrorIs(t, verifySignatureSlot(9, 10), ErrInvalidSignatureSlot)
+	require.NoError(t, verifySignatureSlot(11, 10))
+}
+
+func TestLightClient_NewLightClientOptimisticUpdateFromBeaconState_SignatureSlot(t *testing.T) {
+	t.Run("signature after attested", func(t *testing.T) {
+		l := newTestLc(t).setupTest()
+		update, err := NewLightClientOptimisticUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState)
+		require.NoError(t, err)
+		require.Equal(t, true, update.SignatureSlot > update.AttestedHeader.Slot)
+	})
+	for name, offset := range map[string]primitives.Slot{"same slot": 0, "attested after signature": 1} {
+		t.Run(name, func(t *testing.T) {
+			l := newTestLc(t).setupTest()
+			attestedSlot := l.block.Block().Slot() + offset
+			require.NoError(t, l.attestedState.SetSlot(attestedSlot))
+			header := l.attestedState.LatestBlockHeader()
+			header.Slot = attestedSlot
+			require.NoError(t, l.attestedState.SetLatestBlockHeader(header))
+
+			_, err := NewLightClientOptimisticUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState)
+			require.ErrorIs(t, err, ErrInvalidSignatureSlot)
+		})
+	}
+}
+
+func TestLightClient_FinalityUpdateForFinalizedRoot(t *testing.T) {
+	service, tr := minimalTestService(t)
+	ctx, beaconDB := tr.ctx, tr.db
+
+	finalized := util.NewBeaconBlockCapella()
+	finalized.Block.Slot = 1
+	signedFinalized, err := blocks.NewSignedBeaconBlock(finalized)
+	require.NoError(t, err)
+	finalizedRoot, err := signedFinalized.Block().HashTreeRoot()
+	require.NoError(t, err)
+
+	l := newTestLc(t).setupTestWithFinalizedCheckpoint(&ethpb.Checkpoint{Epoch: 1, Root: finalizedRoot[:]})
+	attestedRoot, err := l.attestedBlock.Block().HashTreeRoot()
+	require.NoError(t, err)
+	blockRoot, err := l.block.Block().HashTreeRoot()
+	require.NoError(t, err)
+
+	require.NoError(t, beaconDB.SaveBlock(ctx, signedFinalized))
+	require.NoError(t, beaconDB.SaveBlock(ctx, l.attestedBlock))
+	require.NoError(t, beaconDB.SaveBlock(ctx, l.block))
+	require.NoError(t, beaconDB.SaveState(ctx, l.attestedState, attestedRoot))
+	require.NoError(t, beaconDB.SaveState(ctx, l.state, blockRoot))
+	service.head = &head{root: blockRoot, block: l.block, state: l.state, slot: l.block.Block().Slot()}
+
+	st, root, err := prepareForkchoiceState(ctx, 1, finalizedRoot, [32]byte{}, [32]byte{}, &ethpb.Checkpoint{}, &ethpb.Checkpoint{})
+	require.NoError(t, err)
+	require.NoError(t, tr.fcs.InsertNode(ctx, st, root))
+
+	t.Run("canonical finalized root", func(t *testing.T) {
+		update, err := service.FinalityUpdateForFinalizedRoot(ctx, finalizedRoot)
+		require.NoError(t, err)
+		require.Equal(t, l.block.Block().Slot(), update.SignatureSlot)
+		require.Equal(t, l.attestedHeader.Slot, update.AttestedHeader.Slot)
+		require.Equal(t, signedFinalized.Block().Slot(), update.FinalizedHeader.Slot)
+		finalizedHeaderRoot, err := update.FinalizedHeader.HashTreeRoot()
+		require.NoError(t, err)
+		require.Equal(t, finalizedRoot, finalizedHeaderRoot)
+		require.Equal(t, finalityBranchNumOfLeaves, len(update.FinalityBranch))
+	})
+	t.Run("non canonical finalized root", func(t *testing.T) {
+		_, err := service.FinalityUpdateForFinalizedRoot(ctx, [32]byte{'a'})
+		require.ErrorIs(t, err, errFinalizedRootNotCanonical)
+	})
+}
+
+func TestLightClient_FinalityUpdateForFinalizedRoot_FinalizationMovedPast(t *testing.T) {
+	service, tr := minimalTestService(t)
+	ctx, beaconDB := tr.ctx, tr.db
+
+	finalized := util.NewBeaconBlockCapella()
+	finalized.Block.Slot = 1
+	signedFinalized, err := blocks.NewSignedBeaconBlock(finalized)
+	require.NoError(t, err)
+	finalizedRoot, err := signedFinalized.Block().HashTreeRoot()
+	require.NoError(t, err)
+
+	// The attested state finalized a descendant of the requested root.
+	later := util.NewBeaconBlockCapella()
+	later.Block.Slot = params.BeaconConfig().SlotsPerEpoch
+	later.Block.ParentRoot = finalizedRoot[:]
+	signedLater, err := blocks.NewSignedBeaconBlock(later)
+	require.NoError(t, err)
+	laterRoot, err := signedLater.Block().HashTreeRoot()
+	require.NoError(t, err)
+
+	l := newTestLc(t).setupTestWithFinalizedCheckpoint(&ethpb.Checkpoint{Epoch: 1, Root: laterRoot[:]})
+	attestedRoot, err := l.attestedBlock.Block().HashTreeRoot()
+	require.NoError(t, err)
+	blockRoot, err := l.block.Block().HashTreeRoot()
+	require.NoError(t, err)
+
+	require.NoError(t, beaconDB.SaveBlock(ctx, signedFinalized))
+	require.NoError(t, beaconDB.SaveBlock(ctx, signedLater))
+	require.NoError(t, beaconDB.SaveBlock(ctx, l.attestedBlock))
+	require.NoError(t, beaconDB.SaveBlock(ctx, l.block))
+	require.NoError(t, beaconDB.SaveState(ctx, l.attestedState, attestedRoot))
+	require.NoError(t, beaconDB.SaveState(ctx, l.state, blockRoot))
+	service.head = &head{root: blockRoot, block: l.block, state: l.state, slot: l.block.Block().Slot()}
+
+	st, root, err := prepareForkchoiceState(ctx, 1, finalizedRoot, [32]byte{}, [32]byte{}, &ethpb.Checkpoint{}, &ethpb.Checkpoint{})
+	require.NoError(t, err)
+	require.NoError(t, tr.fcs.InsertNode(ctx, st, root))
+
+	_, err = service.FinalityUpdateForFinalizedRoot(ctx, finalizedRoot)
+	require.ErrorIs(t, err, errNoFinalityUpdateForRoot)
+	require.ErrorContains(t, "finalized checkpoint moved to epoch 1", err)
+}
+
+func TestService_sendLightClientFinalityUpdate(t *testing.T) {
+	notifier := &blockchainTesting.MockStateNotifier{RecordEvents: true}
+	service, tr := minimalTestService(t, WithStateNotifier(notifier))
+	ctx, beaconDB := tr.ctx, tr.db
+
+	finalized := util.NewBeaconBlockCapella()
+	finalized.Block.Slot = 1
+	signedFinalized, err := blocks.NewSignedBeaconBlock(finalized)
+	require.NoError(t, err)
+	finalizedRoot, err := signedFinalized.Block().HashTreeRoot()
+	require.NoError(t, err)
+
+	l := newTestLc(t).setupTestWithFinalizedCheckpoint(&ethpb.Checkpoint{Epoch: 1, Root: finalizedRoot[:]})
+	attestedRoot, err := l.attestedBlock.Block().HashTreeRoot()
+	require.NoError(t, err)
+
+	t.Run("attested state not available", func(t *testing.T) {
+		require.NoError(t, service.sendLightClientFinalityUpdate(ctx, l.block, l.state))
+		require.Equal(t, 0, len(notifier.ReceivedEvents()))
+	})
+
+	require.NoError(t, beaconDB.SaveBlock(ctx, l.attestedBlock))
+	require.NoError(t, beaconDB.SaveState(ctx, l.attestedState, attestedRoot))
+
+	t.Run("finalized block not available", func(t *testing.T) {
+		require.NoError(t, service.sendLightClientFinalityUpdate(ctx, l.block, l.state))
+		require.Equal(t, 0, len(notifier.ReceivedEvents()))
+	})
+
+	require.NoError(t, beaconDB.SaveBlock(ctx, signedFinalized))
+
+	t.Run("not enough sync committee participants", func(t *testing.T) {
+		b := util.NewBeaconBlockCapella()
+		b.Block.Slot = l.block.Block().Slot()
+		b.Block.ParentRoot = attestedRoot[:]
+		signed, err := blocks.NewSignedBeaconBlock(b)
+		require.NoError(t, err)
+		require.NoError(t, service.sendLightClientFinalityUpdate(ctx, signed, l.state))
+		require.Equal(t, 0, len(notifier.ReceivedEvents()))
+	})
+	t.Run("published", func(t *testing.T) {
+		require.NoError(t, service.sendLightClientFinalityUpdate(ctx, l.block, l.state))
+		events := notifier.ReceivedEvents()
+		require.Equal(t, 1, len(events))
+		require.Equal(t, statefeed.LightClientFinalityUpdate, int(events[0].Type))
+		update, ok := events[0].Data.(*ethpbv2.LightClientFinalityUpdate)
+		require.Equal(t, true, ok)
+		expected, err := NewLightClientFinalityUpdateFromBeaconState(ctx, l.state, l.block, l.attestedState, signedFinalized)
+		require.NoError(t, err)
+		require.DeepEqual(t, CreateLightClientFinalityUpdate(expected), update)
+		finalizedHeaderRoot, err := update.FinalizedHeader.HashTreeRoot()
+		require.NoError(t, err)
+		require.Equal(t, finalizedRoot, finalizedHeaderRoot)
+	})
+}
+
+func TestLightClient_VerifyStoreCommitteeContinuity(t *testing.T) {
+	periodSlots := primitives.Slot(params.BeaconConfig().EpochsPerSyncCommitteePeriod) * params.BeaconConfig().SlotsPerEpoch
+	current := &ethpbv2.SyncCommittee{Pubkeys: [][]byte{{'a'}}, AggregatePubkey: []byte{'a'}}
+	next := &ethpbv2.SyncCommittee{Pubkeys: [][]byte{{'b'}}, AggregatePubkey: []byte{'b'}}
+	other := &ethpbv2.SyncCommittee{Pubkeys: [][]byte{{'c'}}, AggregatePubkey: []byte{'c'}}
+	store := &LightClientStore{
+		FinalizedHeader:      &v1.BeaconBlockHeader{Slot: 1},
+		CurrentSyncCommittee: current,
+		NextSyncCommittee:    next,
+	}
+
+	t.Run("matching rotation", func(t *testing.T) {
+		update := &ethpbv2.LightClientUpdate{AttestedHeader: &v1.BeaconBlockHeader{Slot: 2}, NextSyncCommittee: next}
+		require.NoError(t, VerifyStoreCommitteeContinuity(store, update, current))
+		update = &ethpbv2.LightClientUpdate{AttestedHeader: &v1.BeaconBlockHeader{Slot: periodSlots + 1}, NextSyncCommittee: other}
+		require.NoError(t, VerifyStoreCommitteeContinuity(store, update, next))
+	})
+	t.Run("mismatched next committee", func(t *testing.T) {
+		update := &ethpbv2.LightClientUpdate{AttestedHeader: &v1.BeaconBlockHeader{Slot: 2}, NextSyncCommittee: other}
+		require.ErrorIs(t, VerifyStoreCommitteeContinuity(store, update, current), errSyncCommitteeMismatch)
+	})
+	t.Run("mismatched rotation", func(t *testing.T) {
+		update := &ethpbv2.LightClientUpdate{AttestedHeader: &v1.BeaconBlockHeader{Slot: periodSlots + 1}, NextSyncCommittee: next}
+		require.ErrorIs(t, VerifyStoreCommitteeContinuity(store, update, other), errSyncCommitteeMismatch)
+		require.ErrorIs(t, VerifyStoreCommitteeContinuity(store, update, nil), errSyncCommitteeMismatch)
+	})
+	t.Run("unknown next committee", func(t *testing.T) {
+		s := &LightClientStore{FinalizedHeader: &v1.BeaconBlockHeader{Slot: 1}, CurrentSyncCommittee: current}
+		update := &ethpbv2.LightClientUpdate{AttestedHeader: &v1.BeaconBlockHeader{Slot: periodSlots + 1}, NextSyncCommittee: other}
+		require.ErrorIs(t, VerifyStoreCommitteeContinuity(s, update, next), errSyncCommitteeMismatch)
+	})
+	t.Run("skipped period", func(t *testing.T) {
+		update := &ethpbv2.LightClientUpdate{AttestedHeader: &v1.BeaconBlockHeader{Slot: 2*periodSlots + 1}, NextSyncCommittee: other}
+		require.ErrorIs(t, VerifyStoreCommitteeContinuity(store, update, next), errSyncCommitteeMismatch)
+	})
+}
+
+func TestLightClient_IsBetterUpdate(t *testing.T) {
+	bits := func(n uint64) bitfield.Bitvector512 {
+		b := bitfield.NewBitvector512()
+		for i := uint64(0); i < n; i++ {
+			b.SetBitAt(i, true)
+		}
+		return b
+	}
+	update := func(participants uint64, attestedSlot primitives.Slot, finalityBranch [][]byte) *ethpbv2.LightClientUpdate {
+		return &ethpbv2.LightClientUpdate{
+			AttestedHeader:  &v1.BeaconBlockHeader{Slot: attestedSlot},
+			FinalizedHeader: &v1.BeaconBlockHeader{Slot: 1},
+			FinalityBranch:  finalityBranch,
+			SyncAggregate:   &v1.SyncAggregate{SyncCommitteeBits: bits(participants)},
+			SignatureSlot:   attestedSlot + 1,
+		}
+	}
+	finality := [][]byte{{'a'}}
+
+	require.Equal(t, true, IsBetterUpdate(update(400, 10, nil), update(300, 10, finality)), "supermajority")
+	require.Equal(t, true, IsBetterUpdate(update(200, 10, nil), update(100, 10, nil)), "participation without supermajority")
+	require.Equal(t, true, IsBetterUpdate(update(400, 10, finality), update(500, 10, nil)), "finality")
+	require.Equal(t, true, IsBetterUpdate(update(500, 10, finality), update(400, 10, finality)), "participation beyond supermajority")
+	require.Equal(t, true, IsBetterUpdate(update(400, 10, finality), update(400, 11, finality)), "older data")
+	require.Equal(t, false, IsBetterUpdate(update(400, 10, finality), update(400, 10, finality)), "same update")
+}
+
+func TestLightClient_MaybeUpdateBestForPeriod(t *testing.T) {
+	service, tr := minimalTestService(t)
+	ctx, beaconDB := tr.ctx, tr.db
+
+	l := newTestLc(t).setupTest()
+	attestedRoot, err := l.attestedBlock.Block().HashTreeRoot()
+	require.NoError(t, err)
+	blockRoot, err := l.block.Block().HashTreeRoot()
+	require.NoError(t, err)
+	require.NoError(t, beaconDB.SaveBlock(ctx, l.attestedBlock))
+	require.NoError(t, beaconDB.SaveBlock(ctx, l.block))
+	require.NoError(t, beaconDB.SaveState(ctx, l.attestedState, attestedRoot))
+	require.NoError(t, beaconDB.SaveState(ctx, l.state, blockRoot))
+	service.head = &head{root: blockRoot, block: l.block, state: l.state, slot: l.block.Block().Slot()}
+	period := syncCommitteePeriodAtSlot(l.attestedHeader.Slot)
+
+	t.Run("head not in period", func(t *testing.T) {
+		improved, err := service.MaybeUpdateBestForPeriod(ctx, period+1)
+		require.NoError(t, err)
+		require.Equal(t, false, improved)
+		require.Equal(t, 0, len(service.lcBestUpdates.updates))
+	})
+	t.Run("no cached update", func(t *testing.T) {
+		improved, err := service.MaybeUpdateBestForPeriod(ctx, period)
+		require.NoError(t, err)
+		require.Equal(t, true, improved)
+		require.Equal(t, l.attestedHeader.Slot, service.lcBestUpdates.updates[period].AttestedHeader.Slot)
+		require.NotNil(t, service.lcBestUpdates.updates[period].NextSyncCommittee)
+		require.Equal(t, true, isSyncCommitteeUpdate(service.lcBestUpdates.updates[period]))
+	})
+	t.Run("candidate is the cached update", func(t *testing.T) {
+		improved, err := service.MaybeUpdateBestForPeriod(ctx, period)
+		require.NoError(t, err)
+		require.Equal(t, false, improved)
+	})
+	t.Run("candidate is better", func(t *testing.T) {
+		worse := proto.Clone(service.lcBestUpdates.updates[period]).(*ethpbv2.LightClientUpdate)
+		worse.SyncAggregate.SyncCommitteeBits = bitfield.NewBitvector512()
+		service.lcBestUpdates.updates[period] = worse
+		improved, err := service.MaybeUpdateBestForPeriod(ctx, period)
+		require.NoError(t, err)
+		require.Equal(t, true, improved)
+		require.NotEqual(t, worse, service.lcBestUpdates.updates[period])
+	})
+	t.Run("cached update with next sync committee and equal participation", func(t *testing.T) {
+		newer := proto.Clone(service.lcBestUpdates.updates[period]).(*ethpbv2.LightClientUpdate)
+		newer.AttestedHeader.Slot++
+		newer.SignatureSlot++
+		require.Equal(t, true, isSyncCommitteeUpdate(newer))
+		service.lcBestUpdates.updates[period] = newer
+		// Both updates carry the next sync committee, so the older candidate wins the tiebreak.
+		improved, err := service.MaybeUpdateBestForPeriod(ctx, period)
+		require.NoError(t, err)
+		require.Equal(t, true, improved)
+		best := service.lcBestUpdates.updates[period]
+		require.Equal(t, l.attestedHeader.Slot, best.AttestedHeader.Slot)
+		require.DeepEqual(t, newer.NextSyncCommittee, best.NextSyncCommittee)
+		require.DeepEqual(t, newer.NextSyncCommitteeBranch, best.NextSyncCommitteeBranch)
+	})
+	t.Run("candidate is worse", func(t *testing.T) {
+		better := proto.Clone(service.lcBestUpdates.updates[period]).(*ethpbv2.LightClientUpdate)
+		for i := uint64(0); i < better.SyncAggregate.SyncCommitteeBits.Len(); i++ {
+			better.SyncAggregate.SyncCommitteeBits.SetBitAt(i, true)
+		}
+		service.lcBestUpdates.updates[period] = better
+		improved, err := service.MaybeUpdateBestForPeriod(ctx, period)
+		require.NoError(t, err)
+		require.Equal(t, false, improved)
+		require.Equal(t, better, service.lcBestUpdates.updates[period])
+	})
+}
+
+func TestLightClient_ValidateUpdates(t *testing.T) {
+	service, _ := minimalTestService(t)
+
+	finalized := util.NewBeaconBlockCapella()
+	finalized.Block.Slot = 1
+	signedFinalized, err := blocks.NewSignedBeaconBlock(finalized)
+	require.NoError(t, err)
+	finalizedRoot, err := signedFinalized.Block().HashTreeRoot()
+	require.NoError(t, err)
+	l := newTestLc(t).setupTestWithFinalizedCheckpoint(&ethpb.Checkpoint{Epoch: 1, Root: finalizedRoot[:]})
+
+	valid, err := NewLightClientFinalityUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState, signedFinalized)
+	require.NoError(t, err)
+	optimistic, err := NewLightClientOptimisticUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState)
+	require.NoError(t, err)
+	badSignatureSlot := proto.Clone(valid).(*ethpbv2.LightClientUpdate)
+	badSignatureSlot.SignatureSlot = badSignatureSlot.AttestedHeader.Slot
+	badBranch := proto.Clone(valid).(*ethpbv2.LightClientUpdate)
+	badBranch.FinalityBranch[1] = []byte{'a'}
+	noParticipants := proto.Clone(valid).(*ethpbv2.LightClientUpdate)
+	noParticipants.SyncAggregate.SyncCommitteeBits = bitfield.NewBitvector512()
+
+	errs, err := service.ValidateUpdates(l.ctx, []*ethpbv2.LightClientUpdate{valid, badSignatureSlot, optimistic, badBranch, nil, noParticipants})
+	require.NoError(t, err)
+	require.Equal(t, 6, len(errs))
+	require.NoError(t, errs[0])
+	require.ErrorIs(t, errs[1], ErrInvalidSignatureSlot)
+	require.NoError(t, errs[2])
+	require.ErrorContains(t, "invalid finality branch", errs[3])
+	require.ErrorContains(t, "nil light client update", errs[4])
+	require.ErrorContains(t, "invalid sync committee bits count", errs[5])
+
+	ctx, cancel := context.WithCancel(l.ctx)
+	cancel()
+	_, err = service.ValidateUpdates(ctx, []*ethpbv2.LightClientUpdate{valid})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestLightClient_CreateFinalityUpdatesConcurrent(t *testing.T) {
+	finalized := util.NewBeaconBlockCapella()
+	finalized.Block.Slot = 1
+	signedFinalized, err := blocks.NewSignedBeaconBlock(finalized)
+	require.NoError(t, err)
+	finalizedRoot, err := signedFinalized.Block().HashTreeRoot()
+	require.NoError(t, err)
+	withFinality := newTestLc(t).setupTestWithFinalizedCheckpoint(&ethpb.Checkpoint{Epoch: 1, Root: finalizedRoot[:]})
+	l := newTestLc(t).setupTest()
+
+	inputs := []UpdateInput{
+		{State: withFinality.state, Block: withFinality.block, AttestedState: withFinality.attestedState, FinalizedBlock: signedFinalized},
+		{State: l.state, Block: l.block, AttestedState: l.attestedState},
+		{State: l.state, Block: l.block, AttestedState: l.attestedState, Opts: []LightClientUpdateOption{WithOptimisticFallback()}},
+		// The attested block has no sync aggregate participants.
+		{State: l.state, Block: l.attestedBlock, AttestedState: l.attestedState},
+		{State: withFinality.state, Block: withFinality.block, AttestedState: withFinality.attestedState, FinalizedBlock: signedFinalized, Opts: []LightClientUpdateOption{WithFinalizedRoot(finalizedRoot)}},
+	}
+	wantUpdates := make([]*ethpbv2.LightClientUpdate, len(inputs))
+	wantErrs := make([]error, len(inputs))
+	for i, input := range inputs {
+		wantUpdates[i], wantErrs[i] = NewLightClientFinalityUpdateFromBeaconState(l.ctx, input.State, input.Block, input.AttestedState, input.FinalizedBlock, input.Opts...)
+	}
+	require.ErrorContains(t, "invalid sync committee bits count", wantErrs[3])
+
+	for _, workers := range []int{0, 1, 3, len(inputs) + 1} {
+		updates, errs, err := CreateFinalityUpdatesConcurrent(l.ctx, inputs, workers)
+		require.NoError(t, err)
+		require.Equal(t, len(inputs), len(updates))
+		require.Equal(t, len(inputs), len(errs))
+		for i := range inputs {
+			require.DeepEqual(t, wantUpdates[i], updates[i])
+			if wantErrs[i] == nil {
+				require.NoError(t, errs[i])
+			} else {
+				require.ErrorContains(t, wantErrs[i].Error(), errs[i])
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(l.ctx)
+	cancel()
+	_, _, err = CreateFinalityUpdatesConcurrent(ctx, inputs, 2)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestLightClient_VerifyExecutionBranch(t *testing.T) {
+	execution, err := blocks.WrappedExecutionPayloadHeaderCapella(&enginev1.ExecutionPayloadHeaderCapella{
+		ParentHash:       bytesutil.PadTo([]byte{'p'}, 32),
+		FeeRecipient:     make([]byte, 20),
+		StateRoot:        bytesutil.PadTo([]byte{'s'}, 32),
+		ReceiptsRoot:     make([]byte, 32),
+		LogsBloom:        make([]byte, 256),
+		PrevRandao:       make([]byte, 32),
+		BlockNumber:      10,
+		BaseFeePerGas:    make([]byte, 32),
+		BlockHash:        bytesutil.PadTo([]byte{'h'}, 32),
+		TransactionsRoot: make([]byte, 32),
+		WithdrawalsRoot:  make([]byte, 32),
+	}, 0)
+	require.NoError(t, err)
+	executionRoot, err := execution.HashTreeRoot()
+	require.NoError(t, err)
+
+	// Build a block body of 16 field roots with the execution payload header at index 9.
+	layer := make([][32]byte, 16)
+	for i := range layer {
+		layer[i] = [32]byte{byte(i)}
+	}
+	layer[executionPayloadGeneralizedIndex-16] = executionRoot
+	var branch [][]byte
+	index := executionPayloadGeneralizedIndex - 16
+	for len(layer) > 1 {
+		sibling := layer[index^1]
+		branch = append(branch, sibling[:])
+		next := make([][32]byte, len(layer)/2)
+		for i := range next {
+			next[i] = hash.Hash(append(layer[2*i][:], layer[2*i+1][:]...))
+		}
+		layer, index = next, index/2
+	}
+	header := &v1.BeaconBlockHeader{
+		ParentRoot: make([]byte, 32),
+		StateRoot:  make([]byte, 32),
+		BodyRoot:   layer[0][:],
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		require.NoError(t, VerifyExecutionBranch(header, execution, branch))
+	})
+	t.Run("tampered execution root", func(t *testing.T) {
+		tampered, err := blocks.WrappedExecutionPayloadHeaderCapella(&enginev1.ExecutionPayloadHeaderCapella{
+			ParentHash:       bytesutil.PadTo([]byte{'p'}, 32),
+			FeeRecipient:     make([]byte, 20),
+			StateRoot:        bytesutil.PadTo([]byte{'s'}, 32),
+			ReceiptsRoot:     make([]byte, 32),
+			LogsBloom:        make([]byte, 256),
+			PrevRandao:       make([]byte, 32),
+			BlockNumber:      11,
+			BaseFeePerGas:    make([]byte, 32),
+			BlockHash:        bytesutil.PadTo([]byte{'h'}, 32),
+			TransactionsRoot: make([]byte, 32),
+			WithdrawalsRoot:  make([]byte, 32),
+		}, 0)
+		require.NoError(t, err)
+		err = VerifyExecutionBranch(header, tampered, branch)
+		require.ErrorIs(t, err, errInvalidExecutionBranch)
+		require.ErrorContains(t, "not included in the block body", err)
+	})
+	t.Run("tampered branch", func(t *testing.T) {
+		tampered := bytesutil.SafeCopy2dBytes(branch)
+		tampered[2] = bytesutil.PadTo([]byte{'x'}, 32)
+		require.ErrorIs(t, VerifyExecutionBranch(header, execution, tampered), errInvalidExecutionBranch)
+	})
+	t.Run("malformed branch", func(t *testing.T) {
+		err := VerifyExecutionBranch(header, execution, branch[:3])
+		require.ErrorIs(t, err, errInvalidExecutionBranch)
+		require.ErrorContains(t, "got 3 leaves, want 4", err)
+
+		short := bytesutil.SafeCopy2dBytes(branch)
+		short[1] = short[1][:31]
+		err = VerifyExecutionBranch(header, execution, short)
+		require.ErrorIs(t, err, errInvalidExecutionBranch)
+		require.ErrorContains(t, "leaf 1 has 31 bytes, want 32", err)
+	})
+	t.Run("nil execution", func(t *testing.T) {
+		require.ErrorContains(t, "nil execution payload header", VerifyExecutionBranch(header, nil, branch))
+		require.ErrorContains(t, "nil beacon block header", VerifyExecutionBranch(nil, execution, branch))
+	})
+}
+
+func TestLightClient_lightClientHeaderRoot(t *testing.T) {
+	header := &ethpb.BeaconBlockHeader{
+		Slot:          1,
+		ProposerIndex: 2,
+		ParentRoot:    bytesutil.PadTo([]byte{'p'}, 32),
+		StateRoot:     bytesutil.PadTo([]byte{'s'}, 32),
+		BodyRoot:      bytesutil.PadTo([]byte{'b'}, 32),
+	}
+	headerRoot, err := header.HashTreeRoot()
+	require.NoError(t, err)
+
+	t.Run("phase0", func(t *testing.T) {
+		root, err := lightClientHeaderRoot(header, nil, nil, version.Phase0)
+		require.NoError(t, err)
+		require.Equal(t, headerRoot, root)
+		root, err = lightClientHeaderRoot(header, nil, nil, version.Bellatrix)
+		require.NoError(t, err)
+		require.Equal(t, headerRoot, root)
+
+		// The root of a phase0 light client header is the root of its block.
+		signed, err := blocks.NewSignedBeaconBlock(util.NewBeaconBlock())
+		require.NoError(t, err)
+		blockRoot, err := signed.Block().HashTreeRoot()
+		require.NoError(t, err)
+		blockHeader, err := signed.Header()
+		require.NoError(t, err)
+		root, err = lightClientHeaderRoot(blockHeader.Header, nil, nil, version.Phase0)
+		require.NoError(t, err)
+		require.Equal(t, blockRoot, root)
+	})
+	t.Run("capella", func(t *testing.T) {
+		execution, err := blocks.WrappedExecutionPayloadHeaderCapella(&enginev1.ExecutionPayloadHeaderCapella{
+			ParentHash:       make([]byte, 32),
+			FeeRecipient:     make([]byte, 20),
+			StateRoot:        make([]byte, 32),
+			ReceiptsRoot:     make([]byte, 32),
+			LogsBloom:        make([]byte, 256),
+			PrevRandao:       make([]byte, 32),
+			BaseFeePerGas:    make([]byte, 32),
+			BlockHash:        make([]byte, 32),
+			TransactionsRoot: make([]byte, 32),
+			WithdrawalsRoot:  make([]byte, 32),
+		}, 0)
+		require.NoError(t, err)
+		executionRoot, err := execution.HashTreeRoot()
+		require.NoError(t, err)
+		branch := [][]byte{
+			bytesutil.PadTo([]byte{1}, 32),
+			bytesutil.PadTo([]byte{2}, 32),
+			bytesutil.PadTo([]byte{3}, 32),
+			bytesutil.PadTo([]byte{4}, 32),
+		}
+
+		root, err := lightClientHeaderRoot(header, execution, branch, version.Capella)
+		require.NoError(t, err)
+		concat := func(a, b []byte) []byte {
+			return append(append(make([]byte, 0, 64), a...), b...)
+		}
+		branchLeft := hash.Hash(concat(branch[0], branch[1]))
+		branchRight := hash.Hash(concat(branch[2], branch[3]))
+		branchRoot := hash.Hash(concat(branchLeft[:], branchRight[:]))
+		left := hash.Hash(concat(headerRoot[:], executionRoot[:]))
+		right := hash.Hash(concat(branchRoot[:], make([]byte, 32)))
+		require.Equal(t, hash.Hash(concat(left[:], right[:])), root)
+		require.NotEqual(t, headerRoot, root)
+
+		_, err = lightClientHeaderRoot(header, nil, branch, version.Capella)
+		require.ErrorContains(t, "nil execution payload header", err)
+		_, err = lightClientHeaderRoot(header, execution, branch[:3], version.Capella)
+		require.ErrorIs(t, err, errInvalidExecutionBranch)
+	})
+}
+
+func TestLightClient_executionBranchFromBody(t *testing.T) {
+	attestation := util.HydrateAttestation(&ethpb.Attestation{AggregationBits: bitfield.Bitlist{0b101}})
+	change := &ethpb.SignedBLSToExecutionChange{
+		Message: &ethpb.BLSToExecutionChange{
+			ValidatorIndex:     3,
+			FromBlsPubkey:      bytesutil.PadTo([]byte{'k'}, fieldparams.BLSPubkeyLength),
+			ToExecutionAddress: bytesutil.PadTo([]byte{'a'}, fieldparams.FeeRecipientLength),
+		},
+		Signature: make([]byte, fieldparams.BLSSignatureLength),
+	}
+	verify := func(t *testing.T, signed interfaces.ReadOnlySignedBeaconBlock) {
+		branch, err := executionBranchFromBody(signed.Block().Body(), signed.Version())
+		require.NoError(t, err)
+		header, err := signed.Header()
+		require.NoError(t, err)
+		execution, err := signed.Block().Body().Execution()
+		require.NoError(t, err)
+		require.NoError(t, VerifyExecutionBranch(migration.V1Alpha1SignedHeaderToV1(header).Message, execution, branch))
+	}
+
+	t.Run("capella", func(t *testing.T) {
+		b := util.NewBeaconBlockCapella()
+		b.Block.Body.Graffiti = bytesutil.PadTo([]byte{'g'}, 32)
+		b.Block.Body.Attestations = []*ethpb.Attestation{attestation}
+		b.Block.Body.BlsToExecutionChanges = []*ethpb.SignedBLSToExecutionChange{change}
+		signed, err := blocks.NewSignedBeaconBlock(b)
+		require.NoError(t, err)
+		verify(t, signed)
+	})
+	t.Run("blinded capella", func(t *testing.T) {
+		b := util.NewBlindedBeaconBlockCapella()
+		b.Block.Body.Attestations = []*ethpb.Attestation{attestation}
+		signed, err := blocks.NewSignedBeaconBlock(b)
+		require.NoError(t, err)
+		verify(t, signed)
+	})
+	t.Run("deneb", func(t *testing.T) {
+		b := util.NewBeaconBlockDeneb()
+		b.Block.Body.Attestations = []*ethpb.Attestation{attestation}
+		b.Block.Body.BlsToExecutionChanges = []*ethpb.SignedBLSToExecutionChange{change}
+		b.Block.Body.BlobKzgCommitments = [][]byte{
+			bytesutil.PadTo([]byte{'c'}, 48),
+			bytesutil.PadTo([]byte{'d'}, 48),
+		}
+		signed, err := blocks.NewSignedBeaconBlock(b)
+		require.NoError(t, err)
+		verify(t, signed)
+	})
+	t.Run("before capella", func(t *testing.T) {
+		signed, err := blocks.NewSignedBeaconBlock(util.NewBeaconBlockBellatrix())
+		require.NoError(t, err)
+		_, err = executionBranchFromBody(signed.Block().Body(), signed.Version())
+		require.ErrorContains(t, "no execution branch for block body of version bellatrix", err)
+	})
+}
+
+func TestLightClient_LatestOptimisticUpdate(t *testing.T) {
+	s, _ := minimalTestService(t)
+	_, err := s.LatestOptimisticUpdate(context.Background())
+	require.ErrorIs(t, err, errNoLightClientOptimisticUpdate)
+
+	update := func(attestedSlot, signatureSlot primitives.Slot) *ethpbv2.LightClientOptimisticUpdate {
+		return &ethpbv2.LightClientOptimisticUpdate{
+			AttestedHeader: &v1.BeaconBlockHeader{Slot: attestedSlot},
+			SignatureSlot:  signatureSlot,
+		}
+	}
+	first := update(10, 11)
+	require.Equal(t, true, s.CacheLightClientOptimisticUpdate(first))
+	// Modifying the produced update does not affect the cache.
+	first.SignatureSlot = 100
+	latest, err := s.LatestOptimisticUpdate(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, primitives.Slot(11), latest.SignatureSlot)
+
+	// An update for the same attested slot does not replace the cache.
+	require.Equal(t, false, s.CacheLightClientOptimisticUpdate(update(10, 12)))
+	latest, err = s.LatestOptimisticUpdate(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, primitives.Slot(11), latest.SignatureSlot)
+
+	// An update for a newer attested slot replaces it.
+	require.Equal(t, true, s.CacheLightClientOptimisticUpdate(update(11, 12)))
+	latest, err = s.LatestOptimisticUpdate(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, primitives.Slot(11), latest.AttestedHeader.Slot)
+	require.Equal(t, primitives.Slot(12), latest.SignatureSlot)
+
+	// The returned update is a copy.
+	latest.SignatureSlot = 100
+	latest, err = s.LatestOptimisticUpdate(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, primitives.Slot(12), latest.SignatureSlot)
+}
+
+func TestLightClient_LatestOptimisticUpdate_Delayed(t *testing.T) {
+	update := func(attestedSlot primitives.Slot) *ethpbv2.LightClientOptimisticUpdate {
+		return &ethpbv2.LightClientOptimisticUpdate{
+			AttestedHeader: &v1.BeaconBlockHeader{Slot: attestedSlot},
+			SignatureSlot:  attestedSlot + 1,
+		}
+	}
+	// setCurrentSlot moves the genesis time so that the given slot has just started.
+	setCurrentSlot := func(s *Service, slot primitives.Slot) {
+		s.genesisTime = time.Now().Add(-time.Duration(uint64(slot)*params.BeaconConfig().SecondsPerSlot) * time.Second)
+	}
+
+	t.Run("withholds the current slot update", func(t *testing.T) {
+		s, _ := minimalTestService(t, WithDelayedOptimisticUpdates())
+		setCurrentSlot(s, 11)
+
+		require.Equal(t, true, s.CacheLightClientOptimisticUpdate(update(10)))
+		latest, err := s.LatestOptimisticUpdate(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, primitives.Slot(10), latest.AttestedHeader.Slot)
+
+		// The update attested in the current slot is withheld, the previous one is served.
+		require.Equal(t, true, s.CacheLightClientOptimisticUpdate(update(11)))
+		latest, err = s.LatestOptimisticUpdate(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, primitives.Slot(10), latest.AttestedHeader.Slot)
+
+		// It is served once its slot is in the past.
+		setCurrentSlot(s, 12)
+		latest, err = s.LatestOptimisticUpdate(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, primitives.Slot(11), latest.AttestedHeader.Slot)
+	})
+	t.Run("no previous update", func(t *testing.T) {
+		s, _ := minimalTestService(t, WithDelayedOptimisticUpdates())
+		setCurrentSlot(s, 11)
+
+		require.Equal(t, true, s.CacheLightClientOptimisticUpdate(update(11)))
+		_, err := s.LatestOptimisticUpdate(context.Background())
+		require.ErrorIs(t, err, errNoLightClientOptimisticUpdate)
+
+		setCurrentSlot(s, 12)
+		latest, err := s.LatestOptimisticUpdate(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, primitives.Slot(11), latest.AttestedHeader.Slot)
+	})
+	t.Run("not delayed", func(t *testing.T) {
+		s, _ := minimalTestService(t)
+		setCurrentSlot(s, 11)
+
+		require.Equal(t, true, s.CacheLightClientOptimisticUpdate(update(10)))
+		require.Equal(t, true, s.CacheLightClientOptimisticUpdate(update(11)))
+		latest, err := s.LatestOptimisticUpdate(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, primitives.Slot(11), latest.AttestedHeader.Slot)
+	})
+}
+
+func TestLightClient_HasRealFinality(t *testing.T) {
+	l := newTestLc(t).setupTest()
+	placeholder, err := NewLightClientFinalityUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState, nil)
+	require.NoError(t, err)
+	require.Equal(t, false, HasRealFinality(placeholder))
+	require.Equal(t, false, HasRealFinality(nil))
+
+	finalized := util.NewBeaconBlockCapella()
+	finalized.Block.Slot = 1
+	signedFinalized, err := blocks.NewSignedBeaconBlock(finalized)
+	require.NoError(t, err)
+	finalizedRoot, err := signedFinalized.Block().HashTreeRoot()
+	require.NoError(t, err)
+	l = newTestLc(t).setupTestWithFinalizedCheckpoint(&ethpb.Checkpoint{Epoch: 1, Root: finalizedRoot[:]})
+	update, err := NewLightClientFinalityUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState, signedFinalized)
+	require.NoError(t, err)
+	require.Equal(t, true, HasRealFinality(update))
+}
+
+func TestLightClient_SyncCommitteeParticipation(t *testing.T) {
+	update := func(bits bitfield.Bitvector512) *ethpbv2.LightClientUpdate {
+		return &ethpbv2.LightClientUpdate{SyncAggregate: &v1.SyncAggregate{SyncCommitteeBits: bits}}
+	}
+	full := bitfield.NewBitvector512()
+	for i := uint64(0); i < full.Len(); i++ {
+		full.SetBitAt(i, true)
+	}
+	minimal := bitfield.NewBitvector512()
+	for i := uint64(0); i < params.BeaconConfig().MinSyncCommitteeParticipants; i++ {
+		minimal.SetBitAt(i, true)
+	}
+
+	require.Equal(t, uint64(512), SyncCommitteeParticipation(update(full)))
+	require.Equal(t, params.BeaconConfig().MinSyncCommitteeParticipants, SyncCommitteeParticipation(update(minimal)))
+	require.Equal(t, uint64(0), SyncCommitteeParticipation(update(bitfield.NewBitvector512())))
+	require.Equal(t, uint64(0), SyncCommitteeParticipation(&ethpbv2.LightClientUpdate{}))
+}
+
+func TestLightClient_NewLightClientUpdateFromBeaconState(t *testing.T) {
+	finalized := util.NewBeaconBlockCapella()
+	finalized.Block.Slot = 1
+	signedFinalized, err := blocks.NewSignedBeaconBlock(finalized)
+	require.NoError(t, err)
+	finalizedRoot, err := signedFinalized.Block().HashTreeRoot()
+	require.NoError(t, err)
+	l := newTestLc(t).setupTestWithFinalizedCheckpoint(&ethpb.Checkpoint{Epoch: 1, Root: finalizedRoot[:]})
+
+	update, err := NewLightClientUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState, signedFinalized)
+	require.NoError(t, err)
+	require.Equal(t, true, isFinalityUpdate(update))
+	require.Equal(t, true, isSyncCommitteeUpdate(update))
+	nextSyncCommittee, err := l.attestedState.NextSyncCommittee()
+	require.NoError(t, err)
+	require.DeepSSZEqual(t, nextSyncCommittee.Pubkeys, update.NextSyncCommittee.Pubkeys)
+	require.NoError(t, validateLightClientUpdate(update))
+
+	badBranch := proto.Clone(update).(*ethpbv2.LightClientUpdate)
+	badBranch.NextSyncCommitteeBranch[0] = bytesutil.PadTo([]byte{'a'}, 32)
+	require.ErrorContains(t, "invalid next sync committee branch", validateLightClientUpdate(badBranch))
+}
+
+func TestLightClient_NewLightClientOptimisticUpdateFromBeaconState_SyncAggregateSignature(t *testing.T) {
+	l := newTestLc(t).setupTest()
+	_, err := NewLightClientOptimisticUpdateFromBeaconState(l.ctx, l.state, l.block, l.attestedState)
+	require.NoError(t, err)
+
+	require.NoError(t, verifySyncAggregateSignature(bytesutil.PadTo([]byte{'s'}, fieldparams.BLSSignatureLength)))
+	require.ErrorIs(t, verifySyncAggregateSignature(make([]byte, fieldparams.BLSSignatureLength)), ErrInvalidSyncAggregateSignature)
+	require.ErrorIs(t, verifySyncAggregateSignature([]byte{'s'}), ErrInvalidSyncAggregateSignature)
+
+	block := util.NewBeaconBlockCapella()
+	block.Block.Slot = l.block.Block().Slot()
+	for i := uint64(0); i < params.BeaconConfig().MinSyncCommitteeParticipants; i++ {
+		block.Block.Body.SyncAggregate.SyncCommitteeBits.SetBitAt(i, true)
+	}
+	signedBlock, err := blocks.NewSignedBeaconBlock(block)
+	require.NoError(t, err)
+	_, err = NewLightClientOptimisticUpdateFromBeaconState(l.ctx, l.state, signedBlock, l.attestedState)
+	require.ErrorIs(t, err, ErrInvalidSyncAggregateSignature)
+}
+
+func TestLightClient_CreateLightClientBootstrap(t *testing.T) {
+	l := newTestLc(t).setupTest()
+
+	bootstrap, err := CreateLightClientBootstrap(l.ctx, l.attestedState, l.attestedBlock)
+	require.NoError(t, err)
+	require.Equal(t, l.attestedHeader.Slot, bootstrap.Header.Slot)
+	headerRoot, err := bootstrap.Header.HashTreeRoot()
+	require.NoError(t, err)
+	blockRoot, err := l.attestedBlock.Block().HashTreeRoot()
+	require.NoError(t, err)
+	require.Equal(t, blockRoot, headerRoot)
+
+	currentSyncCommittee, err := l.attestedState.CurrentSyncCommittee()
+	require.NoError(t, err)
+	require.DeepSSZEqual(t, currentSyncCommittee.Pubkeys, bootstrap.CurrentSyncCommittee.Pubkeys)
+	require.DeepSSZEqual(t, currentSyncCommittee.AggregatePubkey, bootstrap.CurrentSyncCommittee.AggregatePubkey)
+	branch, err := l.attestedState.CurrentSyncCommitteeProof(l.ctx)
+	require.NoError(t, err)
+	require.DeepSSZEqual(t, branch, bootstrap.CurrentSyncCommitteeBranch)
+
+	// The block must match the latest block header of the state.
+	_, err = CreateLightClientBootstrap(l.ctx, l.attestedState, l.block)
+	require.ErrorIs(t, err, ErrHeaderRootMismatch)
+}
+
+func TestLightClient_VerifyBootstrap(t *testing.T) {
+	l := newTestLc(t).setupTest()
+	bootstrap, err := CreateLightClientBootstrap(l.ctx, l.attestedState, l.attestedBlock)
+	require.NoError(t, err)
+	require.NoError(t, VerifyBootstrap(bootstrap))
+
+	t.Run("tampered committee", func(t *testing.T) {
+		b := proto.Clone(bootstrap).(*ethpbv2.LightClientBootstrap)
+		b.CurrentSyncCommittee.AggregatePubkey = bytesutil.PadTo([]byte{'a'}, 48)
+		require.ErrorIs(t, VerifyBootstrap(b), errInvalidCurrentSyncCommitteeBranch)
+	})
+	t.Run("tampered branch", func(t *testing.T) {
+		b := proto.Clone(bootstrap).(*ethpbv2.LightClientBootstrap)
+		b.CurrentSyncCommitteeBranch[0] = make([]byte, 32)
+		require.ErrorIs(t, VerifyBootstrap(b), errInvalidCurrentSyncCommitteeBranch)
+	})
+	t.Run("other state root", func(t *testing.T) {
+		b := proto.Clone(bootstrap).(*ethpbv2.LightClientBootstrap)
+		b.Header.StateRoot = bytesutil.PadTo([]byte{'a'}, 32)
+		require.ErrorIs(t, VerifyBootstrap(b), errInvalidCurrentSyncCommitteeBranch)
+	})
+	t.Run("nil committee", func(t *testing.T) {
+		b := proto.Clone(bootstrap).(*ethpbv2.LightClientBootstrap)
+		b.CurrentSyncCommittee = nil
+		require.ErrorContains(t, "nil light client bootstrap", VerifyBootstrap(b))
+	})
+}
+
+func TestService_LightClientBootstrap(t *testing.T) {
+	service, tr := minimalTestService(t)
+	ctx, beaconDB := tr.ctx, tr.db
+
+	l := newTestLc(t).setupTest()
+	attestedRoot, err := l.attestedBlock.Block().HashTreeRoot()
+	require.NoError(t, err)
+	require.NoError(t, beaconDB.SaveBlock(ctx, l.attestedBlock))
+	require.NoError(t, beaconDB.SaveState(ctx, l.attestedState, attestedRoot))
+
+	t.Run("present root", func(t *testing.T) {
+		bootstrap, err := service.LightClientBootstrap(ctx, attestedRoot)
+		require.NoError(t, err)
+		expected, err := CreateLightClientBootstrap(ctx, l.attestedState, l.attestedBlock)
+		require.NoError(t, err)
+		require.DeepEqual(t, expected, bootstrap)
+	})
+	t.Run("missing root", func(t *testing.T) {
+		_, err := service.LightClientBootstrap(ctx, [32]byte{'a'})
+		require.ErrorIs(t, err, errNoLightClientBootstrapState)
+	})
+}
@@ -210,6 +210,14 @@ var (
 			Buckets: []float64{1, 2, 4, 8, 16, 32, 64},
 		},
 	)
+	initSyncBlockCacheSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "init_sync_block_cache_size",
+		Help: "The number of blocks currently held in the initial sync blocks cache",
+	})
+	initSyncBlockCacheFlushCount = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "init_sync_block_cache_flush_total",
+		Help: "Count the number of times the initial sync blocks cache is flushed to the DB",
+	})
 	reorgDepth = promauto.NewHistogram(
 		prometheus.HistogramOpts{
 			Name:    "reorg_depth",
@@ -1,6 +1,8 @@
 package blockchain
 
 import (
+	"time"
+
 	"github.com/prysmaticlabs/prysm/v4/async/event"
 	"github.com/prysmaticlabs/prysm/v4/beacon-chain/cache"
 	statefeed "github.com/prysmaticlabs/prysm/v4/beacon-chain/core/feed/state"
@@ -36,6 +38,14 @@ func WithWeakSubjectivityCheckpoint(c *ethpb.Checkpoint) Option {
 	}
 }
 
+// WithWeakSubjectivityTimeout to bound each database call of the weak subjectivity check.
+func WithWeakSubjectivityTimeout(d time.Duration) Option {
+	return func(s *Service) error {
+		s.cfg.WeakSubjectivityTimeout = d
+		return nil
+	}
+}
+
 // WithDatabase for head access.
 func WithDatabase(beaconDB db.HeadAccessDatabase) Option {
 	return func(s *Service) error {
@@ -60,6 +70,22 @@ func WithExecutionEngineCaller(c execution.EngineCaller) Option {
 	}
 }
 
+// WithInitSyncSaveBatches to persist the initial sync blocks cache in the given number of concurrent batches.
+func WithInitSyncSaveBatches(n int) Option {
+	return func(s *Service) error {
+		s.cfg.InitSyncSaveBatches = n
+		return nil
+	}
+}
+
+// WithInitSyncTrackedProposersOnly to only keep in the initial sync blocks cache the blocks proposed by tracked validators.
+func WithInitSyncTrackedProposersOnly() Option {
+	return func(s *Service) error {
+		s.cfg.InitSyncTrackedOnly = true
+		return nil
+	}
+}
+
 // WithDepositCache for deposit lifecycle after chain inclusion.
 func WithDepositCache(c cache.DepositCache) Option {
 	return func(s *Service) error {
@@ -164,6 +190,40 @@ func WithFinalizedStateAtStartUp(st state.BeaconState) Option {
 	}
 }
 
+// WithBlobDurabilityChecker to only notify about new blobs once their storage reports them readable.
+func WithBlobDurabilityChecker(c BlobDurabilityChecker) Option {
+	return func(s *Service) error {
+		s.cfg.BlobDurability = c
+		return nil
+	}
+}
+
+// WithCompleteBlobSetNotifications to only notify about new blobs once the full set of blobs of their block is saved.
+func WithCompleteBlobSetNotifications() Option {
+	return func(s *Service) error {
+		s.cfg.CompleteBlobSets = true
+		return nil
+	}
+}
+
+// WithMaxConcurrentBlobSaves to bound the number of blob sidecar saves in flight. Callers beyond the
+// limit wait for a save to complete, or for their context to be done. Zero or less means no limit.
+func WithMaxConcurrentBlobSaves(n int) Option {
+	return func(s *Service) error {
+		s.cfg.MaxConcurrentBlobSaves = n
+		return nil
+	}
+}
+
+// WithDelayedOptimisticUpdates to withhold the latest light client optimistic update until its attested
+// slot is in the past, serving the update it replaced in the meantime.
+func WithDelayedOptimisticUpdates() Option {
+	return func(s *Service) error {
+		s.cfg.DelayOptimisticUpdates = true
+		return nil
+	}
+}
+
 func WithClockSynchronizer(gs *startup.ClockSynchronizer) Option {
 	return func(s *Service) error {
 		s.clockSetter = gs
@@ -556,16 +556,22 @@ func (s *Service) isDataAvailable(ctx context.Context, root [32]byte, signed int
 	if expected == 0 {
 		return nil
 	}
+	// The notifiers of the root are only needed while waiting for its blobs.
+	defer s.blobNotifiers.delete(root)
+	// Register the expected count before reading the db, so that a blob completing the set
+	// afterwards is notified when the complete set mode is enabled.
+	if s.cfg.CompleteBlobSets {
+		s.blobNotifiers.setExpected(root, expected)
+	}
 
 	// Read first from db in case we have the blobs
 	sidecars, err := s.cfg.BeaconDB.BlobSidecarsByRoot(ctx, root)
 	switch {
 	case err == nil:
 		if len(sidecars) >= expected {
-			s.blobNotifiers.delete(root)
 			if err := kzg.IsDataAvailable(kzgCommitments, sidecars); err != nil {
 				log.WithField("root", fmt.Sprintf("%#x", root)).Warn("removing blob sidecars with invalid proofs")
-				if err2 := s.cfg.BeaconDB.DeleteBlobSidecars(ctx, root); err2 != nil {
+				if err2 := s.deleteBlobSidecars(ctx, root); err2 != nil {
 					log.WithError(err2).Error("could not delete sidecars")
 				}
 				return err
@@ -592,14 +598,13 @@ func (s *Service) isDataAvailable(ctx context.Context, root [32]byte, signed int
 			if len(found) != expected {
 				continue
 			}
-			s.blobNotifiers.delete(root)
 			sidecars, err := s.cfg.BeaconDB.BlobSidecarsByRoot(ctx, root)
 			if err != nil {
 				return errors.Wrap(err, "could not get blob sidecars")
 			}
 			if err := kzg.IsDataAvailable(kzgCommitments, sidecars); err != nil {
 				log.WithField("root", fmt.Sprintf("%#x", root)).Warn("removing blob sidecars with invalid proofs")
-				if err2 := s.cfg.BeaconDB.DeleteBlobSidecars(ctx, root); err2 != nil {
+				if err2 := s.deleteBlobSidecars(ctx, root); err2 != nil {
 					log.WithError(err2).Error("could not delete sidecars")
 				}
 				return err
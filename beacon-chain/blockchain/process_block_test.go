@@ -2115,3 +2115,46 @@ func Test_commitmentsToCheck(t *testing.T) {
 		})
 	}
 }
+
+func TestService_isDataAvailable_ReleasesNotifiers(t *testing.T) {
+	b := util.NewBeaconBlockDeneb()
+	b.Block.Body.BlobKzgCommitments = [][]byte{make([]byte, 48), make([]byte, 48)}
+	signed, err := consensusblocks.NewSignedBeaconBlock(b)
+	require.NoError(t, err)
+	root := [32]byte{'a'}
+
+	for _, complete := range []bool{false, true} {
+		t.Run(fmt.Sprintf("complete blob sets %v", complete), func(t *testing.T) {
+			var opts []Option
+			if complete {
+				opts = append(opts, WithCompleteBlobSetNotifications())
+			}
+			service, tr := minimalTestService(t, opts...)
+			service.SetGenesisTime(time.Now())
+			bn := service.blobNotifiers
+			waiting := func() bool {
+				bn.RLock()
+				defer bn.RUnlock()
+				_, ok := bn.notifiers[root]
+				return ok
+			}
+
+			ctx, cancel := context.WithCancel(tr.ctx)
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- service.isDataAvailable(ctx, root, signed)
+			}()
+			for !waiting() {
+				time.Sleep(time.Millisecond)
+			}
+			_, ok := bn.expectedFor(root)
+			require.Equal(t, complete, ok)
+
+			cancel()
+			require.ErrorIs(t, <-errCh, context.Canceled)
+			require.Equal(t, false, waiting())
+			_, ok = bn.expectedFor(root)
+			require.Equal(t, false, ok)
+		})
+	}
+}
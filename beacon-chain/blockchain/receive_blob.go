@@ -1,23 +1,262 @@
 package blockchain
 
 import (
+	"bytes"
 	"context"
+	"sync"
+	"time"
 
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/prysm/v4/beacon-chain/db"
+	fieldparams "github.com/prysmaticlabs/prysm/v4/config/fieldparams"
+	"github.com/prysmaticlabs/prysm/v4/config/params"
+	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
 	ethpb "github.com/prysmaticlabs/prysm/v4/proto/prysm/v1alpha1"
 )
 
+// blobDurabilityPollInterval is how often the blob storage is polled while waiting for a
+// saved blob sidecar to become readable.
+const blobDurabilityPollInterval = 10 * time.Millisecond
+
+// BlobDurabilityChecker reports whether saved blob sidecars can be read back from storage.
+type BlobDurabilityChecker interface {
+	// SynchronousDurability returns true if saved blobs are readable as soon as the save returns.
+	SynchronousDurability() bool
+	// HasBlob returns true if the blob sidecar with the given block root and index is readable.
+	HasBlob(ctx context.Context, root [32]byte, index uint64) bool
+}
+
+type blobNotificationKey struct {
+	root  [32]byte
+	index uint64
+}
+
+// seenBlobNotifications tracks the (root, index) pairs that were already notified, keyed to the slot
+// of the blob so that entries can be pruned once they are older than an epoch.
+type seenBlobNotifications struct {
+	sync.Mutex
+	seen map[blobNotificationKey]primitives.Slot
+}
+
+// markSeen records the blob notification and prunes stale entries. It returns false if the
+// notification was already recorded.
+func (sb *seenBlobNotifications) markSeen(root [32]byte, index uint64, slot primitives.Slot) bool {
+	sb.Lock()
+	defer sb.Unlock()
+	for k, s := range sb.seen {
+		if s+params.BeaconConfig().SlotsPerEpoch < slot {
+			delete(sb.seen, k)
+		}
+	}
+	key := blobNotificationKey{root: root, index: index}
+	if _, ok := sb.seen[key]; ok {
+		return false
+	}
+	sb.seen[key] = slot
+	return true
+}
+
+// forget removes the recorded notifications of the blobs of the given root, so that blobs saved
+// again for that root are notified again.
+func (sb *seenBlobNotifications) forget(root [32]byte) {
+	sb.Lock()
+	defer sb.Unlock()
+	for k := range sb.seen {
+		if k.root == root {
+			delete(sb.seen, k)
+		}
+	}
+}
+
+// deleteBlobSidecars deletes the blob sidecars of the given root from the database and forgets
+// their notifications.
+func (s *Service) deleteBlobSidecars(ctx context.Context, root [32]byte) error {
+	if err := s.cfg.BeaconDB.DeleteBlobSidecars(ctx, root); err != nil {
+		return err
+	}
+	s.seenBlobs.forget(root)
+	return nil
+}
+
 // SendNewBlobEvent sends a message to the BlobNotifier channel that the blob
 // for the blocroot `root` is ready in the database
 func (s *Service) sendNewBlobEvent(root [32]byte, index uint64) {
 	s.blobNotifiers.forRoot(root) <- index
+	s.blobNotifiers.notifyWaiters(root, index)
+}
+
+// sendNewBlobEventWithCommitment sends the new blob event and, to the subscribers that asked for
+// it, the KZG commitment of the blob.
+func (s *Service) sendNewBlobEventWithCommitment(root [32]byte, index uint64, commitment []byte) {
+	s.sendNewBlobEvent(root, index)
+	s.blobNotifiers.notifyCommitment(root, index, commitment)
+}
+
+// WaitForBlob blocks until the blob with the given block root and index is ready in the database,
+// or until the context is done.
+func (s *Service) WaitForBlob(ctx context.Context, root [32]byte, index uint64) error {
+	// Subscribe before reading the database so that a blob saved in between is not missed.
+	c := s.blobNotifiers.subscribe(root, index)
+	defer s.blobNotifiers.unsubscribe(root, index, c)
+
+	_, err := s.cfg.BeaconDB.BlobSidecarsByRoot(ctx, root, index)
+	switch {
+	case err == nil:
+		return nil
+	case !errors.Is(err, db.ErrNotFound):
+		return errors.Wrap(err, "could not get blob sidecar")
+	}
+
+	select {
+	case <-c:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "context deadline waiting for blob sidecar")
+	}
 }
 
-// ReceiveBlob saves the blob to database and sends the new event
+// ReceiveBlob saves the blob to database and sends the new event. The event is
+// sent only once for each blob, even if it is received several times. When complete
+// blob set notifications are enabled, the events are only sent once every blob of the
+// block is saved.
 func (s *Service) ReceiveBlob(ctx context.Context, b *ethpb.BlobSidecar) error {
-	if err := s.cfg.BeaconDB.SaveBlobSidecar(ctx, []*ethpb.BlobSidecar{b}); err != nil {
+	if err := verifyBlobIndex(b); err != nil {
+		return err
+	}
+	if err := s.saveBlobSidecars(ctx, []*ethpb.BlobSidecar{b}); err != nil {
+		return errors.Wrapf(err, "could not save blob sidecar for block root %#x and index %d", b.BlockRoot, b.Index)
+	}
+
+	root := [32]byte(b.BlockRoot)
+	if err := s.waitForBlobDurability(ctx, root, b.Index); err != nil {
 		return err
 	}
+	if s.cfg.CompleteBlobSets {
+		s.notifyCompleteBlobSet(root, b.Slot)
+		return nil
+	}
+	if s.seenBlobs.markSeen(root, b.Index, b.Slot) {
+		s.sendNewBlobEventWithCommitment(root, b.Index, b.KzgCommitment)
+	}
+	return nil
+}
+
+// ReceiveBlobs saves a set of blobs of the same block to database in a single write and
+// then sends the new event for each of them. No event is sent if the blobs could not be saved
+// or if any of them did not become readable.
+func (s *Service) ReceiveBlobs(ctx context.Context, blobs []*ethpb.BlobSidecar) error {
+	if len(blobs) == 0 {
+		return nil
+	}
+	for _, b := range blobs {
+		if !bytes.Equal(b.BlockRoot, blobs[0].BlockRoot) {
+			return errors.Wrapf(errBlobRootMismatch, "%#x != %#x", b.BlockRoot, blobs[0].BlockRoot)
+		}
+		if err := verifyBlobIndex(b); err != nil {
+			return err
+		}
+	}
+	if err := s.saveBlobSidecars(ctx, blobs); err != nil {
+		return errors.Wrapf(err, "could not save %d blob sidecars for block root %#x", len(blobs), blobs[0].BlockRoot)
+	}
+
+	root := [32]byte(blobs[0].BlockRoot)
+	// Wait for every blob to be readable before notifying any of them.
+	for _, b := range blobs {
+		if err := s.waitForBlobDurability(ctx, root, b.Index); err != nil {
+			return err
+		}
+	}
+	for _, b := range blobs {
+		if !s.cfg.CompleteBlobSets && s.seenBlobs.markSeen(root, b.Index, b.Slot) {
+			s.sendNewBlobEventWithCommitment(root, b.Index, b.KzgCommitment)
+		}
+	}
+	if s.cfg.CompleteBlobSets {
+		s.notifyCompleteBlobSet(root, blobs[0].Slot)
+	}
+	return nil
+}
+
+// saveBlobSidecars saves the blob sidecars to database. When the number of concurrent saves is
+// bounded, it first waits for a free slot or for the context to be done.
+func (s *Service) saveBlobSidecars(ctx context.Context, blobs []*ethpb.BlobSidecar) error {
+	if s.blobSaveSlots != nil {
+		select {
+		case s.blobSaveSlots <- struct{}{}:
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "context deadline waiting to save blob sidecars")
+		}
+		defer func() { <-s.blobSaveSlots }()
+	}
+	return s.cfg.BeaconDB.SaveBlobSidecar(ctx, blobs)
+}
 
-	s.sendNewBlobEvent([32]byte(b.BlockRoot), b.Index)
+// completeBlobCommitments returns the KZG commitments, ordered by index, of the blobs of the
+// block with the given root. It returns false if any of the expected blobs is not saved.
+func (s *Service) completeBlobCommitments(root [32]byte, expected int) ([][]byte, bool) {
+	sidecars, err := s.cfg.BeaconDB.BlobSidecarsByRoot(s.ctx, root)
+	if err != nil {
+		return nil, false
+	}
+	found := make(map[uint64][]byte, len(sidecars))
+	for _, sc := range sidecars {
+		found[sc.Index] = sc.KzgCommitment
+	}
+	commitments := make([][]byte, expected)
+	for i := range commitments {
+		c, ok := found[uint64(i)]
+		if !ok {
+			return nil, false
+		}
+		commitments[i] = c
+	}
+	return commitments, true
+}
+
+// notifyCompleteBlobSet sends the new event for every blob of the block with the given root
+// once the full set is saved. Nothing is sent while the number of expected blobs is unknown,
+// the data availability check registers it before reading the saved blobs.
+func (s *Service) notifyCompleteBlobSet(root [32]byte, slot primitives.Slot) {
+	expected, ok := s.blobNotifiers.expectedFor(root)
+	if !ok {
+		return
+	}
+	commitments, ok := s.completeBlobCommitments(root, expected)
+	if !ok {
+		return
+	}
+	for i, c := range commitments {
+		if s.seenBlobs.markSeen(root, uint64(i), slot) {
+			s.sendNewBlobEventWithCommitment(root, uint64(i), c)
+		}
+	}
+}
+
+// waitForBlobDurability blocks until the configured blob storage reports the blob sidecar as
+// readable. It returns immediately if no checker is configured or if the storage is synchronously
+// durable.
+func (s *Service) waitForBlobDurability(ctx context.Context, root [32]byte, index uint64) error {
+	c := s.cfg.BlobDurability
+	if c == nil || c.SynchronousDurability() {
+		return nil
+	}
+	ticker := time.NewTicker(blobDurabilityPollInterval)
+	defer ticker.Stop()
+	for !c.HasBlob(ctx, root, index) {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "context deadline waiting for blob sidecar durability")
+		}
+	}
+	return nil
+}
+
+// verifyBlobIndex checks that the blob index is within the maximum number of blobs per block.
+func verifyBlobIndex(b *ethpb.BlobSidecar) error {
+	if b.Index >= fieldparams.MaxBlobsPerBlock {
+		return errors.Wrapf(ErrBlobIndexOutOfRange, "index %d, max blobs per block %d", b.Index, fieldparams.MaxBlobsPerBlock)
+	}
 	return nil
 }
@@ -0,0 +1,463 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/prysm/v4/beacon-chain/db"
+	"github.com/prysmaticlabs/prysm/v4/beacon-chain/db/kv"
+	fieldparams "github.com/prysmaticlabs/prysm/v4/config/fieldparams"
+	"github.com/prysmaticlabs/prysm/v4/config/params"
+	"github.com/prysmaticlabs/prysm/v4/consensus-types/blocks"
+	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
+	ethpb "github.com/prysmaticlabs/prysm/v4/proto/prysm/v1alpha1"
+	"github.com/prysmaticlabs/prysm/v4/testing/require"
+	"github.com/prysmaticlabs/prysm/v4/testing/util"
+)
+
+func testBlobSidecar(root [32]byte, slot primitives.Slot, index uint64) *ethpb.BlobSidecar {
+	return &ethpb.BlobSidecar{
+		BlockRoot:       root[:],
+		BlockParentRoot: make([]byte, 32),
+		Index:           index,
+		Slot:            slot,
+		KzgCommitment:   make([]byte, 48),
+		KzgProof:        make([]byte, 48),
+		Blob:            make([]byte, 131072),
+	}
+}
+
+func TestService_ReceiveBlob_DeduplicatesNotifications(t *testing.T) {
+	service, tr := minimalTestService(t)
+	root := [32]byte{'a'}
+	b := testBlobSidecar(root, 1, 1)
+	require.NoError(t, service.ReceiveBlob(tr.ctx, b))
+	require.NoError(t, service.ReceiveBlob(tr.ctx, b))
+	require.Equal(t, 1, len(service.blobNotifiers.forRoot(root)))
+
+	sidecars, err := tr.db.BlobSidecarsByRoot(tr.ctx, root)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(sidecars))
+}
+
+func TestSeenBlobNotifications_Prune(t *testing.T) {
+	sb := &seenBlobNotifications{seen: make(map[blobNotificationKey]primitives.Slot)}
+	require.Equal(t, true, sb.markSeen([32]byte{'a'}, 0, 1))
+	require.Equal(t, false, sb.markSeen([32]byte{'a'}, 0, 1))
+	require.Equal(t, true, sb.markSeen([32]byte{'a'}, 1, 1))
+
+	// Marking a blob more than an epoch later prunes the old entries.
+	require.Equal(t, true, sb.markSeen([32]byte{'b'}, 0, params.BeaconConfig().SlotsPerEpoch+2))
+	require.Equal(t, 1, len(sb.seen))
+	require.Equal(t, true, sb.markSeen([32]byte{'a'}, 0, 1))
+}
+
+func TestService_ReceiveBlobs(t *testing.T) {
+	service, tr := minimalTestService(t)
+	root := [32]byte{'a'}
+	blobs := []*ethpb.BlobSidecar{testBlobSidecar(root, 1, 0), testBlobSidecar(root, 1, 1), testBlobSidecar(root, 1, 2)}
+	require.NoError(t, service.ReceiveBlobs(tr.ctx, blobs))
+
+	nc := service.blobNotifiers.forRoot(root)
+	require.Equal(t, 3, len(nc))
+	for i := uint64(0); i < 3; i++ {
+		require.Equal(t, i, <-nc)
+	}
+	sidecars, err := tr.db.BlobSidecarsByRoot(tr.ctx, root)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(sidecars))
+}
+
+func TestService_ReceiveBlobs_Failure(t *testing.T) {
+	service, tr := minimalTestService(t)
+	root := [32]byte{'a'}
+
+	blobs := []*ethpb.BlobSidecar{testBlobSidecar(root, 1, 0), testBlobSidecar([32]byte{'b'}, 1, 1)}
+	require.ErrorIs(t, service.ReceiveBlobs(tr.ctx, blobs), errBlobRootMismatch)
+
+	// The second blob has a different slot and is rejected by the database.
+	blobs = []*ethpb.BlobSidecar{testBlobSidecar(root, 1, 0), testBlobSidecar(root, 2, 1), testBlobSidecar(root, 1, 2)}
+	require.NotNil(t, service.ReceiveBlobs(tr.ctx, blobs))
+	require.Equal(t, 0, len(service.blobNotifiers.forRoot(root)))
+	_, err := tr.db.BlobSidecarsByRoot(tr.ctx, root)
+	require.ErrorIs(t, err, kv.ErrNotFound)
+}
+
+func TestService_ReceiveBlob_IndexOutOfRange(t *testing.T) {
+	service, tr := minimalTestService(t)
+	root := [32]byte{'a'}
+	require.NoError(t, service.ReceiveBlob(tr.ctx, testBlobSidecar(root, 1, fieldparams.MaxBlobsPerBlock-1)))
+
+	err := service.ReceiveBlob(tr.ctx, testBlobSidecar(root, 1, fieldparams.MaxBlobsPerBlock))
+	require.ErrorIs(t, err, ErrBlobIndexOutOfRange)
+	sidecars, err := tr.db.BlobSidecarsByRoot(tr.ctx, root)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(sidecars))
+	require.Equal(t, 1, len(service.blobNotifiers.forRoot(root)))
+
+	blobs := []*ethpb.BlobSidecar{testBlobSidecar(root, 1, 0), testBlobSidecar(root, 1, fieldparams.MaxBlobsPerBlock)}
+	require.ErrorIs(t, service.ReceiveBlobs(tr.ctx, blobs), ErrBlobIndexOutOfRange)
+}
+
+func TestService_CompleteBlobCommitments(t *testing.T) {
+	service, tr := minimalTestService(t)
+	root := [32]byte{'a'}
+	_, ok := service.completeBlobCommitments(root, 2)
+	require.Equal(t, false, ok)
+	b0, b1 := testBlobSidecar(root, 1, 0), testBlobSidecar(root, 1, 1)
+	b0.KzgCommitment[0], b1.KzgCommitment[0] = 'a', 'b'
+	require.NoError(t, tr.db.SaveBlobSidecar(tr.ctx, []*ethpb.BlobSidecar{b1}))
+	_, ok = service.completeBlobCommitments(root, 2)
+	require.Equal(t, false, ok)
+	require.NoError(t, tr.db.SaveBlobSidecar(tr.ctx, []*ethpb.BlobSidecar{b0}))
+	commitments, ok := service.completeBlobCommitments(root, 2)
+	require.Equal(t, true, ok)
+	require.DeepEqual(t, [][]byte{b0.KzgCommitment, b1.KzgCommitment}, commitments)
+	commitments, ok = service.completeBlobCommitments(root, 0)
+	require.Equal(t, true, ok)
+	require.Equal(t, 0, len(commitments))
+}
+
+func TestService_ReceiveBlob_NotifiesCommitment(t *testing.T) {
+	service, tr := minimalTestService(t)
+	root := [32]byte{'a'}
+	cc := service.blobNotifiers.forRootWithCommitments(root)
+	b := testBlobSidecar(root, 1, 1)
+	b.KzgCommitment[0] = 'c'
+	require.NoError(t, service.ReceiveBlob(tr.ctx, b))
+
+	require.Equal(t, 1, len(cc))
+	n := <-cc
+	require.Equal(t, uint64(1), n.index)
+	require.DeepEqual(t, b.KzgCommitment, n.kzgCommitment)
+	// The index only notification is still sent.
+	require.Equal(t, uint64(1), <-service.blobNotifiers.forRoot(root))
+
+	// Roots without a commitment channel only get the index notification.
+	other := [32]byte{'b'}
+	require.NoError(t, service.ReceiveBlob(tr.ctx, testBlobSidecar(other, 1, 0)))
+	require.Equal(t, 1, len(service.blobNotifiers.forRoot(other)))
+	require.Equal(t, 0, len(cc))
+}
+
+func TestService_ReceiveBlob_CompleteBlobSets(t *testing.T) {
+	service, tr := minimalTestService(t, WithCompleteBlobSetNotifications())
+	root := [32]byte{'a'}
+	service.blobNotifiers.setExpected(root, 3)
+
+	require.NoError(t, service.ReceiveBlob(tr.ctx, testBlobSidecar(root, 1, 0)))
+	require.NoError(t, service.ReceiveBlob(tr.ctx, testBlobSidecar(root, 1, 2)))
+	nc := service.blobNotifiers.forRoot(root)
+	require.Equal(t, 0, len(nc))
+
+	require.NoError(t, service.ReceiveBlob(tr.ctx, testBlobSidecar(root, 1, 1)))
+	require.Equal(t, 3, len(nc))
+	for i := uint64(0); i < 3; i++ {
+		require.Equal(t, i, <-nc)
+	}
+
+	// Receiving a blob of a complete set again does not notify it twice.
+	require.NoError(t, service.ReceiveBlob(tr.ctx, testBlobSidecar(root, 1, 1)))
+	require.Equal(t, 0, len(nc))
+}
+
+func TestService_ReceiveBlobs_CompleteBlobSets(t *testing.T) {
+	service, tr := minimalTestService(t, WithCompleteBlobSetNotifications())
+	root := [32]byte{'a'}
+
+	// Nothing is notified while the number of expected blobs is unknown.
+	require.NoError(t, service.ReceiveBlobs(tr.ctx, []*ethpb.BlobSidecar{testBlobSidecar(root, 1, 0), testBlobSidecar(root, 1, 1)}))
+	nc := service.blobNotifiers.forRoot(root)
+	require.Equal(t, 0, len(nc))
+
+	cc := service.blobNotifiers.forRootWithCommitments(root)
+	service.blobNotifiers.setExpected(root, 3)
+	b := testBlobSidecar(root, 1, 2)
+	b.KzgCommitment[0] = 'c'
+	require.NoError(t, service.ReceiveBlobs(tr.ctx, []*ethpb.BlobSidecar{b}))
+	require.Equal(t, 3, len(nc))
+	require.Equal(t, 3, len(cc))
+	for i := uint64(0); i < 3; i++ {
+		n := <-cc
+		require.Equal(t, i, n.index)
+		if i == 2 {
+			require.DeepEqual(t, b.KzgCommitment, n.kzgCommitment)
+		}
+	}
+}
+
+func TestService_ReceiveBlob_AfterInvalidSidecarsDeleted(t *testing.T) {
+	service, tr := minimalTestService(t)
+	service.SetGenesisTime(time.Now())
+	b := util.NewBeaconBlockDeneb()
+	b.Block.Body.BlobKzgCommitments = [][]byte{make([]byte, 48)}
+	signed, err := blocks.NewSignedBeaconBlock(b)
+	require.NoError(t, err)
+	root := [32]byte{'a'}
+
+	// Two sidecars for a block committing to a single blob fail the data availability check,
+	// which deletes them.
+	require.NoError(t, service.ReceiveBlobs(tr.ctx, []*ethpb.BlobSidecar{testBlobSidecar(root, 0, 0), testBlobSidecar(root, 0, 1)}))
+	require.ErrorContains(t, "expected 1 commitments, obtained 2", service.isDataAvailable(tr.ctx, root, signed))
+	_, err = tr.db.BlobSidecarsByRoot(tr.ctx, root)
+	require.ErrorIs(t, err, db.ErrNotFound)
+
+	// The sidecar is notified again once it is delivered again.
+	nc := service.blobNotifiers.forRoot(root)
+	require.NoError(t, service.ReceiveBlob(tr.ctx, testBlobSidecar(root, 0, 0)))
+	require.Equal(t, 1, len(nc))
+	require.Equal(t, uint64(0), <-nc)
+}
+
+func TestBlobNotifierMap_Unsubscribe(t *testing.T) {
+	service, _ := minimalTestService(t)
+	bn := service.blobNotifiers
+	root := [32]byte{'a'}
+
+	c1 := bn.subscribe(root, 0)
+	c2 := bn.subscribe(root, 0)
+	c3 := bn.subscribe(root, 1)
+	require.Equal(t, 2, len(bn.waiters))
+	require.Equal(t, 2, len(bn.waiters[blobNotificationKey{root: root, index: 0}]))
+
+	bn.unsubscribe(root, 0, c1)
+	require.Equal(t, 1, len(bn.waiters[blobNotificationKey{root: root, index: 0}]))
+	bn.unsubscribe(root, 0, c2)
+	bn.unsubscribe(root, 1, c3)
+	require.Equal(t, 0, len(bn.waiters))
+
+	// Unsubscribing a released subscriber leaves nothing behind.
+	c4 := bn.subscribe(root, 2)
+	bn.notifyWaiters(root, 2)
+	_, open := <-c4
+	require.Equal(t, false, open)
+	bn.unsubscribe(root, 2, c4)
+	require.Equal(t, 0, len(bn.waiters))
+}
+
+func TestService_WaitForBlob(t *testing.T) {
+	t.Run("already present", func(t *testing.T) {
+		service, tr := minimalTestService(t)
+		root := [32]byte{'a'}
+		require.NoError(t, service.ReceiveBlob(tr.ctx, testBlobSidecar(root, 1, 0)))
+		require.NoError(t, service.WaitForBlob(tr.ctx, root, 0))
+	})
+	t.Run("arrives later", func(t *testing.T) {
+		service, tr := minimalTestService(t)
+		root := [32]byte{'a'}
+		errCh := make(chan error)
+		go func() {
+			errCh <- service.WaitForBlob(tr.ctx, root, 0)
+		}()
+		require.NoError(t, service.ReceiveBlob(tr.ctx, testBlobSidecar(root, 1, 0)))
+		require.NoError(t, <-errCh)
+		require.Equal(t, 0, len(service.blobNotifiers.waiters))
+	})
+	t.Run("timeout", func(t *testing.T) {
+		service, tr := minimalTestService(t)
+		root := [32]byte{'a'}
+		require.NoError(t, service.ReceiveBlob(tr.ctx, testBlobSidecar(root, 1, 0)))
+		ctx, cancel := context.WithTimeout(tr.ctx, 50*time.Millisecond)
+		defer cancel()
+		err := service.WaitForBlob(ctx, root, 1)
+		require.ErrorContains(t, "context deadline waiting for blob sidecar", err)
+		require.Equal(t, 0, len(service.blobNotifiers.waiters))
+	})
+}
+
+type delayedBlobDurability struct {
+	sync.Mutex
+	synchronous bool
+	durable     bool
+	checks      int
+}
+
+func (d *delayedBlobDurability) SynchronousDurability() bool {
+	return d.synchronous
+}
+
+func (d *delayedBlobDurability) HasBlob(_ context.Context, _ [32]byte, _ uint64) bool {
+	d.Lock()
+	defer d.Unlock()
+	d.checks++
+	return d.durable
+}
+
+func (d *delayedBlobDurability) setDurable() {
+	d.Lock()
+	defer d.Unlock()
+	d.durable = true
+}
+
+func TestService_ReceiveBlob_WaitsForDurability(t *testing.T) {
+	durability := &delayedBlobDurability{}
+	service, tr := minimalTestService(t, WithBlobDurabilityChecker(durability))
+	root := [32]byte{'a'}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- service.ReceiveBlob(tr.ctx, testBlobSidecar(root, 1, 0))
+	}()
+	time.Sleep(5 * blobDurabilityPollInterval)
+	require.Equal(t, 0, len(service.blobNotifiers.forRoot(root)))
+
+	durability.setDurable()
+	require.NoError(t, <-done)
+	require.Equal(t, 1, len(service.blobNotifiers.forRoot(root)))
+}
+
+func TestService_ReceiveBlob_DurabilityTimeout(t *testing.T) {
+	service, tr := minimalTestService(t, WithBlobDurabilityChecker(&delayedBlobDurability{}))
+	root := [32]byte{'a'}
+
+	ctx, cancel := context.WithTimeout(tr.ctx, 5*blobDurabilityPollInterval)
+	defer cancel()
+	require.ErrorContains(t, "context deadline waiting for blob sidecar durability", service.ReceiveBlob(ctx, testBlobSidecar(root, 1, 0)))
+	require.Equal(t, 0, len(service.blobNotifiers.forRoot(root)))
+
+	// The blob was not notified, so it is notified once durable.
+	service.cfg.BlobDurability = &delayedBlobDurability{durable: true}
+	require.NoError(t, service.ReceiveBlob(tr.ctx, testBlobSidecar(root, 1, 0)))
+	require.Equal(t, 1, len(service.blobNotifiers.forRoot(root)))
+}
+
+// partialBlobDurability reports only the given blob indices as readable.
+type partialBlobDurability struct {
+	durable map[uint64]bool
+}
+
+func (*partialBlobDurability) SynchronousDurability() bool {
+	return false
+}
+
+func (d *partialBlobDurability) HasBlob(_ context.Context, _ [32]byte, index uint64) bool {
+	return d.durable[index]
+}
+
+func TestService_ReceiveBlobs_DurabilityFailure(t *testing.T) {
+	durability := &partialBlobDurability{durable: map[uint64]bool{0: true, 1: true}}
+	service, tr := minimalTestService(t, WithBlobDurabilityChecker(durability))
+	root := [32]byte{'a'}
+	blobs := []*ethpb.BlobSidecar{testBlobSidecar(root, 1, 0), testBlobSidecar(root, 1, 1), testBlobSidecar(root, 1, 2)}
+
+	ctx, cancel := context.WithTimeout(tr.ctx, 5*blobDurabilityPollInterval)
+	defer cancel()
+	require.ErrorContains(t, "context deadline waiting for blob sidecar durability", service.ReceiveBlobs(ctx, blobs))
+	// No earlier index is notified when a later blob does not become readable.
+	require.Equal(t, 0, len(service.blobNotifiers.forRoot(root)))
+
+	durability.durable[2] = true
+	require.NoError(t, service.ReceiveBlobs(tr.ctx, blobs))
+	require.Equal(t, 3, len(service.blobNotifiers.forRoot(root)))
+}
+
+func TestService_ReceiveBlob_SynchronousDurability(t *testing.T) {
+	durability := &delayedBlobDurability{synchronous: true}
+	service, tr := minimalTestService(t, WithBlobDurabilityChecker(durability))
+	root := [32]byte{'a'}
+	require.NoError(t, service.ReceiveBlob(tr.ctx, testBlobSidecar(root, 1, 0)))
+	require.Equal(t, 1, len(service.blobNotifiers.forRoot(root)))
+	require.Equal(t, 0, durability.checks)
+}
+
+// failingBlobDB fails every blob sidecar save.
+type failingBlobDB struct {
+	db.HeadAccessDatabase
+}
+
+var errBlobSave = errors.New("could not write blob sidecar")
+
+func (*failingBlobDB) SaveBlobSidecar(context.Context, []*ethpb.BlobSidecar) error {
+	return errBlobSave
+}
+
+func TestService_ReceiveBlob_WrapsSaveError(t *testing.T) {
+	service, tr := minimalTestService(t)
+	service.cfg.BeaconDB = &failingBlobDB{HeadAccessDatabase: tr.db}
+	root := [32]byte{'a'}
+
+	err := service.ReceiveBlob(tr.ctx, testBlobSidecar(root, 1, 2))
+	require.ErrorIs(t, err, errBlobSave)
+	require.ErrorContains(t, fmt.Sprintf("block root %#x and index 2", root), err)
+	require.Equal(t, 0, len(service.blobNotifiers.forRoot(root)))
+
+	err = service.ReceiveBlobs(tr.ctx, []*ethpb.BlobSidecar{testBlobSidecar(root, 1, 0), testBlobSidecar(root, 1, 1)})
+	require.ErrorIs(t, err, errBlobSave)
+	require.ErrorContains(t, fmt.Sprintf("2 blob sidecars for block root %#x", root), err)
+}
+
+// slowBlobDB blocks every blob sidecar save until release is closed, recording the highest number
+// of saves in flight.
+type slowBlobDB struct {
+	db.HeadAccessDatabase
+	sync.Mutex
+	release     chan struct{}
+	inFlight    int
+	maxInFlight int
+}
+
+func (d *slowBlobDB) SaveBlobSidecar(ctx context.Context, blobs []*ethpb.BlobSidecar) error {
+	d.Lock()
+	d.inFlight++
+	if d.inFlight > d.maxInFlight {
+		d.maxInFlight = d.inFlight
+	}
+	d.Unlock()
+	<-d.release
+	d.Lock()
+	d.inFlight--
+	d.Unlock()
+	return d.HeadAccessDatabase.SaveBlobSidecar(ctx, blobs)
+}
+
+func (d *slowBlobDB) saving() int {
+	d.Lock()
+	defer d.Unlock()
+	return d.inFlight
+}
+
+func TestService_ReceiveBlob_MaxConcurrentSaves(t *testing.T) {
+	service, tr := minimalTestService(t, WithMaxConcurrentBlobSaves(2))
+	slow := &slowBlobDB{HeadAccessDatabase: tr.db, release: make(chan struct{})}
+	service.cfg.BeaconDB = slow
+	root := [32]byte{'a'}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := uint64(0); i < 4; i++ {
+		wg.Add(1)
+		go func(index uint64) {
+			defer wg.Done()
+			errs <- service.ReceiveBlob(tr.ctx, testBlobSidecar(root, 1, index))
+		}(i)
+	}
+	for slow.saving() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, 2, slow.saving())
+
+	// A caller waiting for a free slot returns once its context is done.
+	ctx, cancel := context.WithTimeout(tr.ctx, 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := service.ReceiveBlobs(ctx, []*ethpb.BlobSidecar{testBlobSidecar(root, 1, 4)})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorContains(t, "context deadline waiting to save blob sidecars", err)
+	require.Equal(t, true, time.Since(start) < time.Second)
+
+	close(slow.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.Equal(t, 2, slow.maxInFlight)
+	sidecars, err := tr.db.BlobSidecarsByRoot(tr.ctx, root)
+	require.NoError(t, err)
+	require.Equal(t, 4, len(sidecars))
+}
@@ -65,7 +65,9 @@ func (s *Service) ReceiveBlock(ctx context.Context, block interfaces.ReadOnlySig
 		return nil
 	}
 	receivedTime := time.Now()
-	s.blockBeingSynced.set(blockRoot)
+	if !s.blockBeingSynced.trySet(blockRoot) {
+		return errBlockBeingSynced
+	}
 	defer s.blockBeingSynced.unset(blockRoot)
 
 	blockCopy, err := block.Copy()
@@ -128,6 +130,10 @@ func (s *Service) ReceiveBlock(ctx context.Context, block interfaces.ReadOnlySig
 		if err := reportEpochMetrics(ctx, postState, headSt); err != nil {
 			log.WithError(err).Error("could not report epoch metrics")
 		}
+		// The fork choice tree metrics walk the whole tree, so they are only updated once per epoch.
+		s.cfg.ForkChoiceStore.RLock()
+		s.cfg.ForkChoiceStore.TreeStats()
+		s.cfg.ForkChoiceStore.RUnlock()
 	}
 	if err := s.updateJustificationOnBlock(ctx, preState, postState, currStoreJustifiedEpoch); err != nil {
 		return errors.Wrap(err, "could not update justified checkpoint")
@@ -141,6 +147,11 @@ func (s *Service) ReceiveBlock(ctx context.Context, block interfaces.ReadOnlySig
 	if newFinalized {
 		finalized := s.cfg.ForkChoiceStore.FinalizedCheckpoint()
 		go s.sendNewFinalizedEvent(blockCopy, postState)
+		go func() {
+			if err := s.sendLightClientFinalityUpdate(s.ctx, blockCopy, postState); err != nil {
+				log.WithError(err).Error("Could not send light client finality update")
+			}
+		}()
 		depCtx, cancel := context.WithTimeout(context.Background(), depositDeadline)
 		go func() {
 			s.insertFinalizedDeposits(depCtx, finalized.Root)
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	blockchainTesting "github.com/prysmaticlabs/prysm/v4/beacon-chain/blockchain/testing"
+	"github.com/prysmaticlabs/prysm/v4/beacon-chain/core/altair"
 	"github.com/prysmaticlabs/prysm/v4/beacon-chain/operations/voluntaryexits"
 	"github.com/prysmaticlabs/prysm/v4/config/params"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/blocks"
@@ -188,6 +189,72 @@ func TestService_ReceiveBlockUpdateHead(t *testing.T) {
 	assert.Equal(t, 2, s.cfg.ForkChoiceStore.NodeCount())
 }
 
+func TestService_ReceiveBlock_BlockBeingSynced(t *testing.T) {
+	s, tr := minimalTestService(t,
+		WithExitPool(voluntaryexits.NewPool()),
+		WithStateNotifier(&blockchainTesting.MockStateNotifier{RecordEvents: true}))
+	ctx, beaconDB := tr.ctx, tr.db
+	genesis, keys := util.DeterministicGenesisState(t, 64)
+	b, err := util.GenerateFullBlock(genesis, keys, util.DefaultBlockGenConfig(), 1)
+	require.NoError(t, err)
+	require.NoError(t, beaconDB.SaveState(ctx, genesis, bytesutil.ToBytes32(nil)))
+	require.NoError(t, s.saveGenesisData(ctx, genesis))
+	root, err := b.Block.HashTreeRoot()
+	require.NoError(t, err)
+	wsb, err := blocks.NewSignedBeaconBlock(b)
+	require.NoError(t, err)
+
+	s.blockBeingSynced.set(root)
+	require.ErrorIs(t, s.ReceiveBlock(ctx, wsb, root), errBlockBeingSynced)
+	require.Equal(t, false, s.cfg.ForkChoiceStore.HasNode(root))
+
+	s.blockBeingSynced.unset(root)
+	require.NoError(t, s.ReceiveBlock(ctx, wsb, root))
+	require.Equal(t, true, s.cfg.ForkChoiceStore.HasNode(root))
+}
+
+func TestService_ReceiveBlock_LatestOptimisticUpdateOfHead(t *testing.T) {
+	params.SetupTestConfigCleanup(t)
+	cfg := params.BeaconConfig().Copy()
+	cfg.AltairForkEpoch = 0
+	params.OverrideBeaconConfig(cfg)
+
+	s, tr := minimalTestService(t, WithStateNotifier(&blockchainTesting.MockStateNotifier{}))
+	ctx := tr.ctx
+	genesis, keys := util.DeterministicGenesisStateAltair(t, 64)
+	committee, err := altair.NextSyncCommittee(ctx, genesis)
+	require.NoError(t, err)
+	require.NoError(t, genesis.SetCurrentSyncCommittee(committee))
+	require.NoError(t, s.saveGenesisData(ctx, genesis))
+	conf := util.DefaultBlockGenConfig()
+	conf.FullSyncAggregate = true
+	b, err := util.GenerateFullBlockAltair(genesis.Copy(), keys, conf, 1)
+	require.NoError(t, err)
+	wsb, err := blocks.NewSignedBeaconBlock(b)
+	require.NoError(t, err)
+	root, err := b.Block.HashTreeRoot()
+	require.NoError(t, err)
+
+	_, err = s.LatestOptimisticUpdate(ctx)
+	require.ErrorIs(t, err, errNoLightClientOptimisticUpdate)
+	require.NoError(t, s.ReceiveBlock(ctx, wsb, root))
+	require.Equal(t, root, s.CachedHeadRoot())
+
+	// Receiving the block does not build the update.
+	s.lcOptimisticUpdate.RLock()
+	require.Equal(t, true, s.lcOptimisticUpdate.update == nil)
+	s.lcOptimisticUpdate.RUnlock()
+
+	// The update of the new head is built when it is requested.
+	update, err := s.LatestOptimisticUpdate(ctx)
+	require.NoError(t, err)
+	require.Equal(t, primitives.Slot(0), update.AttestedHeader.Slot)
+	require.Equal(t, primitives.Slot(1), update.SignatureSlot)
+	s.lcOptimisticUpdate.RLock()
+	require.Equal(t, root, s.lcOptimisticUpdate.headRoot)
+	s.lcOptimisticUpdate.RUnlock()
+}
+
 func TestService_ReceiveBlockBatch(t *testing.T) {
 	ctx := context.Background()
 
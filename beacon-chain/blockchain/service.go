@@ -36,11 +36,14 @@ import (
 	"github.com/prysmaticlabs/prysm/v4/config/params"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/blocks"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/interfaces"
+	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
 	"github.com/prysmaticlabs/prysm/v4/encoding/bytesutil"
+	ethpbv2 "github.com/prysmaticlabs/prysm/v4/proto/eth/v2"
 	ethpb "github.com/prysmaticlabs/prysm/v4/proto/prysm/v1alpha1"
 	prysmTime "github.com/prysmaticlabs/prysm/v4/time"
 	"github.com/prysmaticlabs/prysm/v4/time/slots"
 	"go.opencensus.io/trace"
+	"golang.org/x/sync/singleflight"
 )
 
 // Service represents a service that handles the internal
@@ -57,12 +60,17 @@ type Service struct {
 	checkpointStateCache *cache.CheckpointStateCache
 	initSyncBlocks       map[[32]byte]interfaces.ReadOnlySignedBeaconBlock
 	initSyncBlocksLock   sync.RWMutex
+	blockFetchGroup      singleflight.Group
 	wsVerifier           *WeakSubjectivityVerifier
 	clockSetter          startup.ClockSetter
 	clockWaiter          startup.ClockWaiter
 	syncComplete         chan struct{}
 	blobNotifiers        *blobNotifierMap
+	seenBlobs            *seenBlobNotifications
+	lcBestUpdates        *lightClientBestUpdates
+	lcOptimisticUpdate   *lightClientOptimisticUpdateCache
 	blockBeingSynced     *currentlySyncingBlock
+	blobSaveSlots        chan struct{}
 }
 
 // config options for the service.
@@ -87,13 +95,44 @@ type config struct {
 	BlockFetcher            execution.POWBlockFetcher
 	FinalizedStateAtStartUp state.BeaconState
 	ExecutionEngineCaller   execution.EngineCaller
+	InitSyncSaveBatches     int
+	InitSyncTrackedOnly     bool
+	WeakSubjectivityTimeout time.Duration
+	BlobDurability          BlobDurabilityChecker
+	CompleteBlobSets        bool
+	MaxConcurrentBlobSaves  int
+	DelayOptimisticUpdates  bool
 }
 
 var ErrMissingClockSetter = errors.New("blockchain Service initialized without a startup.ClockSetter")
 
+// lightClientBestUpdates holds the best light client update of each sync committee period.
+type lightClientBestUpdates struct {
+	sync.Mutex
+	updates map[uint64]*ethpbv2.LightClientUpdate
+}
+
+// lightClientOptimisticUpdateCache holds the light client optimistic update with the highest attested slot,
+// the one it replaced, and the root of the last head whose update was built.
+type lightClientOptimisticUpdateCache struct {
+	sync.RWMutex
+	update   *ethpbv2.LightClientOptimisticUpdate
+	previous *ethpbv2.LightClientOptimisticUpdate
+	headRoot [32]byte
+}
+
+// blobCommitmentNotification carries the index and KZG commitment of a blob that is ready in the database.
+type blobCommitmentNotification struct {
+	index         uint64
+	kzgCommitment []byte
+}
+
 type blobNotifierMap struct {
 	sync.RWMutex
-	notifiers map[[32]byte]chan uint64
+	notifiers   map[[32]byte]chan uint64
+	commitments map[[32]byte]chan blobCommitmentNotification
+	waiters     map[blobNotificationKey][]chan struct{}
+	expected    map[[32]byte]int
 }
 
 func (bn *blobNotifierMap) forRoot(root [32]byte) chan uint64 {
@@ -107,10 +146,93 @@ func (bn *blobNotifierMap) forRoot(root [32]byte) chan uint64 {
 	return c
 }
 
+// forRootWithCommitments returns the channel on which the blobs of the given root are notified
+// along with their KZG commitment. Commitments are only sent for roots that have such a channel.
+func (bn *blobNotifierMap) forRootWithCommitments(root [32]byte) chan blobCommitmentNotification {
+	bn.Lock()
+	defer bn.Unlock()
+	c, ok := bn.commitments[root]
+	if !ok {
+		c = make(chan blobCommitmentNotification, fieldparams.MaxBlobsPerBlock)
+		bn.commitments[root] = c
+	}
+	return c
+}
+
+// notifyCommitment sends the blob index and KZG commitment to the commitment channel of the
+// given root, if any.
+func (bn *blobNotifierMap) notifyCommitment(root [32]byte, index uint64, commitment []byte) {
+	bn.RLock()
+	c, ok := bn.commitments[root]
+	bn.RUnlock()
+	if ok {
+		c <- blobCommitmentNotification{index: index, kzgCommitment: commitment}
+	}
+}
+
 func (bn *blobNotifierMap) delete(root [32]byte) {
 	bn.Lock()
 	defer bn.Unlock()
 	delete(bn.notifiers, root)
+	delete(bn.commitments, root)
+	delete(bn.expected, root)
+}
+
+// setExpected records the number of blobs committed to by the block with the given root.
+func (bn *blobNotifierMap) setExpected(root [32]byte, expected int) {
+	bn.Lock()
+	defer bn.Unlock()
+	bn.expected[root] = expected
+}
+
+// expectedFor returns the number of blobs committed to by the block with the given root, if known.
+func (bn *blobNotifierMap) expectedFor(root [32]byte) (int, bool) {
+	bn.RLock()
+	defer bn.RUnlock()
+	expected, ok := bn.expected[root]
+	return expected, ok
+}
+
+// subscribe returns a channel that is closed once the blob with the given root and index is ready.
+func (bn *blobNotifierMap) subscribe(root [32]byte, index uint64) chan struct{} {
+	bn.Lock()
+	defer bn.Unlock()
+	key := blobNotificationKey{root: root, index: index}
+	c := make(chan struct{})
+	bn.waiters[key] = append(bn.waiters[key], c)
+	return c
+}
+
+// unsubscribe removes the given subscriber of the blob with the given root and index. Callers that
+// stop waiting must unsubscribe so that abandoned channels are not kept around. It is a no-op if
+// the subscriber was already released.
+func (bn *blobNotifierMap) unsubscribe(root [32]byte, index uint64, c chan struct{}) {
+	bn.Lock()
+	defer bn.Unlock()
+	key := blobNotificationKey{root: root, index: index}
+	waiters := bn.waiters[key]
+	for i, w := range waiters {
+		if w == c {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(bn.waiters, key)
+		return
+	}
+	bn.waiters[key] = waiters
+}
+
+// notifyWaiters releases all the subscribers waiting for the blob with the given root and index.
+func (bn *blobNotifierMap) notifyWaiters(root [32]byte, index uint64) {
+	bn.Lock()
+	defer bn.Unlock()
+	key := blobNotificationKey{root: root, index: index}
+	for _, c := range bn.waiters[key] {
+		close(c)
+	}
+	delete(bn.waiters, key)
 }
 
 // NewService instantiates a new block service instance that will
@@ -125,7 +247,10 @@ func NewService(ctx context.Context, opts ...Option) (*Service, error) {
 	}
 	ctx, cancel := context.WithCancel(ctx)
 	bn := &blobNotifierMap{
-		notifiers: make(map[[32]byte]chan uint64),
+		notifiers:   make(map[[32]byte]chan uint64),
+		commitments: make(map[[32]byte]chan blobCommitmentNotification),
+		waiters:     make(map[blobNotificationKey][]chan struct{}),
+		expected:    make(map[[32]byte]int),
 	}
 	srv := &Service{
 		ctx:                  ctx,
@@ -134,8 +259,11 @@ func NewService(ctx context.Context, opts ...Option) (*Service, error) {
 		checkpointStateCache: cache.NewCheckpointStateCache(),
 		initSyncBlocks:       make(map[[32]byte]interfaces.ReadOnlySignedBeaconBlock),
 		blobNotifiers:        bn,
+		seenBlobs:            &seenBlobNotifications{seen: make(map[blobNotificationKey]primitives.Slot)},
+		lcBestUpdates:        &lightClientBestUpdates{updates: make(map[uint64]*ethpbv2.LightClientUpdate)},
+		lcOptimisticUpdate:   &lightClientOptimisticUpdateCache{},
 		cfg:                  &config{ProposerSlotIndexCache: cache.NewProposerPayloadIDsCache()},
-		blockBeingSynced:     &currentlySyncingBlock{roots: make(map[[32]byte]struct{})},
+		blockBeingSynced:     newCurrentlySyncingBlock(),
 	}
 	for _, opt := range opts {
 		if err := opt(srv); err != nil {
@@ -149,6 +277,12 @@ func NewService(ctx context.Context, opts ...Option) (*Service, error) {
 	if err != nil {
 		return nil, err
 	}
+	if srv.cfg.WeakSubjectivityTimeout > 0 {
+		srv.wsVerifier.dbTimeout = srv.cfg.WeakSubjectivityTimeout
+	}
+	if srv.cfg.MaxConcurrentBlobSaves > 0 {
+		srv.blobSaveSlots = make(chan struct{}, srv.cfg.MaxConcurrentBlobSaves)
+	}
 	return srv, nil
 }
 
@@ -167,6 +301,7 @@ func (s *Service) Start() {
 	}
 	s.spawnProcessAttestationsRoutine()
 	go s.runLateBlockTasks()
+	go s.runSyncingBlockSweeper()
 }
 
 // Stop the blockchain service's main event loop and associated goroutines.
@@ -2,10 +2,16 @@ package blockchain
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/prysmaticlabs/prysm/v4/beacon-chain/db/filters"
+	fieldparams "github.com/prysmaticlabs/prysm/v4/config/fieldparams"
 	"github.com/prysmaticlabs/prysm/v4/config/params"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
 	"github.com/prysmaticlabs/prysm/v4/encoding/bytesutil"
@@ -13,18 +19,23 @@ import (
 	"github.com/prysmaticlabs/prysm/v4/time/slots"
 )
 
+// defaultWeakSubjectivityDBTimeout bounds each database call of the weak subjectivity check.
+const defaultWeakSubjectivityDBTimeout = time.Minute
+
 type weakSubjectivityDB interface {
 	HasBlock(ctx context.Context, blockRoot [32]byte) bool
 	BlockRoots(ctx context.Context, f *filters.QueryFilter) ([][32]byte, error)
 }
 
 type WeakSubjectivityVerifier struct {
-	enabled  bool
-	verified bool
-	root     [32]byte
-	epoch    primitives.Epoch
-	slot     primitives.Slot
-	db       weakSubjectivityDB
+	lock      sync.Mutex
+	enabled   bool
+	verified  bool
+	root      [32]byte
+	epoch     primitives.Epoch
+	slot      primitives.Slot
+	db        weakSubjectivityDB
+	dbTimeout time.Duration
 }
 
 // NewWeakSubjectivityVerifier validates a checkpoint, and if valid, uses it to initialize a weak subjectivity verifier.
@@ -40,18 +51,21 @@ func NewWeakSubjectivityVerifier(wsc *ethpb.Checkpoint, db weakSubjectivityDB) (
 		return nil, err
 	}
 	return &WeakSubjectivityVerifier{
-		enabled:  true,
-		verified: false,
-		root:     bytesutil.ToBytes32(wsc.Root),
-		epoch:    wsc.Epoch,
-		db:       db,
-		slot:     startSlot,
+		enabled:   true,
+		verified:  false,
+		root:      bytesutil.ToBytes32(wsc.Root),
+		epoch:     wsc.Epoch,
+		db:        db,
+		slot:      startSlot,
+		dbTimeout: defaultWeakSubjectivityDBTimeout,
 	}, nil
 }
 
 // VerifyWeakSubjectivity verifies the weak subjectivity root in the service struct.
 // Reference design: https://github.com/ethereum/consensus-specs/blob/master/specs/phase0/weak-subjectivity.md#weak-subjectivity-sync-procedure
 func (v *WeakSubjectivityVerifier) VerifyWeakSubjectivity(ctx context.Context, finalizedEpoch primitives.Epoch) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
 	if v.verified || !v.enabled {
 		return nil
 	}
@@ -70,23 +84,146 @@ func (v *WeakSubjectivityVerifier) VerifyWeakSubjectivity(ctx context.Context, f
 	}
 	log.Infof("Performing weak subjectivity check for root %#x in epoch %d", v.root, v.epoch)
 
-	if !v.db.HasBlock(ctx, v.root) {
+	hasBlock, err := withWeakSubjectivityDBTimeout(ctx, v.dbTimeout, func(ctx context.Context) (bool, error) {
+		return v.db.HasBlock(ctx, v.root), nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "could not check weak subjectivity root %#x in DB", v.root)
+	}
+	if !hasBlock {
 		return errors.Wrap(errWSBlockNotFound, fmt.Sprintf("missing root %#x", v.root))
 	}
-	endSlot := v.slot + params.BeaconConfig().SlotsPerEpoch
-	filter := filters.NewFilter().SetStartSlot(v.slot).SetEndSlot(endSlot)
+	startSlot, endSlot, err := weakSubjectivitySlotRange(v.epoch)
+	if err != nil {
+		return errors.Wrap(err, "could not compute weak subjectivity slot range")
+	}
+	filter := filters.NewFilter().SetStartSlot(startSlot).SetEndSlot(endSlot)
 	// A node should have the weak subjectivity block corresponds to the correct epoch in the DB.
-	log.Infof("Searching block roots for weak subjectivity root=%#x, between slots %d-%d", v.root, v.slot, endSlot)
-	roots, err := v.db.BlockRoots(ctx, filter)
+	log.Infof("Searching block roots for weak subjectivity root=%#x, between slots %d-%d", v.root, startSlot, endSlot)
+	roots, err := withWeakSubjectivityDBTimeout(ctx, v.dbTimeout, func(ctx context.Context) ([][32]byte, error) {
+		return v.db.BlockRoots(ctx, filter)
+	})
 	if err != nil {
 		return errors.Wrap(err, "error while retrieving block roots to verify weak subjectivity")
 	}
-	for _, root := range roots {
-		if v.root == root {
-			log.Info("Weak subjectivity check has passed!!")
-			v.verified = true
-			return nil
-		}
+	if containsRoot(roots, v.root) {
+		log.Info("Weak subjectivity check has passed!!")
+		v.verified = true
+		return nil
 	}
 	return errors.Wrap(errWSBlockNotFoundInEpoch, fmt.Sprintf("root=%#x, epoch=%d", v.root, v.epoch))
 }
+
+// Update replaces the weak subjectivity checkpoint of the verifier, as when the
+// --weak-subjectivity-checkpoint flag is reloaded, so that the new checkpoint has to be verified again.
+// A nil or empty checkpoint disables the verifier, as in NewWeakSubjectivityVerifier.
+func (v *WeakSubjectivityVerifier) Update(wsc *ethpb.Checkpoint) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if wsc == nil || len(wsc.Root) == 0 || wsc.Epoch == 0 {
+		v.enabled = false
+		v.verified = false
+		return nil
+	}
+	startSlot, err := slots.EpochStart(wsc.Epoch)
+	if err != nil {
+		return err
+	}
+	v.enabled = true
+	v.verified = false
+	v.root = bytesutil.ToBytes32(wsc.Root)
+	v.epoch = wsc.Epoch
+	v.slot = startSlot
+	return nil
+}
+
+// containsRoot returns true if root is one of the given roots, stopping at the first match.
+func containsRoot(roots [][32]byte, root [32]byte) bool {
+	for _, r := range roots {
+		if r == root {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckpointString returns the weak subjectivity checkpoint in the canonical 0xroot:epoch form used to
+// share it with peers. It returns an empty string if the verifier is not enabled.
+func (v *WeakSubjectivityVerifier) CheckpointString() string {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if !v.enabled {
+		return ""
+	}
+	return fmt.Sprintf("%#x:%d", v.root, v.epoch)
+}
+
+// ParseWeakSubjectivityCheckpoint parses a weak subjectivity checkpoint in the canonical 0xroot:epoch
+// form. The root must be 0x prefixed and hex encode exactly 32 bytes, and the epoch must be a non zero
+// decimal number.
+func ParseWeakSubjectivityCheckpoint(s string) (*ethpb.Checkpoint, error) {
+	rootString, epochString, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, errors.Wrapf(errInvalidWSCheckpoint, "%q is not in 0xroot:epoch form", s)
+	}
+	hexRoot, ok := strings.CutPrefix(rootString, "0x")
+	if !ok {
+		return nil, errors.Wrapf(errInvalidWSCheckpoint, "root %q is not 0x prefixed", rootString)
+	}
+	if len(hexRoot) != 2*fieldparams.RootLength {
+		return nil, errors.Wrapf(errInvalidWSCheckpoint, "root has %d hex characters, expected %d", len(hexRoot), 2*fieldparams.RootLength)
+	}
+	root, err := hex.DecodeString(hexRoot)
+	if err != nil {
+		return nil, errors.Wrapf(errInvalidWSCheckpoint, "could not decode root: %v", err)
+	}
+	epoch, err := strconv.ParseUint(epochString, 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(errInvalidWSCheckpoint, "could not parse epoch: %v", err)
+	}
+	if epoch == 0 {
+		return nil, errors.Wrap(errInvalidWSCheckpoint, "epoch must not be zero")
+	}
+	return &ethpb.Checkpoint{Epoch: primitives.Epoch(epoch), Root: root}, nil
+}
+
+// weakSubjectivitySlotRange returns the slots that bound the search for the weak subjectivity block
+// root, from the first slot of the given epoch up to and including the first slot of the next one.
+func weakSubjectivitySlotRange(epoch primitives.Epoch) (primitives.Slot, primitives.Slot, error) {
+	start, err := slots.EpochStart(epoch)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := start.SafeAddSlot(params.BeaconConfig().SlotsPerEpoch)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// withWeakSubjectivityDBTimeout runs the given database call with a context that expires after
+// the timeout. The call runs in its own goroutine so that a database that does not honor the
+// context cannot block the caller past the deadline. A zero timeout disables the deadline.
+func withWeakSubjectivityDBTimeout[T any](ctx context.Context, timeout time.Duration, call func(context.Context) (T, error)) (T, error) {
+	if timeout <= 0 {
+		return call(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	type result struct {
+		val T
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		val, err := call(ctx)
+		done <- result{val: val, err: err}
+	}()
+	select {
+	case r := <-done:
+		return r.val, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, errors.Wrapf(errWSDBTimeout, "after %s: %v", timeout, ctx.Err())
+	}
+}
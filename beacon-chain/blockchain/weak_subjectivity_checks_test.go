@@ -1,14 +1,21 @@
 package blockchain
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"math"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/prysm/v4/beacon-chain/db/filters"
 	testDB "github.com/prysmaticlabs/prysm/v4/beacon-chain/db/testing"
 	doublylinkedtree "github.com/prysmaticlabs/prysm/v4/beacon-chain/forkchoice/doubly-linked-tree"
 	forkchoicetypes "github.com/prysmaticlabs/prysm/v4/beacon-chain/forkchoice/types"
 	fieldparams "github.com/prysmaticlabs/prysm/v4/config/fieldparams"
+	"github.com/prysmaticlabs/prysm/v4/config/params"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
 	"github.com/prysmaticlabs/prysm/v4/encoding/bytesutil"
 	ethpb "github.com/prysmaticlabs/prysm/v4/proto/prysm/v1alpha1"
@@ -88,3 +95,234 @@ func TestService_VerifyWeakSubjectivityRoot(t *testing.T) {
 		})
 	}
 }
+
+func TestWeakSubjectivityVerifier_Update(t *testing.T) {
+	beaconDB := testDB.SetupDB(t)
+	ctx := context.Background()
+
+	b := util.NewBeaconBlock()
+	b.Block.Slot = 1792480
+	util.SaveBlock(t, ctx, beaconDB, b)
+	r, err := b.Block.HashTreeRoot()
+	require.NoError(t, err)
+	blockEpoch := slots.ToEpoch(b.Block.Slot)
+
+	wv, err := NewWeakSubjectivityVerifier(&ethpb.Checkpoint{Root: r[:], Epoch: blockEpoch}, beaconDB)
+	require.NoError(t, err)
+	require.NoError(t, wv.VerifyWeakSubjectivity(ctx, blockEpoch))
+	require.Equal(t, true, wv.verified)
+
+	// The new checkpoint must be verified again, and fails as its root is not in the DB.
+	missing := bytesutil.PadTo([]byte{'a'}, fieldparams.RootLength)
+	require.NoError(t, wv.Update(&ethpb.Checkpoint{Root: missing, Epoch: blockEpoch}))
+	require.Equal(t, false, wv.verified)
+	require.Equal(t, fmt.Sprintf("%#x:%d", missing, blockEpoch), wv.CheckpointString())
+	require.ErrorIs(t, wv.VerifyWeakSubjectivity(ctx, blockEpoch), errWSBlockNotFound)
+
+	// An invalid checkpoint is rejected and leaves the verifier unchanged.
+	require.NotNil(t, wv.Update(&ethpb.Checkpoint{Root: r[:], Epoch: math.MaxUint64}))
+	require.Equal(t, fmt.Sprintf("%#x:%d", missing, blockEpoch), wv.CheckpointString())
+
+	require.NoError(t, wv.Update(&ethpb.Checkpoint{Root: r[:], Epoch: blockEpoch}))
+	require.Equal(t, false, wv.verified)
+	require.NoError(t, wv.VerifyWeakSubjectivity(ctx, blockEpoch))
+	require.Equal(t, true, wv.verified)
+
+	// An empty checkpoint disables the verifier.
+	require.NoError(t, wv.Update(nil))
+	require.Equal(t, false, wv.enabled)
+	require.Equal(t, false, wv.verified)
+	require.Equal(t, "", wv.CheckpointString())
+	require.NoError(t, wv.VerifyWeakSubjectivity(ctx, blockEpoch))
+}
+
+// blockingWSDB is a weak subjectivity database that reports every block as present. Its
+// BlockRoots call, and its HasBlock call if blockHasBlock is set, block until release is
+// closed, ignoring the context.
+type blockingWSDB struct {
+	blockHasBlock bool
+	release       chan struct{}
+}
+
+func (d *blockingWSDB) HasBlock(_ context.Context, _ [32]byte) bool {
+	if d.blockHasBlock {
+		<-d.release
+	}
+	return true
+}
+
+func (d *blockingWSDB) BlockRoots(_ context.Context, _ *filters.QueryFilter) ([][32]byte, error) {
+	<-d.release
+	return nil, nil
+}
+
+func TestWeakSubjectivityVerifier_DBTimeout(t *testing.T) {
+	checkpt := &ethpb.Checkpoint{Root: bytesutil.PadTo([]byte{'a'}, fieldparams.RootLength), Epoch: 1}
+	release := make(chan struct{})
+	defer close(release)
+
+	t.Run("HasBlock", func(t *testing.T) {
+		wv, err := NewWeakSubjectivityVerifier(checkpt, &blockingWSDB{blockHasBlock: true, release: release})
+		require.NoError(t, err)
+		wv.dbTimeout = 10 * time.Millisecond
+		err = wv.VerifyWeakSubjectivity(context.Background(), 2)
+		require.ErrorIs(t, err, errWSDBTimeout)
+		require.ErrorContains(t, "could not check weak subjectivity root", err)
+		require.Equal(t, false, wv.verified)
+	})
+	t.Run("BlockRoots", func(t *testing.T) {
+		wv, err := NewWeakSubjectivityVerifier(checkpt, &blockingWSDB{release: release})
+		require.NoError(t, err)
+		wv.dbTimeout = 10 * time.Millisecond
+		err = wv.VerifyWeakSubjectivity(context.Background(), 2)
+		require.ErrorIs(t, err, errWSDBTimeout)
+		require.ErrorContains(t, "error while retrieving block roots", err)
+		require.Equal(t, false, wv.verified)
+	})
+}
+
+func TestService_WeakSubjectivityTimeout(t *testing.T) {
+	checkpt := &ethpb.Checkpoint{Root: bytesutil.PadTo([]byte{'a'}, fieldparams.RootLength), Epoch: 1}
+	wv, err := NewWeakSubjectivityVerifier(checkpt, nil)
+	require.NoError(t, err)
+	require.Equal(t, defaultWeakSubjectivityDBTimeout, wv.dbTimeout)
+	service, _ := minimalTestService(t, WithWeakSubjectivityCheckpoint(checkpt), WithWeakSubjectivityTimeout(time.Second))
+	require.Equal(t, time.Second, service.wsVerifier.dbTimeout)
+}
+
+func TestWeakSubjectivitySlotRange(t *testing.T) {
+	start, end, err := weakSubjectivitySlotRange(10)
+	require.NoError(t, err)
+	require.Equal(t, primitives.Slot(10*params.BeaconConfig().SlotsPerEpoch), start)
+	require.Equal(t, start+params.BeaconConfig().SlotsPerEpoch, end)
+
+	params.SetupTestConfigCleanup(t)
+	cfg := params.BeaconConfig().Copy()
+	cfg.SlotsPerEpoch = 8
+	params.OverrideBeaconConfig(cfg)
+	start, end, err = weakSubjectivitySlotRange(10)
+	require.NoError(t, err)
+	require.Equal(t, primitives.Slot(80), start)
+	require.Equal(t, primitives.Slot(88), end)
+
+	_, _, err = weakSubjectivitySlotRange(math.MaxUint64)
+	require.NotNil(t, err)
+}
+
+func TestWeakSubjectivityVerifier_RootAtNextEpochStart(t *testing.T) {
+	beaconDB := testDB.SetupDB(t)
+	b := util.NewBeaconBlock()
+	b.Block.Slot = primitives.Slot(11 * params.BeaconConfig().SlotsPerEpoch)
+	util.SaveBlock(t, context.Background(), beaconDB, b)
+	r, err := b.Block.HashTreeRoot()
+	require.NoError(t, err)
+
+	// The search includes the first slot of the epoch following the checkpoint epoch.
+	wv, err := NewWeakSubjectivityVerifier(&ethpb.Checkpoint{Root: r[:], Epoch: 10}, beaconDB)
+	require.NoError(t, err)
+	require.NoError(t, wv.VerifyWeakSubjectivity(context.Background(), 11))
+	require.Equal(t, true, wv.verified)
+}
+
+func TestWeakSubjectivityVerifier_CheckpointString(t *testing.T) {
+	wv, err := NewWeakSubjectivityVerifier(nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "", wv.CheckpointString())
+
+	checkpt := &ethpb.Checkpoint{Root: bytesutil.PadTo([]byte{0xab, 0x01}, fieldparams.RootLength), Epoch: 1234}
+	wv, err = NewWeakSubjectivityVerifier(checkpt, nil)
+	require.NoError(t, err)
+	s := wv.CheckpointString()
+	require.Equal(t, "0xab01000000000000000000000000000000000000000000000000000000000000:1234", s)
+
+	parsed, err := ParseWeakSubjectivityCheckpoint(s)
+	require.NoError(t, err)
+	require.DeepEqual(t, checkpt, parsed)
+}
+
+func TestParseWeakSubjectivityCheckpoint(t *testing.T) {
+	root := "0x" + strings.Repeat("ab", fieldparams.RootLength)
+	tests := []struct {
+		name  string
+		input string
+		epoch primitives.Epoch
+		err   string
+	}{
+		{name: "valid", input: root + ":100", epoch: 100},
+		{name: "upper case hex", input: "0x" + strings.Repeat("AB", fieldparams.RootLength) + ":7", epoch: 7},
+		{name: "empty", input: "", err: "is not in 0xroot:epoch form"},
+		{name: "no separator", input: root, err: "is not in 0xroot:epoch form"},
+		{name: "no prefix", input: strings.Repeat("ab", fieldparams.RootLength) + ":100", err: "is not 0x prefixed"},
+		{name: "short root", input: "0xabcd:100", err: "root has 4 hex characters, expected 64"},
+		{name: "long root", input: root + "ab:100", err: "root has 66 hex characters, expected 64"},
+		{name: "not hex", input: "0x" + strings.Repeat("zz", fieldparams.RootLength) + ":100", err: "could not decode root"},
+		{name: "empty epoch", input: root + ":", err: "could not parse epoch"},
+		{name: "negative epoch", input: root + ":-1", err: "could not parse epoch"},
+		{name: "epoch overflow", input: root + ":18446744073709551616", err: "could not parse epoch"},
+		{name: "extra separator", input: root + ":1:2", err: "could not parse epoch"},
+		{name: "zero epoch", input: root + ":0", err: "epoch must not be zero"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp, err := ParseWeakSubjectivityCheckpoint(tt.input)
+			if tt.err != "" {
+				require.ErrorIs(t, err, errInvalidWSCheckpoint)
+				require.ErrorContains(t, tt.err, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.epoch, cp.Epoch)
+			require.DeepEqual(t, bytes.Repeat([]byte{0xab}, fieldparams.RootLength), cp.Root)
+		})
+	}
+}
+
+func TestContainsRoot(t *testing.T) {
+	roots := [][32]byte{{'a'}, {'b'}, {'c'}}
+	tests := []struct {
+		name  string
+		roots [][32]byte
+		root  [32]byte
+		want  bool
+	}{
+		{name: "first", roots: roots, root: [32]byte{'a'}, want: true},
+		{name: "last", roots: roots, root: [32]byte{'c'}, want: true},
+		{name: "missing", roots: roots, root: [32]byte{'d'}, want: false},
+		{name: "zero root", roots: roots, root: [32]byte{}, want: false},
+		{name: "no roots", roots: nil, root: [32]byte{'a'}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, containsRoot(tt.roots, tt.root))
+		})
+	}
+}
+
+// BenchmarkContainsRoot compares the linear scan of containsRoot with a lookup in a set built from the
+// same roots, for a root at the end of the epoch.
+func BenchmarkContainsRoot(b *testing.B) {
+	roots := make([][32]byte, params.BeaconConfig().SlotsPerEpoch)
+	for i := range roots {
+		roots[i] = bytesutil.ToBytes32(bytesutil.Bytes8(uint64(i) + 1))
+	}
+	root := roots[len(roots)-1]
+
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if !containsRoot(roots, root) {
+				b.Fatal("root not found")
+			}
+		}
+	})
+	b.Run("set", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			set := make(map[[32]byte]struct{}, len(roots))
+			for _, r := range roots {
+				set[r] = struct{}{}
+			}
+			if _, ok := set[root]; !ok {
+				b.Fatal("root not found")
+			}
+		}
+	})
+}
@@ -49,6 +49,23 @@ func (f *ProposerPayloadIDsCache) GetProposerPayloadIDs(
 	return primitives.ValidatorIndex(bytesutil.BytesToUint64BigEndian(vId)), pId, true
 }
 
+// GetProposerIDsInRange returns the proposer IDs of every slot in the range [startSlot, endSlot] that
+// has an entry for the given head root, reading the cache once for the whole range.
+func (f *ProposerPayloadIDsCache) GetProposerIDsInRange(
+	startSlot, endSlot primitives.Slot,
+	r [fieldparams.RootLength]byte,
+) map[primitives.Slot]primitives.ValidatorIndex {
+	f.RLock()
+	defer f.RUnlock()
+	proposers := make(map[primitives.Slot]primitives.ValidatorIndex)
+	for slot := startSlot; slot <= endSlot; slot++ {
+		if ids, ok := f.slotToProposerAndPayloadIDs[idKey(slot, r)]; ok {
+			proposers[slot] = primitives.ValidatorIndex(bytesutil.BytesToUint64BigEndian(ids[:vIdLength]))
+		}
+	}
+	return proposers
+}
+
 // SetProposerAndPayloadIDs sets the proposer and payload IDs for the given slot and head root to build block.
 func (f *ProposerPayloadIDsCache) SetProposerAndPayloadIDs(
 	slot primitives.Slot,
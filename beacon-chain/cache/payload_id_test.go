@@ -70,3 +70,15 @@ func TestValidatorPayloadIDsCache_GetAndSaveValidatorPayloadIDs(t *testing.T) {
 	require.Equal(t, primitives.ValidatorIndex(0), i)
 	require.Equal(t, [pIdLength]byte{}, p)
 }
+
+func TestValidatorPayloadIDsCache_GetProposerIDsInRange(t *testing.T) {
+	cache := NewProposerPayloadIDsCache()
+	var r [32]byte
+	cache.SetProposerAndPayloadIDs(1, 10, [pIdLength]byte{}, r)
+	cache.SetProposerAndPayloadIDs(3, 30, [pIdLength]byte{1}, r)
+	cache.SetProposerAndPayloadIDs(4, 40, [pIdLength]byte{}, [32]byte{1})
+	cache.SetProposerAndPayloadIDs(6, 60, [pIdLength]byte{}, r)
+
+	require.DeepEqual(t, map[primitives.Slot]primitives.ValidatorIndex{1: 10, 3: 30}, cache.GetProposerIDsInRange(0, 5, r))
+	require.DeepEqual(t, map[primitives.Slot]primitives.ValidatorIndex{}, cache.GetProposerIDsInRange(7, 9, r))
+}
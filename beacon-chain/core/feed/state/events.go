@@ -27,6 +27,8 @@ const (
 	NewHead
 	// MissedSlot is sent when we need to notify users that a slot was missed.
 	MissedSlot
+	// LightClientFinalityUpdate is sent with a new light client finality update when finalization advances.
+	LightClientFinalityUpdate
 )
 
 // BlockProcessedData is the data sent with BlockProcessed events.
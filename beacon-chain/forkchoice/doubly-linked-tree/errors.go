@@ -5,6 +5,7 @@ import "errors"
 var ErrNilNode = errors.New("invalid nil or unknown node")
 var errInvalidParentRoot = errors.New("invalid parent root")
 var errInvalidProposerBoostRoot = errors.New("invalid proposer boost root")
+var errInvalidProposerBoostScore = errors.New("invalid proposer boost score")
 var errUnknownFinalizedRoot = errors.New("unknown finalized root")
 var errUnknownJustifiedRoot = errors.New("unknown justified root")
 var errInvalidOptimisticStatus = errors.New("invalid optimistic status")
@@ -12,3 +13,8 @@ var errInvalidNilCheckpoint = errors.New("invalid nil checkpoint")
 var errInvalidUnrealizedJustifiedEpoch = errors.New("invalid unrealized justified epoch")
 var errInvalidUnrealizedFinalizedEpoch = errors.New("invalid unrealized finalized epoch")
 var errNilBlockHeader = errors.New("invalid nil block header")
+var errInconsistentStore = errors.New("inconsistent forkchoice store")
+var errNotAncestor = errors.New("root is not an ancestor")
+var errInvalidCommitteeWeight = errors.New("invalid committee weight")
+var errInvalidFinalizedNode = errors.New("invalid operation on the finalized node")
+var errInvalidJustifiedNode = errors.New("invalid operation on the justified node")
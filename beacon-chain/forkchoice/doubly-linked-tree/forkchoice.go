@@ -1,9 +1,9 @@
 package doublylinkedtree
 
 import (
+	"bytes"
 	"context"
-	"fmt"
-	"time"
+	"sort"
 
 	"github.com/pkg/errors"
 	"github.com/prysmaticlabs/prysm/v4/beacon-chain/core/blocks"
@@ -13,12 +13,12 @@ import (
 	fieldparams "github.com/prysmaticlabs/prysm/v4/config/fieldparams"
 	"github.com/prysmaticlabs/prysm/v4/config/params"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
+	"github.com/prysmaticlabs/prysm/v4/crypto/hash"
 	"github.com/prysmaticlabs/prysm/v4/encoding/bytesutil"
 	v1 "github.com/prysmaticlabs/prysm/v4/proto/eth/v1"
 	ethpb "github.com/prysmaticlabs/prysm/v4/proto/prysm/v1alpha1"
 	"github.com/prysmaticlabs/prysm/v4/runtime/version"
 	"github.com/prysmaticlabs/prysm/v4/time/slots"
-	"github.com/sirupsen/logrus"
 	"go.opencensus.io/trace"
 )
 
@@ -33,8 +33,13 @@ func New() *ForkChoice {
 		proposerBoostRoot:             [32]byte{},
 		nodeByRoot:                    make(map[[fieldparams.RootLength]byte]*Node),
 		nodeByPayload:                 make(map[[fieldparams.RootLength]byte]*Node),
+		nodesBySlot:                   make(map[primitives.Slot][]*Node),
 		slashedIndices:                make(map[primitives.ValidatorIndex]bool),
 		receivedBlocksLastEpoch:       [fieldparams.SlotsPerEpoch]primitives.Slot{},
+		stagedBalanceDeltas:           make(map[[fieldparams.RootLength]byte]int64),
+		headSubscriptions:             &headSubscriptions{subscribers: make(map[uint64]chan [fieldparams.RootLength]byte)},
+		reorgHistory:                  newHistoryRing[primitives.Slot](defaultHistoryRetention),
+		invalidationHistory:           newHistoryRing[[][32]byte](defaultHistoryRetention),
 	}
 
 	b := make([]uint64, 0)
@@ -42,11 +47,59 @@ func New() *ForkChoice {
 	return &ForkChoice{store: s, balances: b, votes: v}
 }
 
+// MutationVersion returns a monotonic counter that is incremented whenever a
+// node is inserted or removed from the store, or a node's balance changes. Callers
+// can compare it with a previously seen value to detect stale cached data.
+func (f *ForkChoice) MutationVersion() uint64 {
+	return f.store.mutationVersion
+}
+
 // NodeCount returns the current number of nodes in the Store.
 func (f *ForkChoice) NodeCount() int {
 	return len(f.store.nodeByRoot)
 }
 
+// OptimisticNodeCount returns the number of nodes in the Store that have not been fully validated.
+func (f *ForkChoice) OptimisticNodeCount() int {
+	count := 0
+	for _, node := range f.store.nodeByRoot {
+		if node.optimistic {
+			count++
+		}
+	}
+	return count
+}
+
+// OptimisticPayloadHashes returns the distinct payload hashes of the nodes in the Store that have
+// not been fully validated, ordered by slot so that ancestors come first. Nodes without an
+// execution payload are skipped.
+func (f *ForkChoice) OptimisticPayloadHashes() [][32]byte {
+	nodes := make([]*Node, 0)
+	for _, node := range f.store.nodeByRoot {
+		if node.optimistic && node.payloadHash != params.BeaconConfig().ZeroHash {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].slot < nodes[j].slot
+	})
+	seen := make(map[[32]byte]bool, len(nodes))
+	hashes := make([][32]byte, 0, len(nodes))
+	for _, node := range nodes {
+		if seen[node.payloadHash] {
+			continue
+		}
+		seen[node.payloadHash] = true
+		hashes = append(hashes, node.payloadHash)
+	}
+	return hashes
+}
+
+// ValidatedNodeCount returns the number of nodes in the Store that have been fully validated.
+func (f *ForkChoice) ValidatedNodeCount() int {
+	return f.NodeCount() - f.OptimisticNodeCount()
+}
+
 // Head returns the head root from fork choice store.
 // It firsts computes validator's balance changes then recalculates block tree from leaves to root.
 func (f *ForkChoice) Head(
@@ -61,19 +114,12 @@ func (f *ForkChoice) Head(
 		return [32]byte{}, errors.Wrap(err, "could not update balances")
 	}
 
-	if err := f.applyProposerBoostScore(); err != nil {
+	if err := f.applyProposerBoostScore(ctx); err != nil {
 		return [32]byte{}, errors.Wrap(err, "could not apply proposer boost score")
 	}
 
-	if err := f.store.treeRootNode.applyWeightChanges(ctx); err != nil {
-		return [32]byte{}, errors.Wrap(err, "could not apply weight changes")
-	}
-
-	jc := f.JustifiedCheckpoint()
-	fc := f.FinalizedCheckpoint()
-	currentEpoch := slots.EpochsSinceGenesis(time.Unix(int64(f.store.genesisTime), 0))
-	if err := f.store.treeRootNode.updateBestDescendant(ctx, jc.Epoch, fc.Epoch, currentEpoch); err != nil {
-		return [32]byte{}, errors.Wrap(err, "could not update best descendant")
+	if err := f.store.commitBalanceDeltas(ctx); err != nil {
+		return [32]byte{}, errors.Wrap(err, "could not commit balance changes")
 	}
 	return f.store.head(ctx)
 }
@@ -203,6 +249,52 @@ func (f *ForkChoice) IsOptimistic(root [32]byte) (bool, error) {
 	return node.optimistic, nil
 }
 
+// NodesAtSlot returns the roots of all the nodes in the Store at the given slot.
+func (f *ForkChoice) NodesAtSlot(slot primitives.Slot) [][32]byte {
+	nodes := f.store.nodesBySlot[slot]
+	roots := make([][32]byte, len(nodes))
+	for i, n := range nodes {
+		roots[i] = n.root
+	}
+	return roots
+}
+
+// ReconcilePayloadIndex rebuilds the payload hash index of the Store from its nodes, dropping
+// stale entries. It returns the number of dropped entries.
+func (f *ForkChoice) ReconcilePayloadIndex() int {
+	return f.store.reconcilePayloadIndex()
+}
+
+// IsFinalizedDescendant returns whether the node with the given root descends from, or is, the
+// finalized checkpoint block. It returns false for unknown roots.
+func (f *ForkChoice) IsFinalizedDescendant(root [32]byte) bool {
+	finalized, ok := f.store.nodeByRoot[f.store.finalizedCheckpoint.Root]
+	if !ok || finalized == nil {
+		return false
+	}
+	node, ok := f.store.nodeByRoot[root]
+	if !ok || node == nil {
+		return false
+	}
+	for n := node; n != nil && n.slot >= finalized.slot; n = n.parent {
+		if n == finalized {
+			return true
+		}
+	}
+	return false
+}
+
+// IsViableForHead returns whether the node with the given root is viable for head
+// with respect to the store's justified checkpoint and the current epoch.
+func (f *ForkChoice) IsViableForHead(root [32]byte) (bool, error) {
+	node, ok := f.store.nodeByRoot[root]
+	if !ok || node == nil {
+		return false, errors.Wrap(ErrNilNode, "could not determine head viability")
+	}
+	currentEpoch := slots.ToEpoch(slots.CurrentSlot(f.store.genesisTime))
+	return node.viableForHead(f.store.justifiedCheckpoint.Epoch, currentEpoch), nil
+}
+
 // AncestorRoot returns the ancestor root of input block root at a given slot.
 func (f *ForkChoice) AncestorRoot(ctx context.Context, root [32]byte, slot primitives.Slot) ([32]byte, error) {
 	ctx, span := trace.StartSpan(ctx, "doublyLinkedForkchoice.AncestorRoot")
@@ -228,6 +320,86 @@ func (f *ForkChoice) AncestorRoot(ctx context.Context, root [32]byte, slot primi
 	return n.root, nil
 }
 
+// AncestorRoots returns the roots of the chain from headRoot down to and including
+// stopRoot, starting with headRoot.
+func (f *ForkChoice) AncestorRoots(headRoot, stopRoot [32]byte) ([][32]byte, error) {
+	node, ok := f.store.nodeByRoot[headRoot]
+	if !ok || node == nil {
+		return nil, errors.Wrap(ErrNilNode, "could not determine ancestor roots")
+	}
+	stop, ok := f.store.nodeByRoot[stopRoot]
+	if !ok || stop == nil {
+		return nil, errors.Wrap(ErrNilNode, "could not determine ancestor roots")
+	}
+	if stop.slot > node.slot {
+		return nil, errors.Wrapf(errNotAncestor, "%#x of %#x", stopRoot, headRoot)
+	}
+	roots := make([][32]byte, 0, node.slot-stop.slot+1)
+	for n := node; n != nil && n.slot >= stop.slot; n = n.parent {
+		roots = append(roots, n.root)
+		if n == stop {
+			return roots, nil
+		}
+	}
+	return nil, errors.Wrapf(errNotAncestor, "%#x of %#x", stopRoot, headRoot)
+}
+
+// InclusionDistance returns the number of slots between the node with root attRoot and its
+// ancestor at targetSlot. It errors if no ancestor of the node was proposed at targetSlot,
+// which is the case for skipped slots.
+func (f *ForkChoice) InclusionDistance(attRoot [32]byte, targetSlot primitives.Slot) (primitives.Slot, error) {
+	node, ok := f.store.nodeByRoot[attRoot]
+	if !ok || node == nil {
+		return 0, errors.Wrap(ErrNilNode, "could not determine inclusion distance")
+	}
+	for n := node; n != nil && n.slot >= targetSlot; n = n.parent {
+		if n.slot == targetSlot {
+			return node.slot - targetSlot, nil
+		}
+	}
+	return 0, errors.Wrapf(errNotAncestor, "no ancestor of %#x at slot %d", attRoot, targetSlot)
+}
+
+// BestDescendant returns the root of the tip that would be head if the node with the given
+// root were the justified node. It returns the root itself when the node has no best descendant.
+// The result reflects the best descendants as of the last head computation.
+func (f *ForkChoice) BestDescendant(root [32]byte) ([32]byte, error) {
+	node, ok := f.store.nodeByRoot[root]
+	if !ok || node == nil {
+		return [32]byte{}, errors.Wrap(ErrNilNode, "could not determine best descendant")
+	}
+	if node.bestDescendant == nil {
+		return node.root, nil
+	}
+	return node.bestDescendant.root, nil
+}
+
+// EpochBoundaryRoot returns the root of the canonical block at the start slot of the given
+// epoch. If the start slot is skipped, the root of the latest canonical block before it is returned.
+func (f *ForkChoice) EpochBoundaryRoot(epoch primitives.Epoch) ([32]byte, error) {
+	startSlot, err := slots.EpochStart(epoch)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	n := f.store.headNode
+	for n != nil && n.slot > startSlot {
+		n = n.parent
+	}
+	if n == nil {
+		return [32]byte{}, errors.Wrapf(ErrNilNode, "could not determine boundary root of epoch %d", epoch)
+	}
+	return n.root, nil
+}
+
+// PreviousEpochBoundaryRoot returns the root of the canonical block at the start of the epoch
+// before currentEpoch.
+func (f *ForkChoice) PreviousEpochBoundaryRoot(currentEpoch primitives.Epoch) ([32]byte, error) {
+	if currentEpoch == 0 {
+		return [32]byte{}, errors.New("no previous epoch boundary at genesis epoch")
+	}
+	return f.EpochBoundaryRoot(currentEpoch - 1)
+}
+
 // IsViableForCheckpoint returns whether the root passed is a checkpoint root for any
 // known chain in forkchoice.
 func (f *ForkChoice) IsViableForCheckpoint(cp *forkchoicetypes.Checkpoint) (bool, error) {
@@ -261,8 +433,8 @@ func (f *ForkChoice) IsViableForCheckpoint(cp *forkchoicetypes.Checkpoint) (bool
 	return false, nil
 }
 
-// updateBalances updates the balances that directly voted for each block taking into account the
-// validators' latest votes.
+// updateBalances stages the changes of the balances that directly voted for each block taking
+// into account the validators' latest votes. They are applied by commitBalanceDeltas.
 func (f *ForkChoice) updateBalances() error {
 	newBalances := f.justifiedBalances
 	zHash := params.BeaconConfig().ZeroHash
@@ -299,7 +471,10 @@ func (f *ForkChoice) updateBalances() error {
 				if nextNode == nil {
 					return errors.Wrap(ErrNilNode, "could not update balances")
 				}
-				nextNode.balance += newBalance
+				if newBalance > 0 {
+					f.store.stageBalanceDelta(vote.nextRoot, int64(newBalance))
+					nextNode.attestationCount++
+				}
 			}
 
 			currentNode, ok := f.store.nodeByRoot[vote.currentRoot]
@@ -308,19 +483,11 @@ func (f *ForkChoice) updateBalances() error {
 				if currentNode == nil {
 					return errors.Wrap(ErrNilNode, "could not update balances")
 				}
-				if currentNode.balance < oldBalance {
-					log.WithFields(logrus.Fields{
-						"nodeRoot":                   fmt.Sprintf("%#x", bytesutil.Trunc(vote.currentRoot[:])),
-						"oldBalance":                 oldBalance,
-						"nodeBalance":                currentNode.balance,
-						"nodeWeight":                 currentNode.weight,
-						"proposerBoostRoot":          fmt.Sprintf("%#x", bytesutil.Trunc(f.store.proposerBoostRoot[:])),
-						"previousProposerBoostRoot":  fmt.Sprintf("%#x", bytesutil.Trunc(f.store.previousProposerBoostRoot[:])),
-						"previousProposerBoostScore": f.store.previousProposerBoostScore,
-					}).Warning("node with invalid balance, setting it to zero")
-					currentNode.balance = 0
-				} else {
-					currentNode.balance -= oldBalance
+				if oldBalance > 0 {
+					f.store.stageBalanceDelta(vote.currentRoot, -int64(oldBalance))
+					if currentNode.attestationCount > 0 {
+						currentNode.attestationCount--
+					}
 				}
 			}
 		}
@@ -333,11 +500,69 @@ func (f *ForkChoice) updateBalances() error {
 }
 
 // Tips returns a list of possible heads from fork choice store, it returns the
-// roots and the slots of the leaf nodes.
+// roots and the slots of the leaf nodes, leaving out the zero hash root.
 func (f *ForkChoice) Tips() ([][32]byte, []primitives.Slot) {
 	return f.store.tips()
 }
 
+// TipNodes returns the API representation of every leaf node of the fork choice store,
+// as given by Tips.
+func (f *ForkChoice) TipNodes() []*v1.ForkChoiceNode {
+	roots, _ := f.store.tips()
+	nodes := make([]*v1.ForkChoiceNode, 0, len(roots))
+	for _, root := range roots {
+		nodes = append(nodes, f.store.nodeByRoot[root].dump())
+	}
+	return nodes
+}
+
+// TreeStats returns the depth of the fork choice tree, the number of nodes in its longest path
+// from the root to a leaf, and its width, the highest number of nodes at any single slot.
+// It walks the whole tree and updates the depth and width metrics with the result.
+func (f *ForkChoice) TreeStats() (depth, width int) {
+	depth, width = f.store.treeStats()
+	treeDepth.Set(float64(depth))
+	treeWidth.Set(float64(width))
+	return depth, width
+}
+
+// StateHash returns a hash of the logical state of the fork choice store, to compare it between
+// nodes. It covers every node, sorted by root, with its parent, payload hash, slot, epochs, balance,
+// weight and optimistic status, but not the insertion times, so stores holding the same blocks and
+// votes hash identically regardless of the order in which the blocks were inserted.
+func (f *ForkChoice) StateHash() [32]byte {
+	nodes := make([]*Node, 0, len(f.store.nodeByRoot))
+	for _, n := range f.store.nodeByRoot {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return bytes.Compare(nodes[i].root[:], nodes[j].root[:]) < 0
+	})
+	buf := make([]byte, 0, len(nodes)*(3*fieldparams.RootLength+8*7+1))
+	for _, n := range nodes {
+		var parentRoot [fieldparams.RootLength]byte
+		if n.parent != nil {
+			parentRoot = n.parent.root
+		}
+		buf = append(buf, n.root[:]...)
+		buf = append(buf, parentRoot[:]...)
+		buf = append(buf, n.payloadHash[:]...)
+		buf = append(buf, bytesutil.Bytes8(uint64(n.slot))...)
+		buf = append(buf, bytesutil.Bytes8(uint64(n.justifiedEpoch))...)
+		buf = append(buf, bytesutil.Bytes8(uint64(n.unrealizedJustifiedEpoch))...)
+		buf = append(buf, bytesutil.Bytes8(uint64(n.finalizedEpoch))...)
+		buf = append(buf, bytesutil.Bytes8(uint64(n.unrealizedFinalizedEpoch))...)
+		buf = append(buf, bytesutil.Bytes8(n.balance)...)
+		buf = append(buf, bytesutil.Bytes8(n.weight)...)
+		if n.optimistic {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+	}
+	return hash.Hash(buf)
+}
+
 // ProposerBoost returns the proposerBoost of the store
 func (f *ForkChoice) ProposerBoost() [fieldparams.RootLength]byte {
 	return f.store.proposerBoost()
@@ -367,9 +592,28 @@ func (f *ForkChoice) FinalizedCheckpoint() *forkchoicetypes.Checkpoint {
 	return f.store.finalizedCheckpoint
 }
 
+// UnrealizedCheckpoints returns copies of the unrealized justified and finalized
+// checkpoints of fork choice store.
+func (f *ForkChoice) UnrealizedCheckpoints() (justified, finalized *forkchoicetypes.Checkpoint) {
+	uj := *f.store.unrealizedJustifiedCheckpoint
+	uf := *f.store.unrealizedFinalizedCheckpoint
+	return &uj, &uf
+}
+
 // SetOptimisticToInvalid removes a block with an invalid execution payload from fork choice store
 func (f *ForkChoice) SetOptimisticToInvalid(ctx context.Context, root, parentRoot, payloadHash [fieldparams.RootLength]byte) ([][32]byte, error) {
-	return f.store.setOptimisticToInvalid(ctx, root, parentRoot, payloadHash)
+	invalidRoots, err := f.store.setOptimisticToInvalid(ctx, root, parentRoot, payloadHash)
+	f.store.lastInvalidatedRoots = append([][32]byte{}, invalidRoots...)
+	if len(invalidRoots) > 0 && f.store.invalidationHistory != nil {
+		f.store.invalidationHistory.add(f.store.lastInvalidatedRoots)
+	}
+	return invalidRoots, err
+}
+
+// LastInvalidatedRoots returns the roots removed from the store by the most recent call to
+// SetOptimisticToInvalid. It is empty if that call did not remove any node.
+func (f *ForkChoice) LastInvalidatedRoots() [][32]byte {
+	return append([][32]byte{}, f.store.lastInvalidatedRoots...)
 }
 
 // InsertSlashedIndex adds the given slashed validator index to the
@@ -402,6 +646,10 @@ func (f *ForkChoice) InsertSlashedIndex(_ context.Context, index primitives.Vali
 	} else {
 		node.balance -= f.balances[index]
 	}
+	if f.balances[index] > 0 && node.attestationCount > 0 {
+		node.attestationCount--
+	}
+	f.store.mutationVersion++
 }
 
 // UpdateJustifiedCheckpoint sets the justified checkpoint to the given one
@@ -610,6 +858,26 @@ func (f *ForkChoice) Weight(root [32]byte) (uint64, error) {
 	return n.weight, nil
 }
 
+// AttestationCount returns the number of validators whose latest vote is counted in the balance of
+// the given root, as applied on the last head computation.
+func (f *ForkChoice) AttestationCount(root [32]byte) (uint64, error) {
+	n, ok := f.store.nodeByRoot[root]
+	if !ok || n == nil {
+		return 0, ErrNilNode
+	}
+	return n.attestationCount, nil
+}
+
+// FirstSeenSecsIntoSlot returns the number of seconds into its slot at which the given root was
+// inserted in forkchoice.
+func (f *ForkChoice) FirstSeenSecsIntoSlot(root [32]byte) (uint64, error) {
+	n, ok := f.store.nodeByRoot[root]
+	if !ok || n == nil {
+		return 0, ErrNilNode
+	}
+	return n.firstSeenSecsIntoSlot, nil
+}
+
 // updateJustifiedBalances updates the validators balances on the justified checkpoint pointed by root.
 func (f *ForkChoice) updateJustifiedBalances(ctx context.Context, root [32]byte) error {
 	balances, err := f.balancesByRoot(ctx, root)
@@ -629,6 +897,33 @@ func (f *ForkChoice) updateJustifiedBalances(ctx context.Context, root [32]byte)
 	return nil
 }
 
+// CommitteeWeight returns the committee weight used to compute the proposer boost: the total
+// active balance of the justified checkpoint divided by the number of slots per epoch.
+func (f *ForkChoice) CommitteeWeight() uint64 {
+	return f.store.committeeWeight
+}
+
+// SetCommitteeWeight sets the committee weight used to compute the proposer boost. A zero
+// weight is rejected when proposer boost is enabled, as it would disable the boost.
+func (f *ForkChoice) SetCommitteeWeight(weight uint64) error {
+	if weight == 0 && params.BeaconConfig().ProposerScoreBoost > 0 {
+		return errors.Wrap(errInvalidCommitteeWeight, "cannot set a zero committee weight while proposer boost is enabled")
+	}
+	f.store.committeeWeight = weight
+	return nil
+}
+
+// RecentSyncParticipationRate returns the committee weight as a fraction of the maximum committee
+// weight, the one reached if every active validator had the maximum effective balance. It is
+// computed from the last justified balances and returns 0 when there are no active validators.
+func (f *ForkChoice) RecentSyncParticipationRate() float64 {
+	maxWeight := f.numActiveValidators * params.BeaconConfig().MaxEffectiveBalance / uint64(params.BeaconConfig().SlotsPerEpoch)
+	if maxWeight == 0 {
+		return 0
+	}
+	return float64(f.store.committeeWeight) / float64(maxWeight)
+}
+
 // Slot returns the slot of the given root if it's known to forkchoice
 func (f *ForkChoice) Slot(root [32]byte) (primitives.Slot, error) {
 	n, ok := f.store.nodeByRoot[root]
@@ -637,3 +932,89 @@ func (f *ForkChoice) Slot(root [32]byte) (primitives.Slot, error) {
 	}
 	return n.slot, nil
 }
+
+// NodeArrivalLatency returns the number of seconds between the start of the slot of the given root
+// and the time the node was inserted in forkchoice. The result is negative if the node was inserted
+// before its slot started.
+func (f *ForkChoice) NodeArrivalLatency(root [32]byte, genesisTime uint64) (int64, error) {
+	n, ok := f.store.nodeByRoot[root]
+	if !ok || n == nil {
+		return 0, ErrNilNode
+	}
+	slotStart := genesisTime + uint64(n.slot)*params.BeaconConfig().SecondsPerSlot
+	if n.timestamp < slotStart {
+		return -int64(slotStart - n.timestamp), nil
+	}
+	secs, err := slots.SecondsSinceSlotStart(n.slot, genesisTime, n.timestamp)
+	if err != nil {
+		return 0, err
+	}
+	return int64(secs), nil
+}
+
+// LastReorgDepth returns the number of slots between the previous head and its
+// common ancestor with the current head, as recorded on the last head change.
+func (f *ForkChoice) LastReorgDepth() primitives.Slot {
+	return f.store.lastReorgDepth
+}
+
+// DistinctJustifiedEpochs returns the sorted set of justified epochs of all
+// the nodes in forkchoice. A wide spread indicates that the tree spans many
+// epochs without the justification being realized.
+func (f *ForkChoice) DistinctJustifiedEpochs() []primitives.Epoch {
+	seen := make(map[primitives.Epoch]bool)
+	epochs := make([]primitives.Epoch, 0)
+	for _, node := range f.store.nodeByRoot {
+		if seen[node.justifiedEpoch] {
+			continue
+		}
+		seen[node.justifiedEpoch] = true
+		epochs = append(epochs, node.justifiedEpoch)
+	}
+	sort.Slice(epochs, func(i, j int) bool {
+		return epochs[i] < epochs[j]
+	})
+	return epochs
+}
+
+// Validate walks the whole forkchoice tree and returns an error describing the
+// first invariant found to be violated. It is meant as a cheap integrity check
+// and does not modify the store.
+func (f *ForkChoice) Validate() error {
+	root := f.store.treeRootNode
+	if root == nil {
+		return nil
+	}
+	if root.parent != nil {
+		return errors.Wrapf(errInconsistentStore, "tree root %#x has a parent", root.root)
+	}
+	visited := 0
+	nodes := []*Node{root}
+	for len(nodes) > 0 {
+		n := nodes[len(nodes)-1]
+		nodes = nodes[:len(nodes)-1]
+		visited++
+		if f.store.nodeByRoot[n.root] != n {
+			return errors.Wrapf(errInconsistentStore, "node %#x is not indexed by its root", n.root)
+		}
+		if n.weight < n.balance {
+			return errors.Wrapf(errInconsistentStore, "node %#x has weight %d lower than its balance %d", n.root, n.weight, n.balance)
+		}
+		if n.justifiedEpoch < n.finalizedEpoch {
+			return errors.Wrapf(errInconsistentStore, "node %#x has justified epoch %d lower than its finalized epoch %d", n.root, n.justifiedEpoch, n.finalizedEpoch)
+		}
+		if n.unrealizedJustifiedEpoch < n.unrealizedFinalizedEpoch {
+			return errors.Wrapf(errInconsistentStore, "node %#x has unrealized justified epoch %d lower than its unrealized finalized epoch %d", n.root, n.unrealizedJustifiedEpoch, n.unrealizedFinalizedEpoch)
+		}
+		for _, child := range n.children {
+			if child.parent != n {
+				return errors.Wrapf(errInconsistentStore, "child %#x does not point to its parent %#x", child.root, n.root)
+			}
+			nodes = append(nodes, child)
+		}
+	}
+	if visited != len(f.store.nodeByRoot) {
+		return errors.Wrapf(errInconsistentStore, "%d nodes reachable from the tree root but %d indexed", visited, len(f.store.nodeByRoot))
+	}
+	return nil
+}
@@ -6,10 +6,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prysmaticlabs/prysm/v4/beacon-chain/forkchoice"
 	forkchoicetypes "github.com/prysmaticlabs/prysm/v4/beacon-chain/forkchoice/types"
 	"github.com/prysmaticlabs/prysm/v4/beacon-chain/state"
 	state_native "github.com/prysmaticlabs/prysm/v4/beacon-chain/state/state-native"
+	"github.com/prysmaticlabs/prysm/v4/config/features"
 	"github.com/prysmaticlabs/prysm/v4/config/params"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/blocks"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
@@ -84,6 +86,7 @@ func TestForkChoice_UpdateBalancesPositiveChange(t *testing.T) {
 	// they get propagated back.
 	f.justifiedBalances = []uint64{10, 20, 30}
 	require.NoError(t, f.updateBalances())
+	require.NoError(t, f.store.commitBalanceDeltas(ctx))
 	s := f.store
 	assert.Equal(t, uint64(10), s.nodeByRoot[indexToHash(1)].balance)
 	assert.Equal(t, uint64(20), s.nodeByRoot[indexToHash(2)].balance)
@@ -116,6 +119,7 @@ func TestForkChoice_UpdateBalancesNegativeChange(t *testing.T) {
 
 	f.justifiedBalances = []uint64{10, 20, 30}
 	require.NoError(t, f.updateBalances())
+	require.NoError(t, f.store.commitBalanceDeltas(ctx))
 	assert.Equal(t, uint64(10), s.nodeByRoot[indexToHash(1)].balance)
 	assert.Equal(t, uint64(20), s.nodeByRoot[indexToHash(2)].balance)
 	assert.Equal(t, uint64(30), s.nodeByRoot[indexToHash(3)].balance)
@@ -147,12 +151,16 @@ func TestForkChoice_UpdateBalancesUnderflow(t *testing.T) {
 
 	f.justifiedBalances = []uint64{10, 20, 30}
 	require.NoError(t, f.updateBalances())
+	require.NoError(t, f.store.commitBalanceDeltas(ctx))
 	assert.Equal(t, uint64(0), s.nodeByRoot[indexToHash(1)].balance)
 	assert.Equal(t, uint64(0), s.nodeByRoot[indexToHash(2)].balance)
 	assert.Equal(t, uint64(5), s.nodeByRoot[indexToHash(3)].balance)
 }
 
 func TestForkChoice_IsCanonical(t *testing.T) {
+	// Equal weight branches are broken by root only.
+	resetCfg := features.InitWithReset(&features.Flags{DisableForkchoiceSlotTieBreak: true})
+	defer resetCfg()
 	f := setup(1, 1)
 	ctx := context.Background()
 	st, blkRoot, err := prepareForkchoiceState(ctx, 1, indexToHash(1), params.BeaconConfig().ZeroHash, params.BeaconConfig().ZeroHash, 1, 1)
@@ -261,6 +269,95 @@ func TestForkChoice_AncestorRoot(t *testing.T) {
 	require.DeepEqual(t, hash1, root)
 }
 
+func TestForkChoice_IsFinalizedDescendant(t *testing.T) {
+	f := setup(1, 1)
+	ctx := context.Background()
+	// Chain: 0 <- 1 <- 2 <- 3
+	//         \
+	//          ---- 4
+	st, blkRoot, err := prepareForkchoiceState(ctx, 1, indexToHash(1), params.BeaconConfig().ZeroHash, [32]byte{'A'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	st, blkRoot, err = prepareForkchoiceState(ctx, 2, indexToHash(2), indexToHash(1), [32]byte{'B'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	st, blkRoot, err = prepareForkchoiceState(ctx, 3, indexToHash(3), indexToHash(2), [32]byte{'C'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	st, blkRoot, err = prepareForkchoiceState(ctx, 2, indexToHash(4), params.BeaconConfig().ZeroHash, [32]byte{'D'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+
+	// Everything descends from the genesis block.
+	require.Equal(t, true, f.IsFinalizedDescendant(indexToHash(3)))
+	require.Equal(t, true, f.IsFinalizedDescendant(indexToHash(4)))
+
+	f.store.finalizedCheckpoint = &forkchoicetypes.Checkpoint{Epoch: 1, Root: indexToHash(1)}
+	require.Equal(t, true, f.IsFinalizedDescendant(indexToHash(1)))
+	require.Equal(t, true, f.IsFinalizedDescendant(indexToHash(3)))
+	require.Equal(t, false, f.IsFinalizedDescendant(indexToHash(4)))
+	require.Equal(t, false, f.IsFinalizedDescendant(params.BeaconConfig().ZeroHash))
+	require.Equal(t, false, f.IsFinalizedDescendant(indexToHash(5)))
+}
+
+func TestForkChoice_IsViableForHead(t *testing.T) {
+	f := setup(2, 1)
+	ctx := context.Background()
+	st, blkRoot, err := prepareForkchoiceState(ctx, 1, indexToHash(1), params.BeaconConfig().ZeroHash, [32]byte{'A'}, 2, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	// Stale justification
+	st, blkRoot, err = prepareForkchoiceState(ctx, 2, indexToHash(2), params.BeaconConfig().ZeroHash, [32]byte{'B'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+
+	viable, err := f.IsViableForHead(indexToHash(1))
+	require.NoError(t, err)
+	require.Equal(t, true, viable)
+	viable, err = f.IsViableForHead(indexToHash(2))
+	require.NoError(t, err)
+	require.Equal(t, false, viable)
+	_, err = f.IsViableForHead(indexToHash(3))
+	require.ErrorIs(t, err, ErrNilNode)
+}
+
+func TestForkChoice_AncestorRoots(t *testing.T) {
+	f := setup(1, 1)
+	ctx := context.Background()
+	// Chain: 0 <- 1 <- 2 <- 3
+	//              \
+	//               ---- 4
+	st, blkRoot, err := prepareForkchoiceState(ctx, 1, indexToHash(1), params.BeaconConfig().ZeroHash, [32]byte{'A'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	st, blkRoot, err = prepareForkchoiceState(ctx, 2, indexToHash(2), indexToHash(1), [32]byte{'B'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	st, blkRoot, err = prepareForkchoiceState(ctx, 3, indexToHash(3), indexToHash(2), [32]byte{'C'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	st, blkRoot, err = prepareForkchoiceState(ctx, 3, indexToHash(4), indexToHash(1), [32]byte{'D'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+
+	roots, err := f.AncestorRoots(indexToHash(3), indexToHash(1))
+	require.NoError(t, err)
+	require.DeepEqual(t, [][32]byte{indexToHash(3), indexToHash(2), indexToHash(1)}, roots)
+
+	roots, err = f.AncestorRoots(indexToHash(3), indexToHash(3))
+	require.NoError(t, err)
+	require.DeepEqual(t, [][32]byte{indexToHash(3)}, roots)
+
+	_, err = f.AncestorRoots(indexToHash(3), indexToHash(4))
+	require.ErrorIs(t, err, errNotAncestor)
+	_, err = f.AncestorRoots(indexToHash(4), indexToHash(2))
+	require.ErrorIs(t, err, errNotAncestor)
+	_, err = f.AncestorRoots(indexToHash(1), indexToHash(3))
+	require.ErrorIs(t, err, errNotAncestor)
+	_, err = f.AncestorRoots(indexToHash(5), indexToHash(1))
+	require.ErrorIs(t, err, ErrNilNode)
+}
+
 func TestForkChoice_AncestorEqualSlot(t *testing.T) {
 	f := setup(1, 1)
 	ctx := context.Background()
@@ -292,6 +389,9 @@ func TestForkChoice_AncestorLowerSlot(t *testing.T) {
 }
 
 func TestForkChoice_RemoveEquivocating(t *testing.T) {
+	// Equal weight branches are broken by root only.
+	resetCfg := features.InitWithReset(&features.Flags{DisableForkchoiceSlotTieBreak: true})
+	defer resetCfg()
 	ctx := context.Background()
 	f := setup(1, 1)
 	// Insert a block it will be head
@@ -562,6 +662,9 @@ func TestStore_CommonAncestor(t *testing.T) {
 	require.ErrorIs(t, err, forkchoice.ErrUnknownCommonAncestor)
 	_, _, err = f.CommonAncestor(ctx, [32]byte{'z'}, [32]byte{'a'})
 	require.ErrorIs(t, err, forkchoice.ErrUnknownCommonAncestor)
+	// Identical unknown roots are not returned as their own ancestor.
+	_, _, err = f.CommonAncestor(ctx, [32]byte{'z'}, [32]byte{'z'})
+	require.ErrorIs(t, err, forkchoice.ErrUnknownCommonAncestor)
 	n := &Node{
 		slot:                     100,
 		root:                     [32]byte{'y'},
@@ -730,6 +833,53 @@ func TestWeight(t *testing.T) {
 	require.Equal(t, uint64(0), w)
 }
 
+func TestWeight_IncludesChildren(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	//   0 <- a <- b
+	//         \
+	//          -- c <- d
+	blocks := []struct {
+		slot   primitives.Slot
+		root   [32]byte
+		parent [32]byte
+	}{
+		{1, [32]byte{'a'}, params.BeaconConfig().ZeroHash},
+		{2, [32]byte{'b'}, [32]byte{'a'}},
+		{2, [32]byte{'c'}, [32]byte{'a'}},
+		{3, [32]byte{'d'}, [32]byte{'c'}},
+	}
+	for _, b := range blocks {
+		st, blkRoot, err := prepareForkchoiceState(ctx, b.slot, b.root, b.parent, b.root, 1, 1)
+		require.NoError(t, err)
+		require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	}
+	f.ProcessAttestation(ctx, []uint64{0}, [32]byte{'a'}, 1)
+	f.ProcessAttestation(ctx, []uint64{1}, [32]byte{'b'}, 1)
+	f.ProcessAttestation(ctx, []uint64{2, 3}, [32]byte{'c'}, 1)
+	f.ProcessAttestation(ctx, []uint64{4}, [32]byte{'d'}, 1)
+	f.justifiedBalances = []uint64{10, 20, 30, 40, 50}
+	_, err := f.Head(ctx)
+	require.NoError(t, err)
+
+	for root, want := range map[[32]byte]uint64{
+		{'a'}: 150,
+		{'b'}: 20,
+		{'c'}: 120,
+		{'d'}: 50,
+	} {
+		w, err := f.Weight(root)
+		require.NoError(t, err)
+		require.Equal(t, want, w)
+		n := f.store.nodeByRoot[root]
+		childrenWeight := uint64(0)
+		for _, child := range n.children {
+			childrenWeight += child.weight
+		}
+		require.Equal(t, n.balance+childrenWeight, w)
+	}
+}
+
 func TestForkchoice_UpdateJustifiedBalances(t *testing.T) {
 	f := setup(0, 0)
 	balances := []uint64{10, 0, 0, 40, 50, 60, 0, 80, 90, 100}
@@ -861,3 +1011,602 @@ func TestForkChoiceSlot(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, primitives.Slot(3), slot)
 }
+
+func TestForkChoice_MutationVersion(t *testing.T) {
+	f := setup(0, 0)
+	ctx := context.Background()
+
+	version := f.MutationVersion()
+	st, root, err := prepareForkchoiceState(ctx, 1, [32]byte{'a'}, params.BeaconConfig().ZeroHash, [32]byte{'A'}, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, root))
+	require.Equal(t, true, f.MutationVersion() > version)
+
+	version = f.MutationVersion()
+	st, root, err = prepareForkchoiceState(ctx, 2, [32]byte{'b'}, [32]byte{'a'}, [32]byte{'B'}, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, root))
+	require.Equal(t, true, f.MutationVersion() > version)
+
+	// Weight changes advance the counter.
+	version = f.MutationVersion()
+	f.justifiedBalances = []uint64{10}
+	f.ProcessAttestation(ctx, []uint64{0}, [32]byte{'b'}, 0)
+	_, err = f.Head(ctx)
+	require.NoError(t, err)
+	require.Equal(t, true, f.MutationVersion() > version)
+
+	// Read only calls do not advance the counter.
+	version = f.MutationVersion()
+	_, err = f.Head(ctx)
+	require.NoError(t, err)
+	require.Equal(t, true, f.HasNode([32]byte{'b'}))
+	require.Equal(t, true, f.IsCanonical([32]byte{'b'}))
+	_, err = f.Weight([32]byte{'b'})
+	require.NoError(t, err)
+	_, err = f.ForkChoiceDump(ctx)
+	require.NoError(t, err)
+	require.Equal(t, version, f.MutationVersion())
+
+	// Removals advance the counter.
+	_, err = f.SetOptimisticToInvalid(ctx, [32]byte{'b'}, [32]byte{'a'}, [32]byte{'A'})
+	require.NoError(t, err)
+	require.Equal(t, true, f.MutationVersion() > version)
+}
+
+func TestForkChoice_DistinctJustifiedEpochs(t *testing.T) {
+	f := setup(0, 0)
+	ctx := context.Background()
+	require.DeepEqual(t, []primitives.Epoch{0}, f.DistinctJustifiedEpochs())
+
+	st, root, err := prepareForkchoiceState(ctx, 1, [32]byte{'a'}, params.BeaconConfig().ZeroHash, [32]byte{'A'}, 2, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, root))
+	st, root, err = prepareForkchoiceState(ctx, 2, [32]byte{'b'}, [32]byte{'a'}, [32]byte{'B'}, 1, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, root))
+	st, root, err = prepareForkchoiceState(ctx, 3, [32]byte{'c'}, [32]byte{'a'}, [32]byte{'C'}, 2, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, root))
+	st, root, err = prepareForkchoiceState(ctx, 4, [32]byte{'d'}, [32]byte{'c'}, [32]byte{'D'}, 3, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, root))
+
+	require.DeepEqual(t, []primitives.Epoch{0, 1, 2, 3}, f.DistinctJustifiedEpochs())
+}
+
+func TestForkChoice_NodeArrivalLatency(t *testing.T) {
+	ctx := context.Background()
+	f := setup(0, 0)
+	root := [32]byte{'a'}
+	state, blkRoot, err := prepareForkchoiceState(ctx, 2, root, params.BeaconConfig().ZeroHash, [32]byte{'A'}, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	genesisTime := uint64(1000)
+	slotStart := genesisTime + 2*params.BeaconConfig().SecondsPerSlot
+
+	tests := []struct {
+		name      string
+		timestamp uint64
+		want      int64
+	}{
+		{name: "early", timestamp: slotStart - 3, want: -3},
+		{name: "on time", timestamp: slotStart, want: 0},
+		{name: "late", timestamp: slotStart + 5, want: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.store.nodeByRoot[root].timestamp = tt.timestamp
+			latency, err := f.NodeArrivalLatency(root, genesisTime)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, latency)
+		})
+	}
+
+	_, err = f.NodeArrivalLatency([32]byte{'b'}, genesisTime)
+	require.ErrorIs(t, err, ErrNilNode)
+}
+
+func TestForkChoice_PreviousEpochBoundaryRoot(t *testing.T) {
+	ctx := context.Background()
+	f := setup(0, 0)
+	spe := params.BeaconConfig().SlotsPerEpoch
+
+	// The boundary slot of epoch 1 is skipped.
+	parent := params.BeaconConfig().ZeroHash
+	for _, slot := range []primitives.Slot{spe - 1, spe + 1, 2*spe - 1, 2 * spe, 2*spe + 1} {
+		root := indexToHash(uint64(slot))
+		state, blkRoot, err := prepareForkchoiceState(ctx, slot, root, parent, root, 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+		parent = root
+	}
+	headRoot, err := f.Head(ctx)
+	require.NoError(t, err)
+	require.Equal(t, indexToHash(uint64(2*spe+1)), headRoot)
+
+	root, err := f.PreviousEpochBoundaryRoot(1)
+	require.NoError(t, err)
+	require.Equal(t, params.BeaconConfig().ZeroHash, root)
+	root, err = f.PreviousEpochBoundaryRoot(2)
+	require.NoError(t, err)
+	require.Equal(t, indexToHash(uint64(spe-1)), root)
+	root, err = f.PreviousEpochBoundaryRoot(3)
+	require.NoError(t, err)
+	require.Equal(t, indexToHash(uint64(2*spe)), root)
+
+	_, err = f.PreviousEpochBoundaryRoot(0)
+	require.ErrorContains(t, "no previous epoch boundary", err)
+}
+
+func TestForkChoice_Validate(t *testing.T) {
+	f := setup(0, 0)
+	ctx := context.Background()
+	st, blkRoot, err := prepareForkchoiceState(ctx, 1, indexToHash(1), params.BeaconConfig().ZeroHash, [32]byte{'A'}, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	st, blkRoot, err = prepareForkchoiceState(ctx, 2, indexToHash(2), indexToHash(1), [32]byte{'B'}, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	require.NoError(t, f.Validate())
+
+	t.Run("corrupted weight", func(t *testing.T) {
+		n := f.store.nodeByRoot[indexToHash(2)]
+		n.balance = n.weight + 1
+		defer func() { n.balance = 0 }()
+		err := f.Validate()
+		require.ErrorIs(t, err, errInconsistentStore)
+		require.ErrorContains(t, "lower than its balance", err)
+	})
+	t.Run("corrupted parent", func(t *testing.T) {
+		n := f.store.nodeByRoot[indexToHash(2)]
+		parent := n.parent
+		n.parent = f.store.treeRootNode
+		defer func() { n.parent = parent }()
+		err := f.Validate()
+		require.ErrorIs(t, err, errInconsistentStore)
+		require.ErrorContains(t, "does not point to its parent", err)
+	})
+	require.NoError(t, f.Validate())
+}
+
+func TestForkChoice_AttestationCount(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	//   0 <- a
+	//    \
+	//     -- b
+	for _, b := range []struct {
+		slot   primitives.Slot
+		root   [32]byte
+		parent [32]byte
+	}{
+		{1, [32]byte{'a'}, params.BeaconConfig().ZeroHash},
+		{1, [32]byte{'b'}, params.BeaconConfig().ZeroHash},
+	} {
+		st, blkRoot, err := prepareForkchoiceState(ctx, b.slot, b.root, b.parent, b.root, 1, 1)
+		require.NoError(t, err)
+		require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	}
+	requireCounts := func(a, b uint64) {
+		count, err := f.AttestationCount([32]byte{'a'})
+		require.NoError(t, err)
+		require.Equal(t, a, count)
+		count, err = f.AttestationCount([32]byte{'b'})
+		require.NoError(t, err)
+		require.Equal(t, b, count)
+	}
+	f.justifiedBalances = []uint64{10, 10, 10, 10}
+	f.ProcessAttestation(ctx, []uint64{0, 1, 2}, [32]byte{'a'}, 1)
+	f.ProcessAttestation(ctx, []uint64{3}, [32]byte{'b'}, 1)
+	// Votes are only counted once applied.
+	requireCounts(0, 0)
+	_, err := f.Head(ctx)
+	require.NoError(t, err)
+	requireCounts(3, 1)
+
+	// A changed vote moves its count.
+	f.ProcessAttestation(ctx, []uint64{2}, [32]byte{'b'}, 2)
+	_, err = f.Head(ctx)
+	require.NoError(t, err)
+	requireCounts(2, 2)
+
+	// A balance change does not count the vote again.
+	f.justifiedBalances = []uint64{20, 20, 20, 20}
+	_, err = f.Head(ctx)
+	require.NoError(t, err)
+	requireCounts(2, 2)
+
+	// Votes of validators without balance are not counted.
+	f.ProcessAttestation(ctx, []uint64{4}, [32]byte{'a'}, 3)
+	_, err = f.Head(ctx)
+	require.NoError(t, err)
+	requireCounts(2, 2)
+
+	// Slashed validators are no longer counted.
+	f.InsertSlashedIndex(ctx, 0)
+	requireCounts(1, 2)
+
+	_, err = f.AttestationCount([32]byte{'z'})
+	require.ErrorIs(t, err, ErrNilNode)
+}
+
+func TestForkChoice_CommitteeWeight(t *testing.T) {
+	ctx := context.Background()
+	f := setup(0, 0)
+	require.Equal(t, uint64(0), f.CommitteeWeight())
+
+	st, blkRoot, err := prepareForkchoiceState(ctx, 1, indexToHash(1), params.BeaconConfig().ZeroHash, [32]byte{'A'}, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	require.NoError(t, f.store.setUnrealizedJustifiedEpoch(indexToHash(1), 1))
+	f.store.unrealizedJustifiedCheckpoint = &forkchoicetypes.Checkpoint{Epoch: 1, Root: indexToHash(1)}
+
+	balance := params.BeaconConfig().MaxEffectiveBalance
+	f.justifiedBalances = []uint64{balance, balance, 0, balance}
+	require.NoError(t, f.NewSlot(ctx, params.BeaconConfig().SlotsPerEpoch))
+	require.Equal(t, primitives.Epoch(1), f.JustifiedCheckpoint().Epoch)
+	require.Equal(t, 3*balance/uint64(params.BeaconConfig().SlotsPerEpoch), f.CommitteeWeight())
+
+	require.ErrorIs(t, f.SetCommitteeWeight(0), errInvalidCommitteeWeight)
+	require.Equal(t, 3*balance/uint64(params.BeaconConfig().SlotsPerEpoch), f.CommitteeWeight())
+	require.NoError(t, f.SetCommitteeWeight(10))
+	require.Equal(t, uint64(10), f.CommitteeWeight())
+}
+
+func TestForkChoice_InclusionDistance(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	// Chain with skipped slots: 0 <- 1 <- 2 <- 5 <- 9
+	//                                 \
+	//                                  ---- 3
+	parent := params.BeaconConfig().ZeroHash
+	for _, slot := range []uint64{1, 2, 5, 9} {
+		st, blkRoot, err := prepareForkchoiceState(ctx, primitives.Slot(slot), indexToHash(slot), parent, indexToHash(slot), 1, 1)
+		require.NoError(t, err)
+		require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+		parent = indexToHash(slot)
+	}
+	st, blkRoot, err := prepareForkchoiceState(ctx, 3, indexToHash(3), indexToHash(2), indexToHash(3), 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+
+	distance, err := f.InclusionDistance(indexToHash(9), 2)
+	require.NoError(t, err)
+	require.Equal(t, primitives.Slot(7), distance)
+	distance, err = f.InclusionDistance(indexToHash(9), 5)
+	require.NoError(t, err)
+	require.Equal(t, primitives.Slot(4), distance)
+	distance, err = f.InclusionDistance(indexToHash(9), 9)
+	require.NoError(t, err)
+	require.Equal(t, primitives.Slot(0), distance)
+	distance, err = f.InclusionDistance(indexToHash(3), 1)
+	require.NoError(t, err)
+	require.Equal(t, primitives.Slot(2), distance)
+
+	// Slot 4 is skipped and slot 3 is on another branch.
+	_, err = f.InclusionDistance(indexToHash(9), 4)
+	require.ErrorIs(t, err, errNotAncestor)
+	_, err = f.InclusionDistance(indexToHash(9), 3)
+	require.ErrorIs(t, err, errNotAncestor)
+	// The target is after the attested block.
+	_, err = f.InclusionDistance(indexToHash(5), 9)
+	require.ErrorIs(t, err, errNotAncestor)
+	_, err = f.InclusionDistance(indexToHash(10), 1)
+	require.ErrorIs(t, err, ErrNilNode)
+}
+
+func TestForkChoice_BestDescendant(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	// Fork with different tips on each subtree:
+	//   0 <- a <- b <- d
+	//         \
+	//          -- c <- e <- g
+	blocks := []struct {
+		slot   primitives.Slot
+		root   [32]byte
+		parent [32]byte
+	}{
+		{1, [32]byte{'a'}, params.BeaconConfig().ZeroHash},
+		{2, [32]byte{'b'}, [32]byte{'a'}},
+		{2, [32]byte{'c'}, [32]byte{'a'}},
+		{3, [32]byte{'d'}, [32]byte{'b'}},
+		{3, [32]byte{'e'}, [32]byte{'c'}},
+		{4, [32]byte{'g'}, [32]byte{'e'}},
+	}
+	for _, b := range blocks {
+		st, blkRoot, err := prepareForkchoiceState(ctx, b.slot, b.root, b.parent, b.root, 1, 1)
+		require.NoError(t, err)
+		require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	}
+	f.ProcessAttestation(ctx, []uint64{0, 1}, [32]byte{'d'}, 1)
+	f.ProcessAttestation(ctx, []uint64{2}, [32]byte{'g'}, 1)
+	f.justifiedBalances = []uint64{100, 100, 100}
+	head, err := f.Head(ctx)
+	require.NoError(t, err)
+	require.Equal(t, [32]byte{'d'}, head)
+
+	tests := []struct {
+		root [32]byte
+		want [32]byte
+	}{
+		{root: params.BeaconConfig().ZeroHash, want: [32]byte{'d'}},
+		{root: [32]byte{'a'}, want: [32]byte{'d'}},
+		{root: [32]byte{'b'}, want: [32]byte{'d'}},
+		{root: [32]byte{'c'}, want: [32]byte{'g'}},
+		{root: [32]byte{'e'}, want: [32]byte{'g'}},
+		{root: [32]byte{'d'}, want: [32]byte{'d'}},
+		{root: [32]byte{'g'}, want: [32]byte{'g'}},
+	}
+	for _, tt := range tests {
+		got, err := f.BestDescendant(tt.root)
+		require.NoError(t, err)
+		require.Equal(t, tt.want, got)
+	}
+
+	_, err = f.BestDescendant([32]byte{'z'})
+	require.ErrorIs(t, err, ErrNilNode)
+}
+
+func TestForkChoice_ZeroHashRootExcluded(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	zeroHash := params.BeaconConfig().ZeroHash
+
+	roots, _ := f.Tips()
+	require.Equal(t, 0, len(roots))
+	dump, err := f.ForkChoiceDump(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(dump.ForkChoiceNodes))
+
+	//   0 <- a <- b
+	//         \
+	//          -- c
+	for _, b := range []struct {
+		slot   primitives.Slot
+		root   [32]byte
+		parent [32]byte
+	}{
+		{1, [32]byte{'a'}, zeroHash},
+		{2, [32]byte{'b'}, [32]byte{'a'}},
+		{2, [32]byte{'c'}, [32]byte{'a'}},
+	} {
+		st, blkRoot, err := prepareForkchoiceState(ctx, b.slot, b.root, b.parent, b.root, 1, 1)
+		require.NoError(t, err)
+		require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	}
+	headRoot, err := f.Head(ctx)
+	require.NoError(t, err)
+	require.NotEqual(t, zeroHash, headRoot)
+
+	roots, _ = f.Tips()
+	require.Equal(t, 2, len(roots))
+	for _, root := range roots {
+		require.NotEqual(t, zeroHash, root)
+	}
+	dump, err = f.ForkChoiceDump(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(dump.ForkChoiceNodes))
+	for _, node := range dump.ForkChoiceNodes {
+		require.DeepNotEqual(t, zeroHash[:], node.BlockRoot)
+	}
+	require.DeepEqual(t, zeroHash[:], dump.ForkChoiceNodes[0].ParentRoot)
+}
+
+func TestForkChoice_StateHash(t *testing.T) {
+	ctx := context.Background()
+	//   0 <- a <- b <- d
+	//         \
+	//          -- c <- e
+	//              \
+	//               -- g
+	blocks := []struct {
+		slot   primitives.Slot
+		root   [32]byte
+		parent [32]byte
+	}{
+		{1, [32]byte{'a'}, params.BeaconConfig().ZeroHash},
+		{2, [32]byte{'b'}, [32]byte{'a'}},
+		{2, [32]byte{'c'}, [32]byte{'a'}},
+		{3, [32]byte{'d'}, [32]byte{'b'}},
+		{3, [32]byte{'e'}, [32]byte{'c'}},
+		{4, [32]byte{'g'}, [32]byte{'c'}},
+	}
+	build := func(order []int) *ForkChoice {
+		f := setup(1, 1)
+		for _, i := range order {
+			b := blocks[i]
+			st, blkRoot, err := prepareForkchoiceState(ctx, b.slot, b.root, b.parent, b.root, 1, 1)
+			require.NoError(t, err)
+			require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+		}
+		f.justifiedBalances = []uint64{10, 20, 30}
+		f.ProcessAttestation(ctx, []uint64{0}, [32]byte{'d'}, 1)
+		f.ProcessAttestation(ctx, []uint64{1, 2}, [32]byte{'g'}, 1)
+		_, err := f.Head(ctx)
+		require.NoError(t, err)
+		return f
+	}
+
+	f1 := build([]int{0, 1, 2, 3, 4, 5})
+	f2 := build([]int{0, 2, 5, 4, 1, 3})
+	require.Equal(t, f1.StateHash(), f2.StateHash())
+	require.Equal(t, f1.StateHash(), f1.StateHash())
+
+	// Moving a vote changes the weights and the hash.
+	f2.ProcessAttestation(ctx, []uint64{2}, [32]byte{'e'}, 2)
+	_, err := f2.Head(ctx)
+	require.NoError(t, err)
+	require.NotEqual(t, f1.StateHash(), f2.StateHash())
+
+	// So does a different tree with the same weights.
+	f3 := build([]int{0, 1, 2, 3, 5})
+	require.NotEqual(t, f1.StateHash(), f3.StateHash())
+}
+
+func TestForkChoice_TipNodes(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	require.Equal(t, 0, len(f.TipNodes()))
+
+	// Multi fork tree:
+	//   0 <- a <- b <- d
+	//         \
+	//          -- c <- e
+	//              \
+	//               -- g
+	blocks := []struct {
+		slot   primitives.Slot
+		root   [32]byte
+		parent [32]byte
+	}{
+		{1, [32]byte{'a'}, params.BeaconConfig().ZeroHash},
+		{2, [32]byte{'b'}, [32]byte{'a'}},
+		{2, [32]byte{'c'}, [32]byte{'a'}},
+		{3, [32]byte{'d'}, [32]byte{'b'}},
+		{3, [32]byte{'e'}, [32]byte{'c'}},
+		{4, [32]byte{'g'}, [32]byte{'c'}},
+	}
+	for _, b := range blocks {
+		st, blkRoot, err := prepareForkchoiceState(ctx, b.slot, b.root, b.parent, b.root, 1, 1)
+		require.NoError(t, err)
+		require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	}
+
+	tips := f.TipNodes()
+	require.Equal(t, 3, len(tips))
+	want := map[[32]byte][32]byte{
+		{'d'}: {'b'},
+		{'e'}: {'c'},
+		{'g'}: {'c'},
+	}
+	for _, tip := range tips {
+		parent, ok := want[[32]byte(tip.BlockRoot)]
+		require.Equal(t, true, ok)
+		require.DeepEqual(t, parent[:], tip.ParentRoot)
+		delete(want, [32]byte(tip.BlockRoot))
+	}
+	require.Equal(t, 0, len(want))
+}
+
+func TestForkChoice_TreeStats(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	depth, width := f.TreeStats()
+	require.Equal(t, 1, depth)
+	require.Equal(t, 1, width)
+
+	// Tree with three nodes at slot 2 and a longest path of five nodes:
+	//   0 <- a <- b <- d <- h
+	//         \
+	//          -- c <- e
+	//         \
+	//          -- g
+	blocks := []struct {
+		slot   primitives.Slot
+		root   [32]byte
+		parent [32]byte
+	}{
+		{1, [32]byte{'a'}, params.BeaconConfig().ZeroHash},
+		{2, [32]byte{'b'}, [32]byte{'a'}},
+		{2, [32]byte{'c'}, [32]byte{'a'}},
+		{2, [32]byte{'g'}, [32]byte{'a'}},
+		{3, [32]byte{'d'}, [32]byte{'b'}},
+		{3, [32]byte{'e'}, [32]byte{'c'}},
+		{4, [32]byte{'h'}, [32]byte{'d'}},
+	}
+	for _, b := range blocks {
+		st, blkRoot, err := prepareForkchoiceState(ctx, b.slot, b.root, b.parent, b.root, 1, 1)
+		require.NoError(t, err)
+		require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	}
+	depth, width = f.TreeStats()
+	require.Equal(t, 5, depth)
+	require.Equal(t, 3, width)
+	require.Equal(t, float64(5), testutil.ToFloat64(treeDepth))
+	require.Equal(t, float64(3), testutil.ToFloat64(treeWidth))
+}
+
+func TestForkChoice_OptimisticPayloadHashes(t *testing.T) {
+	ctx := context.Background()
+	f := setup(0, 0)
+	require.Equal(t, 0, len(f.OptimisticPayloadHashes()))
+
+	// Chain: 0 <- 1 <- 2 <- 3
+	//                   \
+	//                    ---- 4 <- 5
+	// Nodes 3 and 4 share the same payload hash.
+	blocks := []struct {
+		slot        primitives.Slot
+		root        [32]byte
+		parent      [32]byte
+		payloadHash [32]byte
+	}{
+		{1, indexToHash(1), params.BeaconConfig().ZeroHash, [32]byte{'A'}},
+		{2, indexToHash(2), indexToHash(1), [32]byte{'B'}},
+		{3, indexToHash(3), indexToHash(2), [32]byte{'C'}},
+		{3, indexToHash(4), indexToHash(2), [32]byte{'C'}},
+		{4, indexToHash(5), indexToHash(4), [32]byte{'D'}},
+	}
+	for _, b := range blocks {
+		st, blkRoot, err := prepareForkchoiceState(ctx, b.slot, b.root, b.parent, b.payloadHash, 1, 1)
+		require.NoError(t, err)
+		require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	}
+	require.DeepEqual(t, [][32]byte{{'A'}, {'B'}, {'C'}, {'D'}}, f.OptimisticPayloadHashes())
+
+	require.NoError(t, f.SetOptimisticToValid(ctx, indexToHash(1)))
+	require.DeepEqual(t, [][32]byte{{'B'}, {'C'}, {'D'}}, f.OptimisticPayloadHashes())
+	require.NoError(t, f.SetOptimisticToValid(ctx, indexToHash(5)))
+	require.DeepEqual(t, [][32]byte{{'C'}}, f.OptimisticPayloadHashes())
+}
+
+func TestForkChoice_RecentSyncParticipationRate(t *testing.T) {
+	ctx := context.Background()
+	f := setup(0, 0)
+	require.Equal(t, float64(0), f.RecentSyncParticipationRate())
+
+	maxBalance := params.BeaconConfig().MaxEffectiveBalance
+	f.SetBalancesByRooter(func(_ context.Context, _ [32]byte) ([]uint64, error) {
+		return []uint64{maxBalance, maxBalance / 2, 0, maxBalance, maxBalance / 2}, nil
+	})
+	require.NoError(t, f.updateJustifiedBalances(ctx, params.BeaconConfig().ZeroHash))
+	require.Equal(t, uint64(4), f.numActiveValidators)
+	// Three full balances out of four active validators.
+	require.Equal(t, 0.75, f.RecentSyncParticipationRate())
+
+	f.SetBalancesByRooter(func(_ context.Context, _ [32]byte) ([]uint64, error) {
+		return []uint64{maxBalance, maxBalance}, nil
+	})
+	require.NoError(t, f.updateJustifiedBalances(ctx, params.BeaconConfig().ZeroHash))
+	require.Equal(t, float64(1), f.RecentSyncParticipationRate())
+}
+
+func TestForkChoice_OptimisticAndValidatedNodeCount(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	// Chain: 0 <- 1 <- 2 <- 3
+	//         \
+	//          ---- 4
+	st, blkRoot, err := prepareForkchoiceState(ctx, 1, indexToHash(1), params.BeaconConfig().ZeroHash, [32]byte{'A'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	st, blkRoot, err = prepareForkchoiceState(ctx, 2, indexToHash(2), indexToHash(1), [32]byte{'B'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	st, blkRoot, err = prepareForkchoiceState(ctx, 3, indexToHash(3), indexToHash(2), [32]byte{'C'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	st, blkRoot, err = prepareForkchoiceState(ctx, 2, indexToHash(4), params.BeaconConfig().ZeroHash, [32]byte{'D'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+
+	require.Equal(t, 5, f.OptimisticNodeCount())
+	require.Equal(t, 0, f.ValidatedNodeCount())
+
+	require.NoError(t, f.store.nodeByRoot[indexToHash(2)].setNodeAndParentValidated(ctx))
+	require.Equal(t, 2, f.OptimisticNodeCount())
+	require.Equal(t, 3, f.ValidatedNodeCount())
+	require.Equal(t, f.NodeCount(), f.OptimisticNodeCount()+f.ValidatedNodeCount())
+}
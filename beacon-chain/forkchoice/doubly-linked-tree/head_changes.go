@@ -0,0 +1,49 @@
+package doublylinkedtree
+
+import (
+	"sync"
+
+	fieldparams "github.com/prysmaticlabs/prysm/v4/config/fieldparams"
+)
+
+// headSubscriptions tracks the channels notified of head changes. It has its own lock so
+// that subscribers can unsubscribe without holding the fork choice lock.
+type headSubscriptions struct {
+	sync.Mutex
+	nextID      uint64
+	subscribers map[uint64]chan [fieldparams.RootLength]byte
+}
+
+// notify sends the new head root to every subscriber. The send does not block: a subscriber
+// that has not consumed the previous notification misses this one.
+func (hs *headSubscriptions) notify(root [fieldparams.RootLength]byte) {
+	hs.Lock()
+	defer hs.Unlock()
+	for _, c := range hs.subscribers {
+		select {
+		case c <- root:
+		default:
+		}
+	}
+}
+
+// SubscribeHeadChanges returns a channel that receives the new head root whenever the head
+// computed by fork choice changes, together with a function that unsubscribes and closes the
+// channel. Notifications are dropped for a subscriber that is not ready to receive them.
+func (f *ForkChoice) SubscribeHeadChanges() (<-chan [32]byte, func()) {
+	hs := f.store.headSubscriptions
+	hs.Lock()
+	defer hs.Unlock()
+	id := hs.nextID
+	hs.nextID++
+	c := make(chan [fieldparams.RootLength]byte, 1)
+	hs.subscribers[id] = c
+	return c, func() {
+		hs.Lock()
+		defer hs.Unlock()
+		if _, ok := hs.subscribers[id]; ok {
+			delete(hs.subscribers, id)
+			close(c)
+		}
+	}
+}
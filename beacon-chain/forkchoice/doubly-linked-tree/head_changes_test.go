@@ -0,0 +1,65 @@
+package doublylinkedtree
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prysmaticlabs/prysm/v4/config/params"
+	"github.com/prysmaticlabs/prysm/v4/testing/require"
+)
+
+func TestForkChoice_SubscribeHeadChanges(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	c, unsubscribe := f.SubscribeHeadChanges()
+
+	// Build the following tree, 1 is the head before the reorg to 2.
+	//
+	//  0 <- 1
+	//   \
+	//    -- 2
+	state, blkRoot, err := prepareForkchoiceState(ctx, 1, indexToHash(1), params.BeaconConfig().ZeroHash, indexToHash(1), 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 2, indexToHash(2), params.BeaconConfig().ZeroHash, indexToHash(2), 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	f.justifiedBalances = []uint64{10, 20}
+
+	f.ProcessAttestation(ctx, []uint64{0}, indexToHash(1), 2)
+	head, err := f.Head(ctx)
+	require.NoError(t, err)
+	require.Equal(t, indexToHash(1), head)
+	require.Equal(t, indexToHash(1), <-c)
+
+	// Head is unchanged, no notification.
+	head, err = f.Head(ctx)
+	require.NoError(t, err)
+	require.Equal(t, indexToHash(1), head)
+	require.Equal(t, 0, len(c))
+
+	// Reorg to 2.
+	f.ProcessAttestation(ctx, []uint64{1}, indexToHash(2), 2)
+	head, err = f.Head(ctx)
+	require.NoError(t, err)
+	require.Equal(t, indexToHash(2), head)
+	require.Equal(t, indexToHash(2), <-c)
+
+	unsubscribe()
+	_, ok := <-c
+	require.Equal(t, false, ok)
+	unsubscribe()
+	require.Equal(t, 0, len(f.store.headSubscriptions.subscribers))
+}
+
+func TestForkChoice_SubscribeHeadChanges_SlowSubscriber(t *testing.T) {
+	f := setup(1, 1)
+	c, unsubscribe := f.SubscribeHeadChanges()
+	defer unsubscribe()
+
+	// Notifications beyond the buffered one are dropped instead of blocking.
+	f.store.headSubscriptions.notify(indexToHash(1))
+	f.store.headSubscriptions.notify(indexToHash(2))
+	require.Equal(t, indexToHash(1), <-c)
+	require.Equal(t, 0, len(c))
+}
@@ -0,0 +1,99 @@
+package doublylinkedtree
+
+import (
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
+)
+
+// defaultHistoryRetention is the number of reorgs and invalidations kept by default.
+const defaultHistoryRetention = 16
+
+// historyRing keeps the most recent entries added to it up to its size, evicting the oldest
+// entry first once it is full.
+type historyRing[T any] struct {
+	entries []T
+	next    int
+	full    bool
+}
+
+func newHistoryRing[T any](size int) *historyRing[T] {
+	return &historyRing[T]{entries: make([]T, size)}
+}
+
+// add records the given entry, evicting the oldest one if the ring is full.
+func (r *historyRing[T]) add(e T) {
+	if len(r.entries) == 0 {
+		return
+	}
+	r.entries[r.next] = e
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// len returns the number of entries currently kept.
+func (r *historyRing[T]) len() int {
+	if r == nil {
+		return 0
+	}
+	if r.full {
+		return len(r.entries)
+	}
+	return r.next
+}
+
+// last returns up to n of the most recent entries, from the oldest to the most recent.
+func (r *historyRing[T]) last(n int) []T {
+	if n > r.len() {
+		n = r.len()
+	}
+	if n <= 0 {
+		return []T{}
+	}
+	res := make([]T, n)
+	start := r.next - n
+	if start < 0 {
+		start += len(r.entries)
+	}
+	for i := range res {
+		res[i] = r.entries[(start+i)%len(r.entries)]
+	}
+	return res
+}
+
+// resize returns a ring of the given size holding the most recent entries of this one.
+func (r *historyRing[T]) resize(size int) *historyRing[T] {
+	resized := newHistoryRing[T](size)
+	for _, e := range r.last(size) {
+		resized.add(e)
+	}
+	return resized
+}
+
+// SetHistoryRetention sets the number of reorgs and invalidations kept by ReorgHistory and
+// InvalidationHistory. The most recent entries are kept when the retention is reduced.
+func (f *ForkChoice) SetHistoryRetention(size int) error {
+	if size < 0 {
+		return errors.Errorf("invalid history retention %d", size)
+	}
+	f.store.reorgHistory = f.store.reorgHistory.resize(size)
+	f.store.invalidationHistory = f.store.invalidationHistory.resize(size)
+	return nil
+}
+
+// ReorgHistory returns the depths of up to the n most recent head changes that were reorgs, as
+// recorded by LastReorgDepth, from the oldest to the most recent.
+func (f *ForkChoice) ReorgHistory(n int) []primitives.Slot {
+	return f.store.reorgHistory.last(n)
+}
+
+// InvalidationHistory returns the roots removed by up to the n most recent calls to
+// SetOptimisticToInvalid that removed any node, from the oldest to the most recent.
+func (f *ForkChoice) InvalidationHistory(n int) [][][32]byte {
+	history := f.store.invalidationHistory.last(n)
+	for i, roots := range history {
+		history[i] = append([][32]byte{}, roots...)
+	}
+	return history
+}
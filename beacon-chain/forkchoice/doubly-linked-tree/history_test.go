@@ -0,0 +1,131 @@
+package doublylinkedtree
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prysmaticlabs/prysm/v4/config/params"
+	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
+	"github.com/prysmaticlabs/prysm/v4/testing/require"
+)
+
+func TestHistoryRing(t *testing.T) {
+	r := newHistoryRing[int](3)
+	require.DeepEqual(t, []int{}, r.last(3))
+
+	r.add(1)
+	r.add(2)
+	require.DeepEqual(t, []int{1, 2}, r.last(5))
+	require.DeepEqual(t, []int{2}, r.last(1))
+
+	// Exceeding the size evicts the oldest entries first.
+	r.add(3)
+	r.add(4)
+	r.add(5)
+	require.DeepEqual(t, []int{3, 4, 5}, r.last(3))
+	require.DeepEqual(t, []int{4, 5}, r.last(2))
+	require.DeepEqual(t, []int{}, r.last(0))
+
+	// Shrinking keeps the most recent entries.
+	r = r.resize(2)
+	require.DeepEqual(t, []int{4, 5}, r.last(3))
+	r.add(6)
+	require.DeepEqual(t, []int{5, 6}, r.last(2))
+
+	// Growing keeps all the entries.
+	r = r.resize(4)
+	r.add(7)
+	require.DeepEqual(t, []int{5, 6, 7}, r.last(4))
+
+	// A ring without size records nothing.
+	r = r.resize(0)
+	r.add(8)
+	require.DeepEqual(t, []int{}, r.last(1))
+}
+
+func TestForkChoice_ReorgHistory(t *testing.T) {
+	ctx := context.Background()
+	f := setup(0, 0)
+	f.justifiedBalances = []uint64{10, 10, 10}
+	f.numActiveValidators = 3
+	zeroHash := params.BeaconConfig().ZeroHash
+	require.NoError(t, f.SetHistoryRetention(2))
+
+	// Insert the following fork:
+	//         0
+	//        / \
+	//       1   3
+	//       |
+	//       2
+	for _, blk := range []struct {
+		slot   primitives.Slot
+		root   [32]byte
+		parent [32]byte
+	}{
+		{1, indexToHash(1), zeroHash},
+		{2, indexToHash(2), indexToHash(1)},
+		{3, indexToHash(3), zeroHash},
+	} {
+		state, blkRoot, err := prepareForkchoiceState(ctx, blk.slot, blk.root, blk.parent, zeroHash, 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	}
+	f.store.proposerBoostRoot = [32]byte{}
+	require.DeepEqual(t, []primitives.Slot{}, f.ReorgHistory(2))
+
+	validators := []uint64{0, 1, 2}
+	for i, target := range [][32]byte{indexToHash(2), indexToHash(3), indexToHash(2), indexToHash(3)} {
+		f.ProcessAttestation(ctx, validators, target, primitives.Epoch(i+1))
+		headRoot, err := f.Head(ctx)
+		require.NoError(t, err)
+		require.Equal(t, target, headRoot)
+	}
+	// The reorgs had depths 2, 3 and 2, the oldest one is evicted.
+	require.DeepEqual(t, []primitives.Slot{3, 2}, f.ReorgHistory(5))
+	require.DeepEqual(t, []primitives.Slot{2}, f.ReorgHistory(1))
+
+	// Extending the head is not recorded.
+	state, blkRoot, err := prepareForkchoiceState(ctx, 4, indexToHash(4), indexToHash(3), zeroHash, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	f.store.proposerBoostRoot = [32]byte{}
+	headRoot, err := f.Head(ctx)
+	require.NoError(t, err)
+	require.Equal(t, indexToHash(4), headRoot)
+	require.DeepEqual(t, []primitives.Slot{3, 2}, f.ReorgHistory(2))
+}
+
+func TestForkChoice_InvalidationHistory(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	require.NoError(t, f.SetHistoryRetention(2))
+	require.ErrorContains(t, "invalid history retention", f.SetHistoryRetention(-1))
+
+	// Every node is a direct child of a, so each invalidation removes a single node.
+	state, blkRoot, err := prepareForkchoiceState(ctx, 100, [32]byte{'a'}, params.BeaconConfig().ZeroHash, [32]byte{'A'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	children := [][32]byte{{'b'}, {'c'}, {'d'}}
+	for i, root := range children {
+		state, blkRoot, err := prepareForkchoiceState(ctx, primitives.Slot(101+i), root, [32]byte{'a'}, [32]byte{byte('B' + i)}, 1, 1)
+		require.NoError(t, err)
+		require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	}
+	require.DeepEqual(t, [][][32]byte{}, f.InvalidationHistory(2))
+
+	for _, root := range children {
+		roots, err := f.SetOptimisticToInvalid(ctx, root, [32]byte{'a'}, [32]byte{'A'})
+		require.NoError(t, err)
+		require.DeepEqual(t, [][32]byte{root}, roots)
+	}
+	// An invalidation that removes nothing is not recorded.
+	_, err = f.SetOptimisticToInvalid(ctx, [32]byte{'d'}, [32]byte{'a'}, [32]byte{'A'})
+	require.NoError(t, err)
+
+	require.DeepEqual(t, [][][32]byte{{{'c'}}, {{'d'}}}, f.InvalidationHistory(3))
+	require.DeepEqual(t, [][][32]byte{{{'d'}}}, f.InvalidationHistory(1))
+
+	// The returned roots are a copy.
+	f.InvalidationHistory(1)[0][0] = [32]byte{'z'}
+	require.DeepEqual(t, [][][32]byte{{{'d'}}}, f.InvalidationHistory(1))
+}
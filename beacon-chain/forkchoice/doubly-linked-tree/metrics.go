@@ -51,4 +51,29 @@ var (
 			Help: "The number of times pruning happened.",
 		},
 	)
+	proposerBoostAppliedCount = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "doublylinkedtree_proposer_boost_applied_count",
+			Help: "The number of times proposer boost was applied to a new root, labeled by whether a previous boost was reversed.",
+		},
+		[]string{"reversed"},
+	)
+	proposerBoostScore = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "doublylinkedtree_proposer_boost_score",
+			Help: "The proposer boost score currently applied in fork choice.",
+		},
+	)
+	treeDepth = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "doublylinkedtree_tree_depth",
+			Help: "The number of nodes in the longest path from the tree root to a leaf.",
+		},
+	)
+	treeWidth = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "doublylinkedtree_tree_width",
+			Help: "The highest number of nodes at any single slot.",
+		},
+	)
 )
@@ -5,6 +5,7 @@ import (
 	"context"
 
 	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/prysm/v4/config/features"
 	"github.com/prysmaticlabs/prysm/v4/config/params"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
 	v1 "github.com/prysmaticlabs/prysm/v4/proto/eth/v1"
@@ -15,9 +16,13 @@ import (
 // consider a block to be late, and thus a candidate to being reorged.
 const orphanLateBlockFirstThreshold = 4
 
-// ProcessAttestationsThreshold  is the number of seconds after which we
-// process attestations for the current slot
-const ProcessAttestationsThreshold = 10
+// ProcessAttestationsThreshold is the number of seconds after which we
+// process attestations for the current slot. It is the start of the last half
+// interval of the slot, 10 seconds on mainnet.
+func ProcessAttestationsThreshold() uint64 {
+	halfIntervals := 2 * params.BeaconConfig().IntervalsPerSlot
+	return params.BeaconConfig().SecondsPerSlot * (halfIntervals - 1) / halfIntervals
+}
 
 // applyWeightChanges recomputes the weight of the node passed as an argument and all of its descendants,
 // using the current balance stored in each node.
@@ -33,16 +38,28 @@ func (n *Node) applyWeightChanges(ctx context.Context) error {
 		}
 		childrenWeight += child.weight
 	}
-	if n.root == params.BeaconConfig().ZeroHash {
+	if n.isVirtualRoot() {
 		return nil
 	}
 	n.weight = n.balance + childrenWeight
 	return nil
 }
 
+// isVirtualRoot returns true if this node is the synthetic node with the zero hash root, which
+// is not a block and must not show up in weights, tips, dumps or as a best descendant.
+func (n *Node) isVirtualRoot() bool {
+	return n.root == params.BeaconConfig().ZeroHash
+}
+
 // updateBestDescendant updates the best descendant of this node and its
 // children.
 func (n *Node) updateBestDescendant(ctx context.Context, justifiedEpoch, finalizedEpoch, currentEpoch primitives.Epoch) error {
+	return n.updateBestDescendants(ctx, justifiedEpoch, finalizedEpoch, currentEpoch, !features.Get().DisableForkchoiceSlotTieBreak)
+}
+
+// updateBestDescendants updates the best descendant of this node and its
+// children, breaking ties by head slot first when slotTieBreak is set.
+func (n *Node) updateBestDescendants(ctx context.Context, justifiedEpoch, finalizedEpoch, currentEpoch primitives.Epoch, slotTieBreak bool) error {
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
@@ -51,46 +68,78 @@ func (n *Node) updateBestDescendant(ctx context.Context, justifiedEpoch, finaliz
 		return nil
 	}
 
-	var bestChild *Node
-	bestWeight := uint64(0)
-	hasViableDescendant := false
 	for _, child := range n.children {
 		if child == nil {
 			return errors.Wrap(ErrNilNode, "could not update best descendant")
 		}
-		if err := child.updateBestDescendant(ctx, justifiedEpoch, finalizedEpoch, currentEpoch); err != nil {
+		if err := child.updateBestDescendants(ctx, justifiedEpoch, finalizedEpoch, currentEpoch, slotTieBreak); err != nil {
 			return err
 		}
-		childLeadsToViableHead := child.leadsToViableHead(justifiedEpoch, currentEpoch)
-		if childLeadsToViableHead && !hasViableDescendant {
-			// The child leads to a viable head, but the current
-			// parent's best child doesn't.
-			bestWeight = child.weight
+	}
+	n.setBestDescendant(justifiedEpoch, currentEpoch, slotTieBreak)
+	return nil
+}
+
+// setBestDescendant sets the best descendant of this node from the cached
+// best descendants of its children. The best child is the heaviest one that
+// leads to a viable head. Ties are broken by the lower head slot when
+// slotTieBreak is set, and then by the higher root, so that the selection does
+// not depend on the order of the children.
+func (n *Node) setBestDescendant(justifiedEpoch, currentEpoch primitives.Epoch, slotTieBreak bool) {
+	var bestChild *Node
+	for _, child := range n.children {
+		if child.isVirtualRoot() || !child.leadsToViableHead(justifiedEpoch, currentEpoch) {
+			continue
+		}
+		if bestChild == nil || child.weight > bestChild.weight {
 			bestChild = child
-			hasViableDescendant = true
-		} else if childLeadsToViableHead {
-			// If both are viable, compare their weights.
-			if child.weight == bestWeight {
-				// Tie-breaker of equal weights by root.
-				if bytes.Compare(child.root[:], bestChild.root[:]) > 0 {
+			continue
+		}
+		if child.weight < bestChild.weight {
+			continue
+		}
+		if slotTieBreak {
+			if cs, bs := child.headSlot(), bestChild.headSlot(); cs != bs {
+				if cs < bs {
 					bestChild = child
 				}
-			} else if child.weight > bestWeight {
-				bestChild = child
-				bestWeight = child.weight
+				continue
 			}
 		}
-	}
-	if hasViableDescendant {
-		if bestChild.bestDescendant == nil {
-			n.bestDescendant = bestChild
-		} else {
-			n.bestDescendant = bestChild.bestDescendant
+		if bytes.Compare(child.root[:], bestChild.root[:]) > 0 {
+			bestChild = child
 		}
-	} else {
+	}
+	if bestChild == nil {
 		n.bestDescendant = nil
+	} else if bestChild.bestDescendant == nil {
+		n.bestDescendant = bestChild
+	} else {
+		n.bestDescendant = bestChild.bestDescendant
 	}
-	return nil
+}
+
+// headSlot returns the slot of the best descendant of this node, or its own
+// slot if it has none.
+func (n *Node) headSlot() primitives.Slot {
+	if n.bestDescendant == nil {
+		return n.slot
+	}
+	return n.bestDescendant.slot
+}
+
+// clone returns a copy of the subtree rooted at this node, attached to the given parent.
+// Every copied node is recorded in nodeByRoot. Best descendants are not copied.
+func (n *Node) clone(parent *Node, nodeByRoot map[[32]byte]*Node) *Node {
+	c := *n
+	c.parent = parent
+	c.bestDescendant = nil
+	c.children = make([]*Node, len(n.children))
+	for i, child := range n.children {
+		c.children[i] = child.clone(&c, nodeByRoot)
+	}
+	nodeByRoot[c.root] = &c
+	return &c
 }
 
 // viableForHead returns true if the node is viable to head.
@@ -136,25 +185,46 @@ func (n *Node) setNodeAndParentValidated(ctx context.Context) error {
 // inequality < here. For example a block that arrives 3.9999 seconds into the
 // slot will have secs = 3 below.
 func (n *Node) arrivedEarly(genesisTime uint64) (bool, error) {
-	secs, err := slots.SecondsSinceSlotStart(n.slot, genesisTime, n.timestamp)
+	secs, err := n.secondsIntoSlot(genesisTime)
 	return secs < orphanLateBlockFirstThreshold, err
 }
 
 // arrivedAfterOrphanCheck returns whether this block was inserted after the
 // intermediate checkpoint to check for candidate of being orphaned.
 // Note that genesisTime has seconds granularity, therefore we use an
-// inequality >= here. For example a block that arrives 10.00001 seconds into the
-// slot will have secs = 10 below.
+// inequality >= here. For example a block that arrives 10.00001 seconds into a
+// mainnet slot will have secs = 10 below.
 func (n *Node) arrivedAfterOrphanCheck(genesisTime uint64) (bool, error) {
-	secs, err := slots.SecondsSinceSlotStart(n.slot, genesisTime, n.timestamp)
-	return secs >= ProcessAttestationsThreshold, err
+	secs, err := n.secondsIntoSlot(genesisTime)
+	return secs >= ProcessAttestationsThreshold(), err
+}
+
+// secondsIntoSlot returns the number of seconds into its slot at which this
+// node was inserted.
+func (n *Node) secondsIntoSlot(genesisTime uint64) (uint64, error) {
+	return slots.SecondsSinceSlotStart(n.slot, genesisTime, n.timestamp)
 }
 
-// nodeTreeDump appends to the given list all the nodes descending from this one
+// nodeTreeDump appends to the given list all the nodes descending from this one, leaving out the zero hash root
 func (n *Node) nodeTreeDump(ctx context.Context, nodes []*v1.ForkChoiceNode) ([]*v1.ForkChoiceNode, error) {
 	if ctx.Err() != nil {
 		return nil, ctx.Err()
 	}
+	if !n.isVirtualRoot() {
+		nodes = append(nodes, n.dump())
+	}
+	var err error
+	for _, child := range n.children {
+		nodes, err = child.nodeTreeDump(ctx, nodes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+// dump converts this node to its API representation.
+func (n *Node) dump() *v1.ForkChoiceNode {
 	var parentRoot [32]byte
 	if n.parent != nil {
 		parentRoot = n.parent.root
@@ -172,20 +242,12 @@ func (n *Node) nodeTreeDump(ctx context.Context, nodes []*v1.ForkChoiceNode) ([]
 		ExecutionOptimistic:      n.optimistic,
 		ExecutionBlockHash:       n.payloadHash[:],
 		Timestamp:                n.timestamp,
+		FirstSeenSecsIntoSlot:    n.firstSeenSecsIntoSlot,
 	}
 	if n.optimistic {
 		thisNode.Validity = v1.ForkChoiceNodeValidity_OPTIMISTIC
 	} else {
 		thisNode.Validity = v1.ForkChoiceNodeValidity_VALID
 	}
-
-	nodes = append(nodes, thisNode)
-	var err error
-	for _, child := range n.children {
-		nodes, err = child.nodeTreeDump(ctx, nodes)
-		if err != nil {
-			return nil, err
-		}
-	}
-	return nodes, nil
+	return thisNode
 }
@@ -1,9 +1,11 @@
 package doublylinkedtree
 
 import (
+	"bytes"
 	"context"
 	"testing"
 
+	"github.com/prysmaticlabs/prysm/v4/config/features"
 	"github.com/prysmaticlabs/prysm/v4/config/params"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
 	v1 "github.com/prysmaticlabs/prysm/v4/proto/eth/v1"
@@ -136,6 +138,62 @@ func TestNode_UpdateBestDescendant_LowerWeightChild(t *testing.T) {
 	assert.Equal(t, s.treeRootNode.children[0], s.treeRootNode.bestDescendant)
 }
 
+func TestNode_UpdateBestDescendant_InsertionOrder(t *testing.T) {
+	ctx := context.Background()
+	weights := map[uint64]uint64{1: 100, 2: 200, 3: 200, 4: 50}
+	orders := [][]uint64{{1, 2, 3, 4}, {4, 3, 2, 1}, {3, 1, 4, 2}}
+	for _, order := range orders {
+		f := setup(1, 1)
+		for _, i := range order {
+			state, blkRoot, err := prepareForkchoiceState(ctx, primitives.Slot(i), indexToHash(i), params.BeaconConfig().ZeroHash, params.BeaconConfig().ZeroHash, 1, 1)
+			require.NoError(t, err)
+			require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+		}
+		s := f.store
+		for i, w := range weights {
+			s.nodeByRoot[indexToHash(i)].weight = w
+		}
+		require.NoError(t, s.treeRootNode.updateBestDescendant(ctx, 1, 1, 1))
+		want, other := indexToHash(2), indexToHash(3)
+		if bytes.Compare(other[:], want[:]) > 0 {
+			want = other
+		}
+		require.Equal(t, want, s.treeRootNode.bestDescendant.root)
+	}
+}
+
+func TestNode_UpdateBestDescendant_SlotTieBreak(t *testing.T) {
+	ctx := context.Background()
+	setupTree := func() *ForkChoice {
+		f := setup(1, 1)
+		// The child with the higher root is at the higher slot.
+		low, high := indexToHash(1), indexToHash(2)
+		if bytes.Compare(low[:], high[:]) > 0 {
+			low, high = high, low
+		}
+		state, blkRoot, err := prepareForkchoiceState(ctx, 1, low, params.BeaconConfig().ZeroHash, [32]byte{'A'}, 1, 1)
+		require.NoError(t, err)
+		require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+		state, blkRoot, err = prepareForkchoiceState(ctx, 2, high, params.BeaconConfig().ZeroHash, [32]byte{'B'}, 1, 1)
+		require.NoError(t, err)
+		require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+		f.store.nodeByRoot[low].weight = 100
+		f.store.nodeByRoot[high].weight = 100
+		require.NoError(t, f.store.treeRootNode.updateBestDescendant(ctx, 1, 1, 1))
+		return f
+	}
+
+	f := setupTree()
+	require.Equal(t, primitives.Slot(1), f.store.treeRootNode.bestDescendant.slot)
+
+	resetCfg := features.InitWithReset(&features.Flags{
+		DisableForkchoiceSlotTieBreak: true,
+	})
+	defer resetCfg()
+	f = setupTree()
+	require.Equal(t, primitives.Slot(2), f.store.treeRootNode.bestDescendant.slot)
+}
+
 func TestNode_ViableForHead(t *testing.T) {
 	tests := []struct {
 		n              *Node
@@ -240,9 +298,11 @@ func TestNode_SetFullyValidated(t *testing.T) {
 	respNodes := make([]*v1.ForkChoiceNode, 0)
 	respNodes, err = f.store.treeRootNode.nodeTreeDump(ctx, respNodes)
 	require.NoError(t, err)
-	require.Equal(t, len(respNodes), f.NodeCount())
+	// The zero hash tree root is left out of the dump.
+	require.Equal(t, len(respNodes), f.NodeCount()-1)
 
 	for i, respNode := range respNodes {
+		i := i + 1
 		require.Equal(t, storeNodes[i].slot, respNode.Slot)
 		require.DeepEqual(t, storeNodes[i].root[:], respNode.BlockRoot)
 		require.Equal(t, storeNodes[i].balance, respNode.Balance)
@@ -294,7 +354,7 @@ func TestNode_TimeStampsChecks(t *testing.T) {
 	require.Equal(t, false, late)
 
 	// very late block
-	driftGenesisTime(f, 3, ProcessAttestationsThreshold+1)
+	driftGenesisTime(f, 3, ProcessAttestationsThreshold()+1)
 	root = [32]byte{'c'}
 	state, blkRoot, err = prepareForkchoiceState(ctx, 3, root, [32]byte{'b'}, [32]byte{'C'}, 0, 0)
 	require.NoError(t, err)
@@ -324,3 +384,84 @@ func TestNode_TimeStampsChecks(t *testing.T) {
 	require.ErrorContains(t, "invalid timestamp", err)
 	require.Equal(t, false, late)
 }
+
+func TestNode_ArrivedAfterOrphanCheck_Config(t *testing.T) {
+	params.SetupTestConfigCleanup(t)
+	genesisTime := uint64(1000)
+
+	// mainnet
+	require.Equal(t, uint64(10), ProcessAttestationsThreshold())
+	n := &Node{slot: 1, timestamp: genesisTime + 12 + 9}
+	late, err := n.arrivedAfterOrphanCheck(genesisTime)
+	require.NoError(t, err)
+	require.Equal(t, false, late)
+	n.timestamp = genesisTime + 12 + 10
+	late, err = n.arrivedAfterOrphanCheck(genesisTime)
+	require.NoError(t, err)
+	require.Equal(t, true, late)
+
+	// short slots
+	cfg := params.BeaconConfig().Copy()
+	cfg.SecondsPerSlot = 6
+	params.OverrideBeaconConfig(cfg)
+	require.Equal(t, uint64(5), ProcessAttestationsThreshold())
+	n = &Node{slot: 1, timestamp: genesisTime + 6 + 4}
+	late, err = n.arrivedAfterOrphanCheck(genesisTime)
+	require.NoError(t, err)
+	require.Equal(t, false, late)
+	n.timestamp = genesisTime + 6 + 5
+	late, err = n.arrivedAfterOrphanCheck(genesisTime)
+	require.NoError(t, err)
+	require.Equal(t, true, late)
+}
+
+func TestNode_FirstSeenSecsIntoSlot(t *testing.T) {
+	f := setup(0, 0)
+	ctx := context.Background()
+
+	// early block
+	driftGenesisTime(f, 1, 1)
+	state, blkRoot, err := prepareForkchoiceState(ctx, 1, [32]byte{'a'}, params.BeaconConfig().ZeroHash, [32]byte{'A'}, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	secs := f.store.nodeByRoot[[32]byte{'a'}].firstSeenSecsIntoSlot
+	require.Equal(t, true, secs >= 1 && secs < orphanLateBlockFirstThreshold)
+
+	// late block
+	driftGenesisTime(f, 2, ProcessAttestationsThreshold()+1)
+	state, blkRoot, err = prepareForkchoiceState(ctx, 2, [32]byte{'b'}, [32]byte{'a'}, [32]byte{'B'}, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	secs = f.store.nodeByRoot[[32]byte{'b'}].firstSeenSecsIntoSlot
+	require.Equal(t, true, secs >= ProcessAttestationsThreshold()+1)
+
+	// block from the future
+	state, blkRoot, err = prepareForkchoiceState(ctx, 5, [32]byte{'c'}, [32]byte{'b'}, [32]byte{'C'}, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	require.Equal(t, uint64(0), f.store.nodeByRoot[[32]byte{'c'}].firstSeenSecsIntoSlot)
+}
+
+func TestForkChoice_FirstSeenSecsIntoSlot(t *testing.T) {
+	ctx := context.Background()
+	f := setup(0, 0)
+	driftGenesisTime(f, 1, 2)
+	state, blkRoot, err := prepareForkchoiceState(ctx, 1, [32]byte{'a'}, params.BeaconConfig().ZeroHash, [32]byte{'A'}, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+
+	secs, err := f.FirstSeenSecsIntoSlot([32]byte{'a'})
+	require.NoError(t, err)
+	require.Equal(t, true, secs >= 2 && secs < params.BeaconConfig().SecondsPerSlot)
+	require.Equal(t, secs, f.store.nodeByRoot[[32]byte{'a'}].dump().FirstSeenSecsIntoSlot)
+	dump, err := f.ForkChoiceDump(ctx)
+	require.NoError(t, err)
+	for _, n := range dump.ForkChoiceNodes {
+		if bytes.Equal(n.BlockRoot, blkRoot[:]) {
+			require.Equal(t, secs, n.FirstSeenSecsIntoSlot)
+		}
+	}
+
+	_, err = f.FirstSeenSecsIntoSlot([32]byte{'b'})
+	require.ErrorIs(t, err, ErrNilNode)
+}
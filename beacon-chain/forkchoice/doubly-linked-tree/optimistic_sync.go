@@ -5,6 +5,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/prysmaticlabs/prysm/v4/config/params"
+	"github.com/prysmaticlabs/prysm/v4/time/slots"
 )
 
 func (s *Store) setOptimisticToInvalid(ctx context.Context, root, parentRoot, lastValidHash [32]byte) ([][32]byte, error) {
@@ -12,8 +13,9 @@ func (s *Store) setOptimisticToInvalid(ctx context.Context, root, parentRoot, la
 	node, ok := s.nodeByRoot[root]
 	if !ok {
 		node, ok = s.nodeByRoot[parentRoot]
+		// return early if the branch has already been removed
 		if !ok || node == nil {
-			return invalidRoots, errors.Wrap(ErrNilNode, "could not set node to invalid")
+			return invalidRoots, nil
 		}
 		// return early if the parent is LVH
 		if node.payloadHash == lastValidHash {
@@ -45,6 +47,30 @@ func (s *Store) setOptimisticToInvalid(ctx context.Context, root, parentRoot, la
 	return s.removeNode(ctx, firstInvalid)
 }
 
+// setValidatedByPayloadHashes marks the nodes with the given payload hashes and
+// all their ancestors as validated. A walk stops at the first ancestor that is
+// already validated, so ancestors shared by several of the nodes are only
+// visited once. No node is modified if any of the payload hashes is unknown.
+func (s *Store) setValidatedByPayloadHashes(ctx context.Context, hashes [][32]byte) error {
+	nodes := make([]*Node, 0, len(hashes))
+	for _, h := range hashes {
+		node, ok := s.nodeByPayload[h]
+		if !ok || node == nil {
+			return errors.Wrapf(ErrNilNode, "could not set node with payload hash %#x to valid", h)
+		}
+		nodes = append(nodes, node)
+	}
+	for _, node := range nodes {
+		for n := node; n != nil && n.optimistic; n = n.parent {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			n.optimistic = false
+		}
+	}
+	return nil
+}
+
 // removeNode removes the node with the given root and all of its children
 // from the Fork Choice Store.
 func (s *Store) removeNode(ctx context.Context, node *Node) ([][32]byte, error) {
@@ -57,21 +83,114 @@ func (s *Store) removeNode(ctx context.Context, node *Node) ([][32]byte, error)
 		return invalidRoots, errInvalidOptimisticStatus
 	}
 
-	children := node.parent.children
+	node.detachFromParent()
+	return s.removeNodeAndChildren(ctx, node, invalidRoots)
+}
+
+// forceRemoveSubtree removes the node with the given root and all of its
+// descendants from the Store regardless of their optimistic status. It is
+// meant for administrative pruning of known bad forks and refuses to remove the
+// finalized or justified checkpoint or any of their ancestors. The head and the
+// highest received node are moved to the parent of the subtree if they were in it.
+func (s *Store) forceRemoveSubtree(ctx context.Context, root [32]byte) ([][32]byte, error) {
+	invalidRoots := make([][32]byte, 0)
+	node, ok := s.nodeByRoot[root]
+	if !ok || node == nil {
+		return invalidRoots, errors.Wrap(ErrNilNode, "could not remove subtree")
+	}
+	if node.parent == nil {
+		return invalidRoots, errors.Wrap(errInvalidParentRoot, "could not remove the tree root")
+	}
+	if s.isAncestorOrSelf(node, s.finalizedCheckpoint.Root) {
+		return invalidRoots, errors.Wrap(errInvalidFinalizedNode, "could not remove the finalized node or its ancestors")
+	}
+	if s.isAncestorOrSelf(node, s.justifiedCheckpoint.Root) {
+		return invalidRoots, errors.Wrap(errInvalidJustifiedNode, "could not remove the justified node or its ancestors")
+	}
+	parent := node.parent
+	node.detachFromParent()
+	invalidRoots, err := s.removeNodeAndChildren(ctx, node, invalidRoots)
+	if s.headNode != nil && s.nodeByRoot[s.headNode.root] != s.headNode {
+		s.headNode = parent
+	}
+	if s.highestReceivedNode != nil && s.nodeByRoot[s.highestReceivedNode.root] != s.highestReceivedNode {
+		s.highestReceivedNode = parent
+	}
+	return invalidRoots, err
+}
+
+// isAncestorOrSelf returns true if node is the node with the given root or one of its ancestors.
+func (s *Store) isAncestorOrSelf(node *Node, root [32]byte) bool {
+	for n := s.nodeByRoot[root]; n != nil; n = n.parent {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+// detachAndReparent removes the node with the given root from the Store and attaches its
+// children to its parent, so that its descendants are kept. The weights and best descendants
+// of the tree are then recomputed. It refuses to detach the tree root or the finalized node.
+func (s *Store) detachAndReparent(ctx context.Context, root [32]byte) error {
+	node, ok := s.nodeByRoot[root]
+	if !ok || node == nil {
+		return errors.Wrap(ErrNilNode, "could not detach node")
+	}
+	if node.parent == nil {
+		return errors.Wrap(errInvalidParentRoot, "could not detach the tree root")
+	}
+	if root == s.finalizedCheckpoint.Root {
+		return errors.Wrap(errInvalidFinalizedNode, "could not detach the finalized node")
+	}
+	parent := node.parent
+	node.detachFromParent()
+	for _, child := range node.children {
+		child.parent = parent
+		parent.children = append(parent.children, child)
+	}
+	node.children = nil
+	if s.headNode == node {
+		s.headNode = parent
+	}
+	if s.highestReceivedNode == node {
+		s.highestReceivedNode = parent
+	}
+	if root == s.proposerBoostRoot {
+		s.proposerBoostRoot = [32]byte{}
+	}
+	if root == s.previousProposerBoostRoot {
+		s.previousProposerBoostRoot = params.BeaconConfig().ZeroHash
+		s.previousProposerBoostScore = 0
+	}
+	delete(s.nodeByRoot, node.root)
+	delete(s.nodeByPayload, node.payloadHash)
+	s.removeFromSlotIndex(node)
+	s.mutationVersion++
+
+	if err := s.treeRootNode.applyWeightChanges(ctx); err != nil {
+		return errors.Wrap(err, "could not apply weight changes")
+	}
+	currentEpoch := slots.ToEpoch(slots.CurrentSlot(s.genesisTime))
+	return s.treeRootNode.updateBestDescendant(ctx, s.justifiedCheckpoint.Epoch, s.finalizedCheckpoint.Epoch, currentEpoch)
+}
+
+// detachFromParent removes this node from its parent's list of children.
+func (n *Node) detachFromParent() {
+	children := n.parent.children
 	if len(children) == 1 {
-		node.parent.children = []*Node{}
-	} else {
-		for i, n := range children {
-			if n == node {
-				if i != len(children)-1 {
-					children[i] = children[len(children)-1]
-				}
-				node.parent.children = children[:len(children)-1]
-				break
+		n.parent.children = []*Node{}
+		return
+	}
+	for i, child := range children {
+		if child == n {
+			if i != len(children)-1 {
+				children[i] = children[len(children)-1]
 			}
+			n.parent.children = children[:len(children)-1]
+			return
 		}
 	}
-	return s.removeNodeAndChildren(ctx, node, invalidRoots)
 }
 
 // removeNodeAndChildren removes `node` and all of its descendant from the Store
@@ -95,5 +214,43 @@ func (s *Store) removeNodeAndChildren(ctx context.Context, node *Node, invalidRo
 	}
 	delete(s.nodeByRoot, node.root)
 	delete(s.nodeByPayload, node.payloadHash)
+	s.removeFromSlotIndex(node)
+	s.mutationVersion++
 	return invalidRoots, nil
 }
+
+// LongestOptimisticChain returns the length of the longest chain of consecutive optimistic
+// nodes in the Store, together with the root of its tip. It returns a zero length if no node
+// is optimistic.
+func (f *ForkChoice) LongestOptimisticChain() (int, [32]byte, error) {
+	if f.store.treeRootNode == nil {
+		return 0, [32]byte{}, errors.Wrap(ErrNilNode, "could not get longest optimistic chain")
+	}
+	length, tip := f.store.treeRootNode.longestOptimisticChain(0)
+	if tip == nil {
+		return 0, [32]byte{}, nil
+	}
+	return length, tip.root, nil
+}
+
+// longestOptimisticChain returns the longest chain of optimistic nodes ending in the subtree
+// of this node and its tip. The length argument is the number of optimistic ancestors
+// immediately preceding this node.
+func (n *Node) longestOptimisticChain(length int) (int, *Node) {
+	if !n.optimistic {
+		length = 0
+	} else {
+		length++
+	}
+	bestLength, bestTip := 0, (*Node)(nil)
+	if length > 0 {
+		bestLength, bestTip = length, n
+	}
+	for _, child := range n.children {
+		childLength, childTip := child.longestOptimisticChain(length)
+		if childLength > bestLength {
+			bestLength, bestTip = childLength, childTip
+		}
+	}
+	return bestLength, bestTip
+}
@@ -5,7 +5,9 @@ import (
 	"sort"
 	"testing"
 
+	forkchoicetypes "github.com/prysmaticlabs/prysm/v4/beacon-chain/forkchoice/types"
 	"github.com/prysmaticlabs/prysm/v4/config/params"
+	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
 	"github.com/prysmaticlabs/prysm/v4/encoding/bytesutil"
 	"github.com/prysmaticlabs/prysm/v4/testing/require"
 )
@@ -385,6 +387,297 @@ func TestSetOptimisticToInvalid_ForkAtMerge_bis(t *testing.T) {
 	require.DeepEqual(t, roots, [][32]byte{{'b'}, {'c'}, {'d'}, {'e'}})
 }
 
+//     ----- C <- D
+//   /
+//  A <- B
+//
+// C and D are fully validated and are forcefully removed
+
+func TestStore_ForceRemoveSubtree(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+
+	state, blkRoot, err := prepareForkchoiceState(ctx, 100, [32]byte{'a'}, params.BeaconConfig().ZeroHash, [32]byte{'A'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 101, [32]byte{'b'}, [32]byte{'a'}, [32]byte{'B'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 101, [32]byte{'c'}, [32]byte{'a'}, [32]byte{'C'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 102, [32]byte{'d'}, [32]byte{'c'}, [32]byte{'D'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	require.NoError(t, f.SetOptimisticToValid(ctx, [32]byte{'d'}))
+	f.store.proposerBoostRoot = [32]byte{'d'}
+	f.store.previousProposerBoostRoot = [32]byte{'c'}
+	f.store.previousProposerBoostScore = 10
+
+	_, err = f.store.removeNode(ctx, f.store.nodeByRoot[[32]byte{'c'}])
+	require.ErrorIs(t, err, errInvalidOptimisticStatus)
+
+	removed, err := f.store.forceRemoveSubtree(ctx, [32]byte{'c'})
+	require.NoError(t, err)
+	require.DeepEqual(t, [][32]byte{{'d'}, {'c'}}, removed)
+	require.Equal(t, 3, len(f.store.nodeByRoot))
+	require.Equal(t, 3, len(f.store.nodeByPayload))
+	_, ok := f.store.nodeByPayload[[32]byte{'C'}]
+	require.Equal(t, false, ok)
+	_, ok = f.store.nodeByPayload[[32]byte{'D'}]
+	require.Equal(t, false, ok)
+	require.DeepEqual(t, [32]byte{}, f.store.proposerBoostRoot)
+	require.DeepEqual(t, params.BeaconConfig().ZeroHash, f.store.previousProposerBoostRoot)
+	require.Equal(t, uint64(0), f.store.previousProposerBoostScore)
+	parent := f.store.nodeByRoot[[32]byte{'a'}]
+	require.Equal(t, 1, len(parent.children))
+	require.Equal(t, [32]byte{'b'}, parent.children[0].root)
+
+	_, err = f.store.forceRemoveSubtree(ctx, [32]byte{'c'})
+	require.ErrorIs(t, err, ErrNilNode)
+	_, err = f.store.forceRemoveSubtree(ctx, f.store.treeRootNode.root)
+	require.ErrorIs(t, err, errInvalidParentRoot)
+}
+
+func TestStore_ForceRemoveSubtree_Checkpoints(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	//   0 <- a <- b
+	//         \
+	//          c <- d
+	state, blkRoot, err := prepareForkchoiceState(ctx, 100, [32]byte{'a'}, params.BeaconConfig().ZeroHash, [32]byte{'A'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 101, [32]byte{'b'}, [32]byte{'a'}, [32]byte{'B'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 101, [32]byte{'c'}, [32]byte{'a'}, [32]byte{'C'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 102, [32]byte{'d'}, [32]byte{'c'}, [32]byte{'D'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+
+	f.store.finalizedCheckpoint = &forkchoicetypes.Checkpoint{Epoch: 1, Root: [32]byte{'c'}}
+	_, err = f.store.forceRemoveSubtree(ctx, [32]byte{'c'})
+	require.ErrorIs(t, err, errInvalidFinalizedNode)
+	f.store.finalizedCheckpoint = &forkchoicetypes.Checkpoint{Epoch: 1, Root: [32]byte{'d'}}
+	_, err = f.store.forceRemoveSubtree(ctx, [32]byte{'c'})
+	require.ErrorIs(t, err, errInvalidFinalizedNode)
+
+	f.store.finalizedCheckpoint = &forkchoicetypes.Checkpoint{Epoch: 1, Root: [32]byte{'a'}}
+	f.store.justifiedCheckpoint = &forkchoicetypes.Checkpoint{Epoch: 1, Root: [32]byte{'c'}}
+	_, err = f.store.forceRemoveSubtree(ctx, [32]byte{'c'})
+	require.ErrorIs(t, err, errInvalidJustifiedNode)
+	f.store.justifiedCheckpoint = &forkchoicetypes.Checkpoint{Epoch: 1, Root: [32]byte{'d'}}
+	_, err = f.store.forceRemoveSubtree(ctx, [32]byte{'c'})
+	require.ErrorIs(t, err, errInvalidJustifiedNode)
+	require.Equal(t, 5, len(f.store.nodeByRoot))
+
+	// Checkpoints outside of the subtree do not prevent its removal.
+	f.store.justifiedCheckpoint = &forkchoicetypes.Checkpoint{Epoch: 1, Root: [32]byte{'b'}}
+	removed, err := f.store.forceRemoveSubtree(ctx, [32]byte{'c'})
+	require.NoError(t, err)
+	require.DeepEqual(t, [][32]byte{{'d'}, {'c'}}, removed)
+}
+
+func TestStore_ForceRemoveSubtree_HeadNode(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	//   0 <- a <- b
+	//         \
+	//          c <- d
+	state, blkRoot, err := prepareForkchoiceState(ctx, 100, [32]byte{'a'}, params.BeaconConfig().ZeroHash, [32]byte{'A'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 101, [32]byte{'b'}, [32]byte{'a'}, [32]byte{'B'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 101, [32]byte{'c'}, [32]byte{'a'}, [32]byte{'C'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 102, [32]byte{'d'}, [32]byte{'c'}, [32]byte{'D'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	require.Equal(t, [32]byte{'d'}, f.store.highestReceivedNode.root)
+
+	// Removing a subtree without the head or the highest received node leaves them.
+	f.store.headNode = f.store.nodeByRoot[[32]byte{'d'}]
+	_, err = f.store.forceRemoveSubtree(ctx, [32]byte{'b'})
+	require.NoError(t, err)
+	require.Equal(t, [32]byte{'d'}, f.store.headNode.root)
+	require.Equal(t, [32]byte{'d'}, f.store.highestReceivedNode.root)
+
+	_, err = f.store.forceRemoveSubtree(ctx, [32]byte{'c'})
+	require.NoError(t, err)
+	require.Equal(t, [32]byte{'a'}, f.store.headNode.root)
+	require.Equal(t, [32]byte{'a'}, f.store.highestReceivedNode.root)
+}
+
+func TestStore_DetachAndReparent(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	//   0 <- a <- b <- c <- d
+	//              \
+	//               -- e
+	blocks := []struct {
+		slot   primitives.Slot
+		root   [32]byte
+		parent [32]byte
+	}{
+		{1, [32]byte{'a'}, params.BeaconConfig().ZeroHash},
+		{2, [32]byte{'b'}, [32]byte{'a'}},
+		{3, [32]byte{'c'}, [32]byte{'b'}},
+		{4, [32]byte{'d'}, [32]byte{'c'}},
+		{3, [32]byte{'e'}, [32]byte{'b'}},
+	}
+	for _, b := range blocks {
+		st, blkRoot, err := prepareForkchoiceState(ctx, b.slot, b.root, b.parent, b.root, 1, 1)
+		require.NoError(t, err)
+		require.NoError(t, f.InsertNode(ctx, st, blkRoot))
+	}
+	f.ProcessAttestation(ctx, []uint64{0}, [32]byte{'a'}, 1)
+	f.ProcessAttestation(ctx, []uint64{1}, [32]byte{'b'}, 1)
+	f.ProcessAttestation(ctx, []uint64{2}, [32]byte{'d'}, 1)
+	f.ProcessAttestation(ctx, []uint64{3}, [32]byte{'e'}, 1)
+	f.justifiedBalances = []uint64{10, 20, 30, 40}
+	head, err := f.Head(ctx)
+	require.NoError(t, err)
+	require.Equal(t, [32]byte{'e'}, head)
+	require.Equal(t, uint64(100), f.store.nodeByRoot[[32]byte{'a'}].weight)
+
+	require.NoError(t, f.store.detachAndReparent(ctx, [32]byte{'b'}))
+	require.Equal(t, 5, len(f.store.nodeByRoot))
+	require.Equal(t, false, f.HasNode([32]byte{'b'}))
+	a := f.store.nodeByRoot[[32]byte{'a'}]
+	require.Equal(t, 2, len(a.children))
+	for _, root := range [][32]byte{{'c'}, {'e'}} {
+		require.Equal(t, a, f.store.nodeByRoot[root].parent)
+	}
+	require.Equal(t, f.store.nodeByRoot[[32]byte{'c'}], f.store.nodeByRoot[[32]byte{'d'}].parent)
+	// The balance that voted for the detached node is gone.
+	require.Equal(t, uint64(80), a.weight)
+	require.Equal(t, uint64(30), f.store.nodeByRoot[[32]byte{'c'}].weight)
+	require.Equal(t, uint64(40), f.store.nodeByRoot[[32]byte{'e'}].weight)
+	require.Equal(t, f.store.nodeByRoot[[32]byte{'e'}], a.bestDescendant)
+	require.Equal(t, 0, len(f.store.nodesBySlot[2]))
+
+	// Detaching a node with no children removes it.
+	require.NoError(t, f.store.detachAndReparent(ctx, [32]byte{'e'}))
+	require.Equal(t, uint64(40), a.weight)
+	require.Equal(t, f.store.nodeByRoot[[32]byte{'d'}], a.bestDescendant)
+
+	require.ErrorIs(t, f.store.detachAndReparent(ctx, [32]byte{'b'}), ErrNilNode)
+	require.ErrorIs(t, f.store.detachAndReparent(ctx, f.store.treeRootNode.root), errInvalidParentRoot)
+	f.store.finalizedCheckpoint.Root = [32]byte{'a'}
+	require.ErrorIs(t, f.store.detachAndReparent(ctx, [32]byte{'a'}), errInvalidFinalizedNode)
+	require.Equal(t, true, f.HasNode([32]byte{'a'}))
+}
+
+func TestSetOptimisticToInvalid_Idempotent(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+
+	state, blkRoot, err := prepareForkchoiceState(ctx, 100, [32]byte{'a'}, params.BeaconConfig().ZeroHash, [32]byte{'A'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 101, [32]byte{'b'}, [32]byte{'a'}, [32]byte{'B'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 102, [32]byte{'c'}, [32]byte{'b'}, [32]byte{'C'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+
+	roots, err := f.SetOptimisticToInvalid(ctx, [32]byte{'c'}, [32]byte{'b'}, [32]byte{'A'})
+	require.NoError(t, err)
+	require.DeepEqual(t, [][32]byte{{'c'}, {'b'}}, roots)
+	require.Equal(t, 2, f.NodeCount())
+
+	roots, err = f.SetOptimisticToInvalid(ctx, [32]byte{'c'}, [32]byte{'b'}, [32]byte{'A'})
+	require.NoError(t, err)
+	require.Equal(t, 0, len(roots))
+	require.Equal(t, 2, f.NodeCount())
+}
+
+func TestForkChoice_LastInvalidatedRoots(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	require.Equal(t, 0, len(f.LastInvalidatedRoots()))
+
+	state, blkRoot, err := prepareForkchoiceState(ctx, 100, [32]byte{'a'}, params.BeaconConfig().ZeroHash, [32]byte{'A'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 101, [32]byte{'b'}, [32]byte{'a'}, [32]byte{'B'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 102, [32]byte{'c'}, [32]byte{'b'}, [32]byte{'C'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 103, [32]byte{'d'}, [32]byte{'a'}, [32]byte{'D'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+
+	roots, err := f.SetOptimisticToInvalid(ctx, [32]byte{'c'}, [32]byte{'b'}, [32]byte{'A'})
+	require.NoError(t, err)
+	require.DeepEqual(t, [][32]byte{{'c'}, {'b'}}, roots)
+	require.DeepEqual(t, roots, f.LastInvalidatedRoots())
+
+	// The returned slice is a copy.
+	f.LastInvalidatedRoots()[0] = [32]byte{'z'}
+	require.DeepEqual(t, roots, f.LastInvalidatedRoots())
+
+	// A new invalidation replaces the previous result.
+	roots, err = f.SetOptimisticToInvalid(ctx, [32]byte{'d'}, [32]byte{'a'}, [32]byte{'A'})
+	require.NoError(t, err)
+	require.DeepEqual(t, [][32]byte{{'d'}}, roots)
+	require.DeepEqual(t, roots, f.LastInvalidatedRoots())
+
+	// An invalidation that removes nothing resets it.
+	_, err = f.SetOptimisticToInvalid(ctx, [32]byte{'d'}, [32]byte{'a'}, [32]byte{'A'})
+	require.NoError(t, err)
+	require.Equal(t, 0, len(f.LastInvalidatedRoots()))
+}
+
+//         ----- C
+//       /
+//  A <- B
+//       \
+//         ----- D
+//
+// C and D share the ancestors B and A
+
+func TestStore_SetValidatedByPayloadHashes(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+
+	state, blkRoot, err := prepareForkchoiceState(ctx, 100, [32]byte{'a'}, params.BeaconConfig().ZeroHash, [32]byte{'A'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 101, [32]byte{'b'}, [32]byte{'a'}, [32]byte{'B'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 102, [32]byte{'c'}, [32]byte{'b'}, [32]byte{'C'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 102, [32]byte{'d'}, [32]byte{'b'}, [32]byte{'D'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+
+	require.ErrorIs(t, f.store.setValidatedByPayloadHashes(ctx, [][32]byte{{'C'}, {'X'}}), ErrNilNode)
+	require.Equal(t, 5, f.OptimisticNodeCount())
+
+	// Mark B as validated while leaving A optimistic: walks stopping at the
+	// already validated B never reach A.
+	f.store.nodeByRoot[[32]byte{'b'}].optimistic = false
+	require.NoError(t, f.store.setValidatedByPayloadHashes(ctx, [][32]byte{{'C'}, {'D'}}))
+	require.Equal(t, false, f.store.nodeByRoot[[32]byte{'c'}].optimistic)
+	require.Equal(t, false, f.store.nodeByRoot[[32]byte{'d'}].optimistic)
+	require.Equal(t, true, f.store.nodeByRoot[[32]byte{'a'}].optimistic)
+
+	require.NoError(t, f.store.setValidatedByPayloadHashes(ctx, [][32]byte{{'A'}}))
+	require.Equal(t, 0, f.OptimisticNodeCount())
+}
+
 func TestSetOptimisticToValid(t *testing.T) {
 	f := setup(1, 1)
 	op, err := f.IsOptimistic([32]byte{})
@@ -395,3 +688,46 @@ func TestSetOptimisticToValid(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, false, op)
 }
+
+func TestLongestOptimisticChain(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	require.NoError(t, f.SetOptimisticToValid(ctx, params.BeaconConfig().ZeroHash))
+	length, tip, err := f.LongestOptimisticChain()
+	require.NoError(t, err)
+	require.Equal(t, 0, length)
+	require.Equal(t, [32]byte{}, tip)
+
+	// Insert the following tree, where every block is optimistic:
+	//
+	//	0 -- a -- b -- c -- d -- e
+	//	      \
+	//	       x
+	for _, blk := range []struct {
+		slot   primitives.Slot
+		root   [32]byte
+		parent [32]byte
+	}{
+		{1, [32]byte{'a'}, params.BeaconConfig().ZeroHash},
+		{2, [32]byte{'b'}, [32]byte{'a'}},
+		{3, [32]byte{'c'}, [32]byte{'b'}},
+		{4, [32]byte{'d'}, [32]byte{'c'}},
+		{5, [32]byte{'e'}, [32]byte{'d'}},
+		{2, [32]byte{'x'}, [32]byte{'a'}},
+	} {
+		state, blkRoot, err := prepareForkchoiceState(ctx, blk.slot, blk.root, blk.parent, blk.root, 1, 1)
+		require.NoError(t, err)
+		require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	}
+	length, tip, err = f.LongestOptimisticChain()
+	require.NoError(t, err)
+	require.Equal(t, 5, length)
+	require.Equal(t, [32]byte{'e'}, tip)
+
+	// Validating b leaves the optimistic tail c -- d -- e.
+	require.NoError(t, f.SetOptimisticToValid(ctx, [32]byte{'b'}))
+	length, tip, err = f.LongestOptimisticChain()
+	require.NoError(t, err)
+	require.Equal(t, 3, length)
+	require.Equal(t, [32]byte{'e'}, tip)
+}
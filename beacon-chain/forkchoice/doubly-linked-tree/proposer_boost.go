@@ -1,23 +1,38 @@
 package doublylinkedtree
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"time"
 
+	"github.com/pkg/errors"
 	fieldparams "github.com/prysmaticlabs/prysm/v4/config/fieldparams"
 	"github.com/prysmaticlabs/prysm/v4/config/params"
+	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
+	"github.com/prysmaticlabs/prysm/v4/time/slots"
 )
 
 // applyProposerBoostScore applies the current proposer boost scores to the
-// relevant nodes.
-func (f *ForkChoice) applyProposerBoostScore() error {
+// relevant nodes. It returns the context error without touching any balance if
+// the context is cancelled.
+func (f *ForkChoice) applyProposerBoostScore(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	s := f.store
 	proposerScore := uint64(0)
+	reversed := false
 	if s.previousProposerBoostRoot != params.BeaconConfig().ZeroHash {
 		previousNode, ok := s.nodeByRoot[s.previousProposerBoostRoot]
 		if !ok || previousNode == nil {
 			log.WithError(errInvalidProposerBoostRoot).Errorf(fmt.Sprintf("invalid prev root %#x", s.previousProposerBoostRoot))
 		} else {
-			previousNode.balance -= s.previousProposerBoostScore
+			s.removePreviousProposerBoost(previousNode)
+			if s.previousProposerBoostScore > 0 {
+				s.mutationVersion++
+				reversed = true
+			}
 		}
 	}
 
@@ -26,16 +41,106 @@ func (f *ForkChoice) applyProposerBoostScore() error {
 		if !ok || currentNode == nil {
 			log.WithError(errInvalidProposerBoostRoot).Errorf(fmt.Sprintf("invalid current root %#x", s.proposerBoostRoot))
 		} else {
-			proposerScore = (s.committeeWeight * params.BeaconConfig().ProposerScoreBoost) / 100
+			proposerScore = s.clampedProposerBoost(currentNode.slot)
 			currentNode.balance += proposerScore
+			if proposerScore > 0 {
+				s.mutationVersion++
+			}
+			if s.proposerBoostRoot != s.previousProposerBoostRoot {
+				proposerBoostAppliedCount.WithLabelValues(strconv.FormatBool(reversed)).Inc()
+			}
 		}
 	}
 	s.previousProposerBoostRoot = s.proposerBoostRoot
 	s.previousProposerBoostScore = proposerScore
+	proposerBoostScore.Set(float64(proposerScore))
 	return nil
 }
 
+// removePreviousProposerBoost subtracts the previous proposer boost score from the given node
+// balance, setting it to zero instead of underflowing.
+func (s *Store) removePreviousProposerBoost(n *Node) {
+	if n.balance < s.previousProposerBoostScore {
+		log.WithError(errInvalidProposerBoostScore).Warnf("previous proposer score %d exceeds node balance %d, setting the balance to 0", s.previousProposerBoostScore, n.balance)
+		n.balance = 0
+		return
+	}
+	n.balance -= s.previousProposerBoostScore
+}
+
+// clampedProposerBoost returns the proposer boost score given to a block of the given slot,
+// clamped to the committee weight.
+func (s *Store) clampedProposerBoost(slot primitives.Slot) uint64 {
+	score := effectiveProposerBoost(s.committeeWeight, slot)
+	if score > s.committeeWeight {
+		log.WithError(errInvalidProposerBoostScore).Errorf("proposer score %d exceeds committee weight %d, clamping to the committee weight", score, s.committeeWeight)
+		return s.committeeWeight
+	}
+	return score
+}
+
+// effectiveProposerBoost returns the proposer boost score given to a block of the given slot.
+// In every fork so far ProposerScoreBoost is a percentage of the committee weight, the slot
+// allows later forks to change the boost or its denominator.
+func effectiveProposerBoost(committeeWeight uint64, _ primitives.Slot) uint64 {
+	return (committeeWeight * params.BeaconConfig().ProposerScoreBoost) / 100
+}
+
 // ProposerBoost of fork choice store.
 func (s *Store) proposerBoost() [fieldparams.RootLength]byte {
 	return s.proposerBoostRoot
 }
+
+// NodesOrphanedByBoost returns the roots of the currently canonical nodes, from the head
+// backwards, that would no longer be canonical if the proposer boost was moved to
+// newBoostRoot. The head is recomputed on a clone of the tree, the store is not modified.
+func (f *ForkChoice) NodesOrphanedByBoost(newBoostRoot [32]byte) ([][32]byte, error) {
+	s := f.store
+	if s.treeRootNode == nil || s.headNode == nil {
+		return nil, ErrNilNode
+	}
+	if newBoostRoot != params.BeaconConfig().ZeroHash {
+		if n, ok := s.nodeByRoot[newBoostRoot]; !ok || n == nil {
+			return nil, errors.Wrapf(ErrNilNode, "unknown boost root %#x", newBoostRoot)
+		}
+	}
+
+	nodeByRoot := make(map[[fieldparams.RootLength]byte]*Node, len(s.nodeByRoot))
+	treeRootNode := s.treeRootNode.clone(nil, nodeByRoot)
+	if s.previousProposerBoostRoot != params.BeaconConfig().ZeroHash {
+		if n, ok := nodeByRoot[s.previousProposerBoostRoot]; ok {
+			s.removePreviousProposerBoost(n)
+		}
+	}
+	if newBoostRoot != params.BeaconConfig().ZeroHash {
+		n := nodeByRoot[newBoostRoot]
+		n.balance += s.clampedProposerBoost(n.slot)
+	}
+
+	ctx := context.Background()
+	if err := treeRootNode.applyWeightChanges(ctx); err != nil {
+		return nil, errors.Wrap(err, "could not apply weight changes")
+	}
+	currentEpoch := slots.EpochsSinceGenesis(time.Unix(int64(s.genesisTime), 0))
+	if err := treeRootNode.updateBestDescendant(ctx, s.justifiedCheckpoint.Epoch, s.finalizedCheckpoint.Epoch, currentEpoch); err != nil {
+		return nil, errors.Wrap(err, "could not update best descendant")
+	}
+	justifiedNode, ok := nodeByRoot[s.justifiedCheckpoint.Root]
+	if !ok || justifiedNode == nil {
+		justifiedNode = treeRootNode
+	}
+	newHead := justifiedNode.bestDescendant
+	if newHead == nil {
+		newHead = justifiedNode
+	}
+
+	canonical := make(map[[fieldparams.RootLength]byte]bool)
+	for n := newHead; n != nil; n = n.parent {
+		canonical[n.root] = true
+	}
+	orphaned := make([][32]byte, 0)
+	for n := s.headNode; n != nil && !canonical[n.root]; n = n.parent {
+		orphaned = append(orphaned, n.root)
+	}
+	return orphaned, nil
+}
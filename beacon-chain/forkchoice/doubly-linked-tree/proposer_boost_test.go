@@ -5,10 +5,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prysmaticlabs/prysm/v4/config/features"
 	"github.com/prysmaticlabs/prysm/v4/config/params"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
 	"github.com/prysmaticlabs/prysm/v4/testing/assert"
 	"github.com/prysmaticlabs/prysm/v4/testing/require"
+	logTest "github.com/sirupsen/logrus/hooks/test"
 )
 
 // Helper function to simulate the block being on time or delayed for proposer
@@ -24,6 +27,9 @@ func driftGenesisTime(f *ForkChoice, slot primitives.Slot, delay uint64) {
 // and release their withheld block of slot n+2 in an attempt to win fork choice.
 // If the honest proposal is boosted at slot n+2, it will win against this attacker.
 func TestForkChoice_BoostProposerRoot_PreventsExAnteAttack(t *testing.T) {
+	// Equal weight branches are broken by root only.
+	resetCfg := features.InitWithReset(&features.Flags{DisableForkchoiceSlotTieBreak: true})
+	defer resetCfg()
 	ctx := context.Background()
 	jEpoch, fEpoch := primitives.Epoch(0), primitives.Epoch(0)
 	zeroHash := params.BeaconConfig().ZeroHash
@@ -504,3 +510,236 @@ func TestForkChoice_missingProposerBoostRoots(t *testing.T) {
 	require.Equal(t, root, headRoot)
 	require.Equal(t, [32]byte{'p'}, f.store.proposerBoostRoot)
 }
+
+func TestForkChoice_NodesOrphanedByBoost(t *testing.T) {
+	ctx := context.Background()
+	f := setup(0, 0)
+	f.justifiedBalances = []uint64{10}
+	f.store.committeeWeight = 100
+	f.numActiveValidators = 1
+	zeroHash := params.BeaconConfig().ZeroHash
+
+	// Insert the following tree, with a single vote for block 2:
+	//         0
+	//        / \
+	//       1   3
+	//       |
+	//       2 <- HEAD
+	for _, blk := range []struct {
+		slot   primitives.Slot
+		root   [32]byte
+		parent [32]byte
+	}{
+		{1, indexToHash(1), zeroHash},
+		{2, indexToHash(2), indexToHash(1)},
+		{3, indexToHash(3), zeroHash},
+	} {
+		state, blkRoot, err := prepareForkchoiceState(ctx, blk.slot, blk.root, blk.parent, zeroHash, 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	}
+	f.store.proposerBoostRoot = [32]byte{}
+	f.ProcessAttestation(ctx, []uint64{0}, indexToHash(2), 0)
+	headRoot, err := f.Head(ctx)
+	require.NoError(t, err)
+	require.Equal(t, indexToHash(2), headRoot)
+
+	orphaned, err := f.NodesOrphanedByBoost(indexToHash(3))
+	require.NoError(t, err)
+	require.DeepEqual(t, [][32]byte{indexToHash(2), indexToHash(1)}, orphaned)
+	require.Equal(t, true, f.IsCanonical(indexToHash(2)))
+	require.Equal(t, false, f.IsCanonical(indexToHash(3)))
+
+	orphaned, err = f.NodesOrphanedByBoost(indexToHash(2))
+	require.NoError(t, err)
+	require.Equal(t, 0, len(orphaned))
+
+	_, err = f.NodesOrphanedByBoost(indexToHash(4))
+	require.ErrorIs(t, err, ErrNilNode)
+}
+
+func TestForkChoice_NodesOrphanedByBoost_BoostScore(t *testing.T) {
+	ctx := context.Background()
+	zeroHash := params.BeaconConfig().ZeroHash
+	// Insert the following tree, with a single vote of weight 10 for block 1:
+	//         0
+	//        / \
+	//       1   2
+	setupTree := func(t *testing.T) *ForkChoice {
+		f := setup(0, 0)
+		f.justifiedBalances = []uint64{10}
+		f.numActiveValidators = 1
+		for i := 1; i <= 2; i++ {
+			state, blkRoot, err := prepareForkchoiceState(ctx, primitives.Slot(i), indexToHash(uint64(i)), zeroHash, zeroHash, 0, 0)
+			require.NoError(t, err)
+			require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+		}
+		f.store.proposerBoostRoot = [32]byte{}
+		f.ProcessAttestation(ctx, []uint64{0}, indexToHash(1), 0)
+		headRoot, err := f.Head(ctx)
+		require.NoError(t, err)
+		require.Equal(t, indexToHash(1), headRoot)
+		return f
+	}
+
+	t.Run("clamps to the committee weight", func(t *testing.T) {
+		params.SetupTestConfigCleanup(t)
+		cfg := params.BeaconConfig().Copy()
+		cfg.ProposerScoreBoost = 150
+		params.OverrideBeaconConfig(cfg)
+		f := setupTree(t)
+		// An unclamped boost of 12 would outweigh the vote.
+		f.store.committeeWeight = 8
+		orphaned, err := f.NodesOrphanedByBoost(indexToHash(2))
+		require.NoError(t, err)
+		require.Equal(t, 0, len(orphaned))
+	})
+	t.Run("previous score exceeding the balance", func(t *testing.T) {
+		f := setupTree(t)
+		f.store.previousProposerBoostRoot = indexToHash(2)
+		f.store.previousProposerBoostScore = 1000
+		orphaned, err := f.NodesOrphanedByBoost(zeroHash)
+		require.NoError(t, err)
+		require.Equal(t, 0, len(orphaned))
+	})
+}
+
+func TestForkChoice_ApplyProposerBoostScore_ClampsToCommitteeWeight(t *testing.T) {
+	params.SetupTestConfigCleanup(t)
+	cfg := params.BeaconConfig().Copy()
+	cfg.ProposerScoreBoost = 150
+	params.OverrideBeaconConfig(cfg)
+
+	hook := logTest.NewGlobal()
+	ctx := context.Background()
+	f := setup(0, 0)
+	f.store.committeeWeight = 100
+	root := indexToHash(1)
+	state, blkRoot, err := prepareForkchoiceState(ctx, 1, root, params.BeaconConfig().ZeroHash, params.BeaconConfig().ZeroHash, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	f.store.proposerBoostRoot = root
+
+	require.NoError(t, f.applyProposerBoostScore(ctx))
+	require.Equal(t, uint64(100), f.store.previousProposerBoostScore)
+	require.Equal(t, uint64(100), f.store.nodeByRoot[root].balance)
+	require.LogsContain(t, hook, "proposer score 150 exceeds committee weight 100")
+}
+
+func TestForkChoice_ApplyProposerBoostScore_PreviousScoreUnderflow(t *testing.T) {
+	hook := logTest.NewGlobal()
+	ctx := context.Background()
+	f := setup(0, 0)
+	root := indexToHash(1)
+	state, blkRoot, err := prepareForkchoiceState(ctx, 1, root, params.BeaconConfig().ZeroHash, params.BeaconConfig().ZeroHash, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	f.store.proposerBoostRoot = [32]byte{}
+	f.store.previousProposerBoostRoot = root
+	f.store.previousProposerBoostScore = 100
+	f.store.nodeByRoot[root].balance = 40
+
+	require.NoError(t, f.applyProposerBoostScore(ctx))
+	require.Equal(t, uint64(0), f.store.nodeByRoot[root].balance)
+	require.LogsContain(t, hook, "previous proposer score 100 exceeds node balance 40")
+}
+
+func TestForkChoice_ApplyProposerBoostScore_Metrics(t *testing.T) {
+	ctx := context.Background()
+	f := setup(0, 0)
+	f.store.committeeWeight = 100
+	root1 := indexToHash(1)
+	state, blkRoot, err := prepareForkchoiceState(ctx, 1, root1, params.BeaconConfig().ZeroHash, params.BeaconConfig().ZeroHash, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	root2 := indexToHash(2)
+	state, blkRoot, err = prepareForkchoiceState(ctx, 2, root2, root1, params.BeaconConfig().ZeroHash, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+
+	notReversed := testutil.ToFloat64(proposerBoostAppliedCount.WithLabelValues("false"))
+	reversed := testutil.ToFloat64(proposerBoostAppliedCount.WithLabelValues("true"))
+	score := effectiveProposerBoost(f.store.committeeWeight, 1)
+
+	f.store.proposerBoostRoot = root1
+	require.NoError(t, f.applyProposerBoostScore(ctx))
+	require.Equal(t, notReversed+1, testutil.ToFloat64(proposerBoostAppliedCount.WithLabelValues("false")))
+	require.Equal(t, reversed, testutil.ToFloat64(proposerBoostAppliedCount.WithLabelValues("true")))
+	require.Equal(t, float64(score), testutil.ToFloat64(proposerBoostScore))
+
+	f.store.proposerBoostRoot = root2
+	require.NoError(t, f.applyProposerBoostScore(ctx))
+	require.Equal(t, notReversed+1, testutil.ToFloat64(proposerBoostAppliedCount.WithLabelValues("false")))
+	require.Equal(t, reversed+1, testutil.ToFloat64(proposerBoostAppliedCount.WithLabelValues("true")))
+	require.Equal(t, float64(score), testutil.ToFloat64(proposerBoostScore))
+
+	// Reapplying the boost to the same root is not counted again.
+	require.NoError(t, f.applyProposerBoostScore(ctx))
+	require.Equal(t, reversed+1, testutil.ToFloat64(proposerBoostAppliedCount.WithLabelValues("true")))
+}
+
+func TestForkChoice_ApplyProposerBoostScore_CancelledContext(t *testing.T) {
+	ctx := context.Background()
+	f := setup(0, 0)
+	f.store.committeeWeight = 100
+	root1 := indexToHash(1)
+	state, blkRoot, err := prepareForkchoiceState(ctx, 1, root1, params.BeaconConfig().ZeroHash, params.BeaconConfig().ZeroHash, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	root2 := indexToHash(2)
+	state, blkRoot, err = prepareForkchoiceState(ctx, 2, root2, params.BeaconConfig().ZeroHash, params.BeaconConfig().ZeroHash, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	f.store.proposerBoostRoot = root2
+	f.store.previousProposerBoostRoot = root1
+	f.store.previousProposerBoostScore = 10
+	f.store.nodeByRoot[root1].balance = 30
+	version := f.MutationVersion()
+
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	require.ErrorIs(t, f.applyProposerBoostScore(cancelledCtx), context.Canceled)
+	require.Equal(t, uint64(30), f.store.nodeByRoot[root1].balance)
+	require.Equal(t, uint64(0), f.store.nodeByRoot[root2].balance)
+	require.Equal(t, root1, f.store.previousProposerBoostRoot)
+	require.Equal(t, uint64(10), f.store.previousProposerBoostScore)
+	require.Equal(t, version, f.MutationVersion())
+}
+
+func TestForkChoice_ApplyProposerBoostScore_LateBlocks(t *testing.T) {
+	ctx := context.Background()
+	boostedBalance := func(t *testing.T, delay uint64) uint64 {
+		f := setup(0, 0)
+		f.store.committeeWeight = 100
+		driftGenesisTime(f, 1, delay)
+		root := indexToHash(1)
+		state, blkRoot, err := prepareForkchoiceState(ctx, 1, root, params.BeaconConfig().ZeroHash, params.BeaconConfig().ZeroHash, 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+		require.NoError(t, f.applyProposerBoostScore(ctx))
+		return f.store.nodeByRoot[root].balance
+	}
+
+	t.Run("early block", func(t *testing.T) {
+		require.Equal(t, effectiveProposerBoost(100, 1), boostedBalance(t, 1))
+	})
+	t.Run("late block", func(t *testing.T) {
+		require.Equal(t, uint64(0), boostedBalance(t, orphanLateBlockFirstThreshold+1))
+	})
+}
+
+func TestEffectiveProposerBoost(t *testing.T) {
+	params.SetupTestConfigCleanup(t)
+	cfg := params.BeaconConfig().Copy()
+	cfg.DenebForkEpoch = 10
+	params.OverrideBeaconConfig(cfg)
+	denebSlot := primitives.Slot(cfg.DenebForkEpoch) * cfg.SlotsPerEpoch
+
+	for _, slot := range []primitives.Slot{0, denebSlot - 1, denebSlot} {
+		require.Equal(t, 1000*cfg.ProposerScoreBoost/100, effectiveProposerBoost(1000, slot))
+	}
+
+	cfg.ProposerScoreBoost = 20
+	params.OverrideBeaconConfig(cfg)
+	require.Equal(t, uint64(200), effectiveProposerBoost(1000, denebSlot))
+}
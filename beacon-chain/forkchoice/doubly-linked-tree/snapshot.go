@@ -0,0 +1,261 @@
+package doublylinkedtree
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	forkchoicetypes "github.com/prysmaticlabs/prysm/v4/beacon-chain/forkchoice/types"
+	fieldparams "github.com/prysmaticlabs/prysm/v4/config/fieldparams"
+	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
+	"github.com/prysmaticlabs/prysm/v4/time/slots"
+)
+
+// snapshotNode is the serialized form of a Node. The parent is referenced by
+// its root and the tree links are rebuilt on restore.
+type snapshotNode struct {
+	Slot                     primitives.Slot              `json:"slot"`
+	Root                     [fieldparams.RootLength]byte `json:"root"`
+	ParentRoot               [fieldparams.RootLength]byte `json:"parent_root"`
+	PayloadHash              [fieldparams.RootLength]byte `json:"payload_hash"`
+	JustifiedEpoch           primitives.Epoch             `json:"justified_epoch"`
+	UnrealizedJustifiedEpoch primitives.Epoch             `json:"unrealized_justified_epoch"`
+	FinalizedEpoch           primitives.Epoch             `json:"finalized_epoch"`
+	UnrealizedFinalizedEpoch primitives.Epoch             `json:"unrealized_finalized_epoch"`
+	Balance                  uint64                       `json:"balance"`
+	Weight                   uint64                       `json:"weight"`
+	AttestationCount         uint64                       `json:"attestation_count"`
+	Optimistic               bool                         `json:"optimistic"`
+	Timestamp                uint64                       `json:"timestamp"`
+	FirstSeenSecsIntoSlot    uint64                       `json:"first_seen_secs_into_slot"`
+}
+
+// snapshotVote is the serialized form of a Vote.
+type snapshotVote struct {
+	CurrentRoot [fieldparams.RootLength]byte `json:"current_root"`
+	NextRoot    [fieldparams.RootLength]byte `json:"next_root"`
+	NextEpoch   primitives.Epoch             `json:"next_epoch"`
+}
+
+// snapshot is the serialized form of the fork choice store. Nodes are listed
+// so that every parent appears before its children.
+type snapshot struct {
+	JustifiedCheckpoint           *forkchoicetypes.Checkpoint  `json:"justified_checkpoint"`
+	UnrealizedJustifiedCheckpoint *forkchoicetypes.Checkpoint  `json:"unrealized_justified_checkpoint"`
+	UnrealizedFinalizedCheckpoint *forkchoicetypes.Checkpoint  `json:"unrealized_finalized_checkpoint"`
+	PrevJustifiedCheckpoint       *forkchoicetypes.Checkpoint  `json:"prev_justified_checkpoint"`
+	FinalizedCheckpoint           *forkchoicetypes.Checkpoint  `json:"finalized_checkpoint"`
+	ProposerBoostRoot             [fieldparams.RootLength]byte `json:"proposer_boost_root"`
+	PreviousProposerBoostRoot     [fieldparams.RootLength]byte `json:"previous_proposer_boost_root"`
+	PreviousProposerBoostScore    uint64                       `json:"previous_proposer_boost_score"`
+	CommitteeWeight               uint64                       `json:"committee_weight"`
+	HeadRoot                      [fieldparams.RootLength]byte `json:"head_root"`
+	HighestReceivedRoot           [fieldparams.RootLength]byte `json:"highest_received_root"`
+	OriginRoot                    [fieldparams.RootLength]byte `json:"origin_root"`
+	GenesisTime                   uint64                       `json:"genesis_time"`
+	ReceivedBlocksLastEpoch       []primitives.Slot            `json:"received_blocks_last_epoch"`
+	SlashedIndices                []primitives.ValidatorIndex  `json:"slashed_indices"`
+	Nodes                         []*snapshotNode              `json:"nodes"`
+	Votes                         []snapshotVote               `json:"votes"`
+	Balances                      []uint64                     `json:"balances"`
+	JustifiedBalances             []uint64                     `json:"justified_balances"`
+	NumActiveValidators           uint64                       `json:"num_active_validators"`
+}
+
+// Snapshot serializes the fork choice node tree together with the votes,
+// balances, checkpoints and proposer boost state, so that it can be restored
+// with RestoreFromSnapshot instead of being rebuilt from the database.
+func (f *ForkChoice) Snapshot() ([]byte, error) {
+	s := f.store
+	if s.treeRootNode == nil || s.headNode == nil {
+		return nil, ErrNilNode
+	}
+	snap := &snapshot{
+		JustifiedCheckpoint:           s.justifiedCheckpoint,
+		UnrealizedJustifiedCheckpoint: s.unrealizedJustifiedCheckpoint,
+		UnrealizedFinalizedCheckpoint: s.unrealizedFinalizedCheckpoint,
+		PrevJustifiedCheckpoint:       s.prevJustifiedCheckpoint,
+		FinalizedCheckpoint:           s.finalizedCheckpoint,
+		ProposerBoostRoot:             s.proposerBoostRoot,
+		PreviousProposerBoostRoot:     s.previousProposerBoostRoot,
+		PreviousProposerBoostScore:    s.previousProposerBoostScore,
+		CommitteeWeight:               s.committeeWeight,
+		HeadRoot:                      s.headNode.root,
+		OriginRoot:                    s.originRoot,
+		GenesisTime:                   s.genesisTime,
+		ReceivedBlocksLastEpoch:       s.receivedBlocksLastEpoch[:],
+		SlashedIndices:                make([]primitives.ValidatorIndex, 0, len(s.slashedIndices)),
+		Nodes:                         make([]*snapshotNode, 0, len(s.nodeByRoot)),
+		Votes:                         make([]snapshotVote, len(f.votes)),
+		Balances:                      f.balances,
+		JustifiedBalances:             f.justifiedBalances,
+		NumActiveValidators:           f.numActiveValidators,
+	}
+	if s.highestReceivedNode != nil {
+		snap.HighestReceivedRoot = s.highestReceivedNode.root
+	}
+	for idx := range s.slashedIndices {
+		snap.SlashedIndices = append(snap.SlashedIndices, idx)
+	}
+	for i, v := range f.votes {
+		snap.Votes[i] = snapshotVote{CurrentRoot: v.currentRoot, NextRoot: v.nextRoot, NextEpoch: v.nextEpoch}
+	}
+	nodes := []*Node{s.treeRootNode}
+	for len(nodes) > 0 {
+		n := nodes[0]
+		nodes = nodes[1:]
+		sn := &snapshotNode{
+			Slot:                     n.slot,
+			Root:                     n.root,
+			PayloadHash:              n.payloadHash,
+			JustifiedEpoch:           n.justifiedEpoch,
+			UnrealizedJustifiedEpoch: n.unrealizedJustifiedEpoch,
+			FinalizedEpoch:           n.finalizedEpoch,
+			UnrealizedFinalizedEpoch: n.unrealizedFinalizedEpoch,
+			Balance:                  n.balance,
+			Weight:                   n.weight,
+			AttestationCount:         n.attestationCount,
+			Optimistic:               n.optimistic,
+			Timestamp:                n.timestamp,
+			FirstSeenSecsIntoSlot:    n.firstSeenSecsIntoSlot,
+		}
+		if n.parent != nil {
+			sn.ParentRoot = n.parent.root
+		}
+		snap.Nodes = append(snap.Nodes, sn)
+		nodes = append(nodes, n.children...)
+	}
+	return json.Marshal(snap)
+}
+
+// RestoreFromSnapshot replaces the fork choice store with the one serialized
+// in the given snapshot. The first node must be the tree root and every other
+// node must reference a parent listed before it. The current store is left
+// untouched if the snapshot is invalid.
+func (f *ForkChoice) RestoreFromSnapshot(data []byte) error {
+	snap := &snapshot{}
+	if err := json.Unmarshal(data, snap); err != nil {
+		return errors.Wrap(err, "could not unmarshal snapshot")
+	}
+	if len(snap.Nodes) == 0 {
+		return errors.Wrap(ErrNilNode, "snapshot has no nodes")
+	}
+	checkpoints := []*forkchoicetypes.Checkpoint{
+		snap.JustifiedCheckpoint,
+		snap.UnrealizedJustifiedCheckpoint,
+		snap.UnrealizedFinalizedCheckpoint,
+		snap.PrevJustifiedCheckpoint,
+		snap.FinalizedCheckpoint,
+	}
+	for _, cp := range checkpoints {
+		if cp == nil {
+			return errInvalidNilCheckpoint
+		}
+	}
+
+	s := New().store
+	s.justifiedCheckpoint = snap.JustifiedCheckpoint
+	s.unrealizedJustifiedCheckpoint = snap.UnrealizedJustifiedCheckpoint
+	s.unrealizedFinalizedCheckpoint = snap.UnrealizedFinalizedCheckpoint
+	s.prevJustifiedCheckpoint = snap.PrevJustifiedCheckpoint
+	s.finalizedCheckpoint = snap.FinalizedCheckpoint
+	s.proposerBoostRoot = snap.ProposerBoostRoot
+	s.previousProposerBoostRoot = snap.PreviousProposerBoostRoot
+	s.previousProposerBoostScore = snap.PreviousProposerBoostScore
+	s.committeeWeight = snap.CommitteeWeight
+	s.originRoot = snap.OriginRoot
+	s.genesisTime = snap.GenesisTime
+	copy(s.receivedBlocksLastEpoch[:], snap.ReceivedBlocksLastEpoch)
+	for _, idx := range snap.SlashedIndices {
+		s.slashedIndices[idx] = true
+	}
+	for i, sn := range snap.Nodes {
+		if sn == nil {
+			return errors.Wrapf(ErrNilNode, "nil node at position %d", i)
+		}
+		if _, ok := s.nodeByRoot[sn.Root]; ok {
+			return errors.Wrapf(errInconsistentStore, "duplicate node %#x", sn.Root)
+		}
+		n := &Node{
+			slot:                     sn.Slot,
+			root:                     sn.Root,
+			payloadHash:              sn.PayloadHash,
+			justifiedEpoch:           sn.JustifiedEpoch,
+			unrealizedJustifiedEpoch: sn.UnrealizedJustifiedEpoch,
+			finalizedEpoch:           sn.FinalizedEpoch,
+			unrealizedFinalizedEpoch: sn.UnrealizedFinalizedEpoch,
+			balance:                  sn.Balance,
+			weight:                   sn.Weight,
+			attestationCount:         sn.AttestationCount,
+			optimistic:               sn.Optimistic,
+			timestamp:                sn.Timestamp,
+			firstSeenSecsIntoSlot:    sn.FirstSeenSecsIntoSlot,
+		}
+		if i == 0 {
+			s.treeRootNode = n
+		} else {
+			parent, ok := s.nodeByRoot[sn.ParentRoot]
+			if !ok {
+				return errors.Wrapf(errInvalidParentRoot, "node %#x references unknown parent %#x", sn.Root, sn.ParentRoot)
+			}
+			if n.slot <= parent.slot {
+				return errors.Wrapf(errInvalidParentRoot, "node %#x at slot %d is not after its parent at slot %d", sn.Root, n.slot, parent.slot)
+			}
+			n.parent = parent
+			parent.children = append(parent.children, n)
+		}
+		s.nodeByRoot[n.root] = n
+		s.nodeByPayload[n.payloadHash] = n
+		s.nodesBySlot[n.slot] = append(s.nodesBySlot[n.slot], n)
+	}
+
+	var ok bool
+	if s.headNode, ok = s.nodeByRoot[snap.HeadRoot]; !ok {
+		return errors.Wrapf(ErrNilNode, "unknown head root %#x", snap.HeadRoot)
+	}
+	if s.highestReceivedNode, ok = s.nodeByRoot[snap.HighestReceivedRoot]; !ok {
+		return errors.Wrapf(ErrNilNode, "unknown highest received root %#x", snap.HighestReceivedRoot)
+	}
+	for _, root := range [][fieldparams.RootLength]byte{s.proposerBoostRoot, s.previousProposerBoostRoot} {
+		if _, ok := s.nodeByRoot[root]; root != [32]byte{} && !ok {
+			return errors.Wrapf(errInvalidProposerBoostRoot, "unknown root %#x", root)
+		}
+	}
+	currentEpoch := slots.EpochsSinceGenesis(time.Unix(int64(s.genesisTime), 0))
+	if err := s.treeRootNode.updateBestDescendant(context.Background(), s.justifiedCheckpoint.Epoch, s.finalizedCheckpoint.Epoch, currentEpoch); err != nil {
+		return errors.Wrap(err, "could not update best descendant")
+	}
+
+	votes := make([]Vote, len(snap.Votes))
+	for i, v := range snap.Votes {
+		votes[i] = Vote{currentRoot: v.CurrentRoot, nextRoot: v.NextRoot, nextEpoch: v.NextEpoch}
+	}
+	restored := &ForkChoice{
+		store:               s,
+		votes:               votes,
+		balances:            snap.Balances,
+		justifiedBalances:   snap.JustifiedBalances,
+		numActiveValidators: snap.NumActiveValidators,
+	}
+	if restored.balances == nil {
+		restored.balances = make([]uint64, 0)
+	}
+	if err := restored.Validate(); err != nil {
+		return errors.Wrap(err, "invalid snapshot")
+	}
+
+	// Keep the head change subscriptions and the history of the replaced store,
+	// and keep its mutation version increasing so callers see the restore.
+	s.headSubscriptions = f.store.headSubscriptions
+	s.reorgHistory = f.store.reorgHistory
+	s.invalidationHistory = f.store.invalidationHistory
+	s.mutationVersion = f.store.mutationVersion + 1
+	f.store = s
+	f.votes = restored.votes
+	f.balances = restored.balances
+	f.justifiedBalances = restored.justifiedBalances
+	f.numActiveValidators = restored.numActiveValidators
+	nodeCount.Set(float64(len(s.nodeByRoot)))
+	return nil
+}
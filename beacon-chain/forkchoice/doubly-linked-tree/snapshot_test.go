@@ -0,0 +1,127 @@
+package doublylinkedtree
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/prysmaticlabs/prysm/v4/config/params"
+	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
+	"github.com/prysmaticlabs/prysm/v4/testing/require"
+)
+
+func TestForkChoice_SnapshotRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	// Build the following tree, with the vote on 3 and the boost on 4.
+	//
+	//  0 <- 1 <- 2 <- 3
+	//         \
+	//          - 4
+	state, blkRoot, err := prepareForkchoiceState(ctx, 1, indexToHash(1), params.BeaconConfig().ZeroHash, indexToHash(1), 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 2, indexToHash(2), indexToHash(1), indexToHash(2), 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 3, indexToHash(3), indexToHash(2), indexToHash(3), 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 4, indexToHash(4), indexToHash(1), indexToHash(4), 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	require.NoError(t, f.SetOptimisticToValid(ctx, indexToHash(2)))
+
+	f.justifiedBalances = []uint64{10, 20}
+	f.numActiveValidators = 2
+	f.store.committeeWeight = 20
+	f.ProcessAttestation(ctx, []uint64{0, 1}, indexToHash(3), 2)
+	f.store.proposerBoostRoot = indexToHash(4)
+	f.InsertSlashedIndex(ctx, 1)
+	head, err := f.Head(ctx)
+	require.NoError(t, err)
+	require.Equal(t, indexToHash(3), head)
+
+	data, err := f.Snapshot()
+	require.NoError(t, err)
+	restored := New()
+	require.NoError(t, restored.RestoreFromSnapshot(data))
+	require.NoError(t, restored.Validate())
+
+	require.Equal(t, f.NodeCount(), restored.NodeCount())
+	require.Equal(t, f.OptimisticNodeCount(), restored.OptimisticNodeCount())
+	require.DeepEqual(t, f.JustifiedCheckpoint(), restored.JustifiedCheckpoint())
+	require.DeepEqual(t, f.FinalizedCheckpoint(), restored.FinalizedCheckpoint())
+	require.Equal(t, f.ProposerBoost(), restored.ProposerBoost())
+	require.Equal(t, f.store.previousProposerBoostScore, restored.store.previousProposerBoostScore)
+	require.Equal(t, true, restored.store.slashedIndices[1])
+	for root, n := range f.store.nodeByRoot {
+		rn, ok := restored.store.nodeByRoot[root]
+		require.Equal(t, true, ok)
+		require.Equal(t, n.weight, rn.weight)
+		require.Equal(t, n.optimistic, rn.optimistic)
+	}
+	require.Equal(t, head, restored.CachedHeadRoot())
+
+	head, err = f.Head(ctx)
+	require.NoError(t, err)
+	restoredHead, err := restored.Head(ctx)
+	require.NoError(t, err)
+	require.Equal(t, head, restoredHead)
+	for root, n := range f.store.nodeByRoot {
+		require.Equal(t, n.weight, restored.store.nodeByRoot[root].weight)
+	}
+}
+
+func TestForkChoice_RestoreFromSnapshot_InvalidParent(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	state, blkRoot, err := prepareForkchoiceState(ctx, 1, indexToHash(1), params.BeaconConfig().ZeroHash, indexToHash(1), 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	data, err := f.Snapshot()
+	require.NoError(t, err)
+
+	snap := &snapshot{}
+	require.NoError(t, json.Unmarshal(data, snap))
+	snap.Nodes[1].ParentRoot = indexToHash(5)
+	data, err = json.Marshal(snap)
+	require.NoError(t, err)
+
+	restored := New()
+	require.ErrorIs(t, restored.RestoreFromSnapshot(data), errInvalidParentRoot)
+	require.Equal(t, 0, restored.NodeCount())
+}
+
+func TestForkChoice_RestoreFromSnapshot_KeepsStoreState(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	driftGenesisTime(f, 1, 0)
+	state, blkRoot, err := prepareForkchoiceState(ctx, 1, indexToHash(1), params.BeaconConfig().ZeroHash, indexToHash(1), 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	data, err := f.Snapshot()
+	require.NoError(t, err)
+
+	restored := setup(1, 1)
+	state, blkRoot, err = prepareForkchoiceState(ctx, 2, indexToHash(2), params.BeaconConfig().ZeroHash, indexToHash(2), 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, restored.InsertNode(ctx, state, blkRoot))
+	restored.store.reorgHistory.add(3)
+	restored.store.invalidationHistory.add([][32]byte{indexToHash(5)})
+	version := restored.MutationVersion()
+
+	require.NoError(t, restored.RestoreFromSnapshot(data))
+	require.Equal(t, true, restored.MutationVersion() > version)
+	require.DeepEqual(t, []primitives.Slot{3}, restored.ReorgHistory(1))
+	require.DeepEqual(t, [][][32]byte{{indexToHash(5)}}, restored.InvalidationHistory(1))
+	require.Equal(t, f.store.receivedBlocksLastEpoch, restored.store.receivedBlocksLastEpoch)
+	require.Equal(t, primitives.Slot(1), restored.store.receivedBlocksLastEpoch[1])
+}
+
+func TestForkChoice_Snapshot_EmptyStore(t *testing.T) {
+	f := New()
+	_, err := f.Snapshot()
+	require.ErrorIs(t, err, ErrNilNode)
+	require.ErrorContains(t, "could not unmarshal snapshot", f.RestoreFromSnapshot([]byte("not json")))
+}
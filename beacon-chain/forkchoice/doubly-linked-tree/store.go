@@ -6,10 +6,13 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/prysm/v4/config/features"
 	fieldparams "github.com/prysmaticlabs/prysm/v4/config/fieldparams"
 	"github.com/prysmaticlabs/prysm/v4/config/params"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
+	"github.com/prysmaticlabs/prysm/v4/encoding/bytesutil"
 	"github.com/prysmaticlabs/prysm/v4/time/slots"
+	"github.com/sirupsen/logrus"
 	"go.opencensus.io/trace"
 )
 
@@ -54,12 +57,39 @@ func (s *Store) head(ctx context.Context) ([32]byte, error) {
 	if bestDescendant != s.headNode {
 		headChangesCount.Inc()
 		headSlotNumber.Set(float64(bestDescendant.slot))
+		if s.headNode != nil {
+			s.lastReorgDepth = reorgDepth(s.headNode, bestDescendant)
+			if s.lastReorgDepth > 0 && s.reorgHistory != nil {
+				s.reorgHistory.add(s.lastReorgDepth)
+			}
+		}
 		s.headNode = bestDescendant
+		if s.headSubscriptions != nil {
+			s.headSubscriptions.notify(bestDescendant.root)
+		}
 	}
 
 	return bestDescendant.root, nil
 }
 
+// reorgDepth returns the number of slots between the old head and its common
+// ancestor with the new head. It returns 0 if the new head descends from the old
+// one or if they have no common ancestor in the Store.
+func reorgDepth(oldHead, newHead *Node) primitives.Slot {
+	n1, n2 := oldHead, newHead
+	for n1 != nil && n2 != nil && n1 != n2 {
+		if n1.slot > n2.slot {
+			n1 = n1.parent
+		} else {
+			n2 = n2.parent
+		}
+	}
+	if n1 == nil || n2 == nil {
+		return 0
+	}
+	return oldHead.slot - n1.slot
+}
+
 // insert registers a new block node to the fork choice store's node list.
 // It then updates the new node's parent with best child and descendant node.
 func (s *Store) insert(ctx context.Context,
@@ -88,9 +118,15 @@ func (s *Store) insert(ctx context.Context,
 		payloadHash:              payloadHash,
 		timestamp:                uint64(time.Now().Unix()),
 	}
+	// Blocks received before their slot starts keep a zero offset.
+	if secs, err := n.secondsIntoSlot(s.genesisTime); err == nil {
+		n.firstSeenSecsIntoSlot = secs
+	}
 
 	s.nodeByPayload[payloadHash] = n
 	s.nodeByRoot[root] = n
+	s.nodesBySlot[slot] = append(s.nodesBySlot[slot], n)
+	s.mutationVersion++
 	if parent == nil {
 		if s.treeRootNode == nil {
 			s.treeRootNode = n
@@ -137,6 +173,108 @@ func (s *Store) insert(ctx context.Context,
 	return n, nil
 }
 
+// recomputeBestDescendantFrom updates the weight and best descendant of the given
+// node and of each of its ancestors after the balance of the node changed. The
+// subtrees hanging off this path reuse their cached weights and best descendants,
+// so this is only equivalent to a full update when the justified checkpoint and
+// the current epoch have not changed since the last one. The walk stops at the real
+// tree root and leaves the virtual zero hash root untouched.
+func (s *Store) recomputeBestDescendantFrom(node *Node) {
+	jEpoch := s.justifiedCheckpoint.Epoch
+	currentEpoch := slots.ToEpoch(slots.CurrentSlot(s.genesisTime))
+	slotTieBreak := !features.Get().DisableForkchoiceSlotTieBreak
+	for n := node; n != nil && !n.isVirtualRoot(); n = n.parent {
+		weight := n.balance
+		for _, child := range n.children {
+			weight += child.weight
+		}
+		n.weight = weight
+		n.setBestDescendant(jEpoch, currentEpoch, slotTieBreak)
+	}
+	s.mutationVersion++
+}
+
+// stageBalanceDelta accumulates a balance change for the node with the given root. Staged
+// changes are only applied to the nodes, and their weights recomputed, by commitBalanceDeltas.
+func (s *Store) stageBalanceDelta(root [fieldparams.RootLength]byte, delta int64) {
+	s.stagedBalanceDeltas[root] += delta
+}
+
+// commitBalanceDeltas applies the staged balance changes to their nodes and recomputes the
+// weights and best descendants of the whole tree once. Changes staged for roots that are not in
+// the Store are dropped, and a node whose balance would become negative is set to zero.
+func (s *Store) commitBalanceDeltas(ctx context.Context) error {
+	if len(s.stagedBalanceDeltas) > 0 {
+		for root, delta := range s.stagedBalanceDeltas {
+			node, ok := s.nodeByRoot[root]
+			if !ok || node == nil || delta == 0 {
+				continue
+			}
+			if delta > 0 {
+				node.balance += uint64(delta)
+			} else if decrease := uint64(-delta); node.balance < decrease {
+				log.WithFields(logrus.Fields{
+					"nodeRoot":    fmt.Sprintf("%#x", bytesutil.Trunc(root[:])),
+					"delta":       delta,
+					"nodeBalance": node.balance,
+				}).Warning("staged balance change exceeds node balance, setting it to zero")
+				node.balance = 0
+			} else {
+				node.balance -= decrease
+			}
+			s.mutationVersion++
+		}
+		s.stagedBalanceDeltas = make(map[[fieldparams.RootLength]byte]int64)
+	}
+	if s.treeRootNode == nil {
+		return nil
+	}
+	if err := s.treeRootNode.applyWeightChanges(ctx); err != nil {
+		return errors.Wrap(err, "could not apply weight changes")
+	}
+	currentEpoch := slots.EpochsSinceGenesis(time.Unix(int64(s.genesisTime), 0))
+	if err := s.treeRootNode.updateBestDescendant(ctx, s.justifiedCheckpoint.Epoch, s.finalizedCheckpoint.Epoch, currentEpoch); err != nil {
+		return errors.Wrap(err, "could not update best descendant")
+	}
+	return nil
+}
+
+// reconcilePayloadIndex rebuilds the `nodeByPayload` map from `nodeByRoot`. Payload hashes that
+// point to nodes no longer in the Store are dropped and nodes missing from the index are added
+// back. Entries that still point to a node in the Store are kept as they are. It returns the
+// number of dropped entries.
+func (s *Store) reconcilePayloadIndex() int {
+	dropped := 0
+	for hash, node := range s.nodeByPayload {
+		if node == nil || node.payloadHash != hash || s.nodeByRoot[node.root] != node {
+			delete(s.nodeByPayload, hash)
+			dropped++
+		}
+	}
+	for _, node := range s.nodeByRoot {
+		if _, ok := s.nodeByPayload[node.payloadHash]; !ok {
+			s.nodeByPayload[node.payloadHash] = node
+		}
+	}
+	return dropped
+}
+
+// removeFromSlotIndex removes the given node from the `nodesBySlot` map.
+func (s *Store) removeFromSlotIndex(node *Node) {
+	nodes := s.nodesBySlot[node.slot]
+	for i, n := range nodes {
+		if n == node {
+			nodes = append(nodes[:i], nodes[i+1:]...)
+			break
+		}
+	}
+	if len(nodes) == 0 {
+		delete(s.nodesBySlot, node.slot)
+		return
+	}
+	s.nodesBySlot[node.slot] = nodes
+}
+
 // pruneFinalizedNodeByRootMap prunes the `nodeByRoot` map
 // starting from `node` down to the finalized Node or to a leaf of the Fork
 // choice store.
@@ -156,6 +294,8 @@ func (s *Store) pruneFinalizedNodeByRootMap(ctx context.Context, node, finalized
 	node.children = nil
 	delete(s.nodeByRoot, node.root)
 	delete(s.nodeByPayload, node.payloadHash)
+	s.removeFromSlotIndex(node)
+	s.mutationVersion++
 	return nil
 }
 
@@ -205,13 +345,13 @@ func (s *Store) prune(ctx context.Context) error {
 }
 
 // tips returns a list of possible heads from fork choice store, it returns the
-// roots and the slots of the leaf nodes.
+// roots and the slots of the leaf nodes, leaving out the zero hash root.
 func (s *Store) tips() ([][32]byte, []primitives.Slot) {
 	var roots [][32]byte
 	var slots []primitives.Slot
 
 	for root, node := range s.nodeByRoot {
-		if len(node.children) == 0 {
+		if len(node.children) == 0 && !node.isVirtualRoot() {
 			roots = append(roots, root)
 			slots = append(slots, node.slot)
 		}
@@ -219,6 +359,35 @@ func (s *Store) tips() ([][32]byte, []primitives.Slot) {
 	return roots, slots
 }
 
+// treeStats returns the number of nodes in the longest path from the tree root to a leaf and
+// the highest number of nodes at any single slot.
+func (s *Store) treeStats() (depth, width int) {
+	for _, nodes := range s.nodesBySlot {
+		if len(nodes) > width {
+			width = len(nodes)
+		}
+	}
+	if s.treeRootNode == nil {
+		return 0, width
+	}
+	type entry struct {
+		node  *Node
+		depth int
+	}
+	stack := []entry{{node: s.treeRootNode, depth: 1}}
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if e.depth > depth {
+			depth = e.depth
+		}
+		for _, child := range e.node.children {
+			stack = append(stack, entry{node: child, depth: e.depth + 1})
+		}
+	}
+	return depth, width
+}
+
 // HighestReceivedBlockSlot returns the highest slot received by the forkchoice
 func (f *ForkChoice) HighestReceivedBlockSlot() primitives.Slot {
 	if f.store.highestReceivedNode == nil {
@@ -6,10 +6,13 @@ import (
 	"time"
 
 	forkchoicetypes "github.com/prysmaticlabs/prysm/v4/beacon-chain/forkchoice/types"
+	"github.com/prysmaticlabs/prysm/v4/config/features"
 	"github.com/prysmaticlabs/prysm/v4/config/params"
 	"github.com/prysmaticlabs/prysm/v4/consensus-types/primitives"
 	"github.com/prysmaticlabs/prysm/v4/testing/assert"
 	"github.com/prysmaticlabs/prysm/v4/testing/require"
+	"github.com/prysmaticlabs/prysm/v4/time/slots"
+	logTest "github.com/sirupsen/logrus/hooks/test"
 )
 
 func TestStore_JustifiedEpoch(t *testing.T) {
@@ -91,6 +94,9 @@ func TestStore_Head_Itself(t *testing.T) {
 }
 
 func TestStore_Head_BestDescendant(t *testing.T) {
+	// Equal weight branches are broken by root only.
+	resetCfg := features.InitWithReset(&features.Flags{DisableForkchoiceSlotTieBreak: true})
+	defer resetCfg()
 	f := setup(0, 0)
 	ctx := context.Background()
 	state, blkRoot, err := prepareForkchoiceState(context.Background(), 1, indexToHash(1), params.BeaconConfig().ZeroHash, params.BeaconConfig().ZeroHash, 0, 0)
@@ -131,7 +137,8 @@ func TestStore_Insert(t *testing.T) {
 	nodeByPayload := map[[32]byte]*Node{indexToHash(0): treeRootNode}
 	jc := &forkchoicetypes.Checkpoint{Epoch: 0}
 	fc := &forkchoicetypes.Checkpoint{Epoch: 0}
-	s := &Store{nodeByRoot: nodeByRoot, treeRootNode: treeRootNode, nodeByPayload: nodeByPayload, justifiedCheckpoint: jc, finalizedCheckpoint: fc, highestReceivedNode: &Node{}}
+	nodesBySlot := map[primitives.Slot][]*Node{0: {treeRootNode}}
+	s := &Store{nodeByRoot: nodeByRoot, treeRootNode: treeRootNode, nodeByPayload: nodeByPayload, nodesBySlot: nodesBySlot, justifiedCheckpoint: jc, finalizedCheckpoint: fc, highestReceivedNode: &Node{}}
 	payloadHash := [32]byte{'a'}
 	_, err := s.insert(context.Background(), 100, indexToHash(100), indexToHash(0), payloadHash, 1, 1)
 	require.NoError(t, err)
@@ -435,3 +442,320 @@ func TestForkChoice_ReceivedBlocksLastEpoch(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, uint64(0), count)
 }
+
+func TestStore_LastReorgDepth(t *testing.T) {
+	ctx := context.Background()
+	f := setup(0, 0)
+	f.justifiedBalances = []uint64{10, 10, 10}
+	f.numActiveValidators = 3
+	zeroHash := params.BeaconConfig().ZeroHash
+
+	// Insert the following fork:
+	//         0
+	//        / \
+	//       1   3
+	//       |
+	//       2
+	for _, blk := range []struct {
+		slot   primitives.Slot
+		root   [32]byte
+		parent [32]byte
+	}{
+		{1, indexToHash(1), zeroHash},
+		{2, indexToHash(2), indexToHash(1)},
+		{3, indexToHash(3), zeroHash},
+	} {
+		state, blkRoot, err := prepareForkchoiceState(ctx, blk.slot, blk.root, blk.parent, zeroHash, 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	}
+	f.store.proposerBoostRoot = [32]byte{}
+	f.ProcessAttestation(ctx, []uint64{0}, indexToHash(2), 0)
+	headRoot, err := f.Head(ctx)
+	require.NoError(t, err)
+	require.Equal(t, indexToHash(2), headRoot)
+
+	// Moving the votes to 3 reorgs out blocks 1 and 2.
+	f.ProcessAttestation(ctx, []uint64{1, 2}, indexToHash(3), 1)
+	headRoot, err = f.Head(ctx)
+	require.NoError(t, err)
+	require.Equal(t, indexToHash(3), headRoot)
+	require.Equal(t, primitives.Slot(2), f.LastReorgDepth())
+
+	// Extending the head is not a reorg.
+	state, blkRoot, err := prepareForkchoiceState(ctx, 4, indexToHash(4), indexToHash(3), zeroHash, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	f.store.proposerBoostRoot = [32]byte{}
+	headRoot, err = f.Head(ctx)
+	require.NoError(t, err)
+	require.Equal(t, indexToHash(4), headRoot)
+	require.Equal(t, primitives.Slot(0), f.LastReorgDepth())
+}
+
+// setupBinaryTree inserts count nodes where node i is the child of node i/2,
+// giving each node a balance and computing weights and best descendants.
+func setupBinaryTree(tb testing.TB, count uint64) *ForkChoice {
+	ctx := context.Background()
+	f := setup(1, 1)
+	for i := uint64(1); i <= count; i++ {
+		parent := params.BeaconConfig().ZeroHash
+		if i > 1 {
+			parent = indexToHash(i / 2)
+		}
+		state, blkRoot, err := prepareForkchoiceState(ctx, primitives.Slot(i), indexToHash(i), parent, indexToHash(i), 1, 1)
+		require.NoError(tb, err)
+		require.NoError(tb, f.InsertNode(ctx, state, blkRoot))
+		f.store.nodeByRoot[indexToHash(i)].balance = (i * 7) % 11
+	}
+	require.NoError(tb, f.store.treeRootNode.applyWeightChanges(ctx))
+	require.NoError(tb, f.store.treeRootNode.updateBestDescendant(ctx, 1, 1, slots.ToEpoch(slots.CurrentSlot(f.store.genesisTime))))
+	return f
+}
+
+func TestStore_RecomputeBestDescendantFrom(t *testing.T) {
+	ctx := context.Background()
+	f := setupBinaryTree(t, 31)
+	currentEpoch := slots.ToEpoch(slots.CurrentSlot(f.store.genesisTime))
+	virtualRoot := f.store.treeRootNode
+	require.Equal(t, true, virtualRoot.isVirtualRoot())
+	realRoot := f.store.nodeByRoot[indexToHash(1)]
+	requireMatchesFullUpdate := func() {
+		weights := make(map[[32]byte]uint64)
+		best := make(map[[32]byte]*Node)
+		for root, n := range f.store.nodeByRoot {
+			weights[root] = n.weight
+			best[root] = n.bestDescendant
+		}
+		require.NoError(t, f.store.treeRootNode.applyWeightChanges(ctx))
+		require.NoError(t, f.store.treeRootNode.updateBestDescendant(ctx, 1, 1, currentEpoch))
+		for root, n := range f.store.nodeByRoot {
+			if n.isVirtualRoot() {
+				continue
+			}
+			require.Equal(t, n.weight, weights[root])
+			require.Equal(t, n.bestDescendant, best[root])
+		}
+	}
+	requireVirtualRootUntouched := func(recompute func()) {
+		weight, best := virtualRoot.weight, virtualRoot.bestDescendant
+		recompute()
+		require.Equal(t, weight, virtualRoot.weight)
+		require.Equal(t, best, virtualRoot.bestDescendant)
+	}
+
+	// Make a leaf of a light branch the heaviest one.
+	leaf := f.store.nodeByRoot[indexToHash(16)]
+	require.NotEqual(t, leaf, realRoot.bestDescendant)
+	leaf.balance = 1000
+	requireVirtualRootUntouched(func() { f.store.recomputeBestDescendantFrom(leaf) })
+	require.Equal(t, leaf, realRoot.bestDescendant)
+	requireMatchesFullUpdate()
+
+	// The heaviest leaf is no longer viable for head.
+	leaf.justifiedEpoch = 0
+	requireVirtualRootUntouched(func() { f.store.recomputeBestDescendantFrom(leaf) })
+	require.NotEqual(t, leaf, realRoot.bestDescendant)
+	requireMatchesFullUpdate()
+
+	// An intermediate node loses its balance.
+	f.store.nodeByRoot[indexToHash(3)].balance = 0
+	requireVirtualRootUntouched(func() { f.store.recomputeBestDescendantFrom(f.store.nodeByRoot[indexToHash(3)]) })
+	requireMatchesFullUpdate()
+}
+
+func BenchmarkStore_RecomputeBestDescendant(b *testing.B) {
+	ctx := context.Background()
+	f := setupBinaryTree(b, 1023)
+	leaf := f.store.nodeByRoot[indexToHash(1000)]
+	currentEpoch := slots.ToEpoch(slots.CurrentSlot(f.store.genesisTime))
+
+	b.Run("full", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			leaf.balance = uint64(i)
+			if err := f.store.treeRootNode.applyWeightChanges(ctx); err != nil {
+				b.Fatal(err)
+			}
+			if err := f.store.treeRootNode.updateBestDescendant(ctx, 1, 1, currentEpoch); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("path", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			leaf.balance = uint64(i)
+			f.store.recomputeBestDescendantFrom(leaf)
+		}
+	})
+}
+
+func TestStore_CommitBalanceDeltas(t *testing.T) {
+	ctx := context.Background()
+	staged := setupBinaryTree(t, 63)
+	direct := setupBinaryTree(t, 63)
+
+	// Each delta is applied directly followed by a weight update on one tree,
+	// and staged then committed at once on the other.
+	for i := uint64(1); i <= 200; i++ {
+		root := indexToHash(i%63 + 1)
+		delta := int64(i * 3)
+		if i%4 == 0 {
+			// Only remove what a previous delta added so that balances never go negative.
+			delta = -int64((i - 1) * 3)
+			root = indexToHash((i-1)%63 + 1)
+		}
+		staged.store.stageBalanceDelta(root, delta)
+		n := direct.store.nodeByRoot[root]
+		if delta > 0 {
+			n.balance += uint64(delta)
+		} else {
+			n.balance -= uint64(-delta)
+		}
+		require.NoError(t, direct.store.treeRootNode.applyWeightChanges(ctx))
+	}
+	// Unknown roots are ignored.
+	staged.store.stageBalanceDelta(indexToHash(1000), 10)
+
+	version := staged.MutationVersion()
+	require.NoError(t, staged.store.commitBalanceDeltas(ctx))
+	require.Equal(t, true, staged.MutationVersion() > version)
+	require.Equal(t, 0, len(staged.store.stagedBalanceDeltas))
+	for root, n := range direct.store.nodeByRoot {
+		require.Equal(t, n.balance, staged.store.nodeByRoot[root].balance)
+		require.Equal(t, n.weight, staged.store.nodeByRoot[root].weight)
+	}
+
+	// Committing with nothing staged is a no-op.
+	version = staged.MutationVersion()
+	require.NoError(t, staged.store.commitBalanceDeltas(ctx))
+	require.Equal(t, version, staged.MutationVersion())
+}
+
+func TestStore_CommitBalanceDeltas_NegativeBalance(t *testing.T) {
+	hook := logTest.NewGlobal()
+	ctx := context.Background()
+	f := setupBinaryTree(t, 3)
+	n := f.store.nodeByRoot[indexToHash(2)]
+	n.balance = 5
+	f.store.stageBalanceDelta(indexToHash(2), -3)
+	f.store.stageBalanceDelta(indexToHash(2), -4)
+	require.NoError(t, f.store.commitBalanceDeltas(ctx))
+	require.Equal(t, uint64(0), n.balance)
+	require.Equal(t, uint64(0), n.weight)
+	require.LogsContain(t, hook, "staged balance change exceeds node balance")
+}
+
+func TestStore_CommitBalanceDeltas_BestDescendant(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	//   0 <- a
+	//    \
+	//     -- b
+	state, blkRoot, err := prepareForkchoiceState(ctx, 1, [32]byte{'a'}, params.BeaconConfig().ZeroHash, [32]byte{'A'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 1, [32]byte{'b'}, params.BeaconConfig().ZeroHash, [32]byte{'B'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+
+	f.store.stageBalanceDelta([32]byte{'a'}, 10)
+	require.NoError(t, f.store.commitBalanceDeltas(ctx))
+	require.Equal(t, [32]byte{'a'}, f.store.treeRootNode.bestDescendant.root)
+
+	f.store.stageBalanceDelta([32]byte{'a'}, -10)
+	f.store.stageBalanceDelta([32]byte{'b'}, 5)
+	require.NoError(t, f.store.commitBalanceDeltas(ctx))
+	require.Equal(t, [32]byte{'b'}, f.store.treeRootNode.bestDescendant.root)
+	head, err := f.store.head(ctx)
+	require.NoError(t, err)
+	require.Equal(t, [32]byte{'b'}, head)
+}
+
+func BenchmarkStore_CommitBalanceDeltas(b *testing.B) {
+	ctx := context.Background()
+	f := setupBinaryTree(b, 1023)
+
+	b.Run("per attestation", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j := uint64(1); j <= 64; j++ {
+				f.store.nodeByRoot[indexToHash(j*15)].balance += 1
+				if err := f.store.treeRootNode.applyWeightChanges(ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("staged", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j := uint64(1); j <= 64; j++ {
+				f.store.stageBalanceDelta(indexToHash(j*15), 1)
+			}
+			if err := f.store.commitBalanceDeltas(ctx); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestStore_ReconcilePayloadIndex(t *testing.T) {
+	ctx := context.Background()
+	f := setup(0, 0)
+	state, blkRoot, err := prepareForkchoiceState(ctx, 1, indexToHash(1), params.BeaconConfig().ZeroHash, [32]byte{'A'}, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 2, indexToHash(2), indexToHash(1), [32]byte{'B'}, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	require.Equal(t, 0, f.ReconcilePayloadIndex())
+	require.Equal(t, 3, len(f.store.nodeByPayload))
+
+	// Inject a stale entry and drop an index entry of a live node.
+	f.store.nodeByPayload[[32]byte{'X'}] = &Node{root: indexToHash(3), payloadHash: [32]byte{'X'}}
+	delete(f.store.nodeByPayload, [32]byte{'B'})
+
+	require.Equal(t, 1, f.ReconcilePayloadIndex())
+	require.Equal(t, 3, len(f.store.nodeByPayload))
+	_, ok := f.store.nodeByPayload[[32]byte{'X'}]
+	require.Equal(t, false, ok)
+	require.Equal(t, f.store.nodeByRoot[indexToHash(2)], f.store.nodeByPayload[[32]byte{'B'}])
+}
+
+func TestStore_NodesAtSlot(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	// Chain: 0 <- a <- b
+	//              \
+	//               -- c <- d
+	// b and c are at the same slot
+	state, blkRoot, err := prepareForkchoiceState(ctx, 100, [32]byte{'a'}, params.BeaconConfig().ZeroHash, [32]byte{'A'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 101, [32]byte{'b'}, [32]byte{'a'}, [32]byte{'B'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 101, [32]byte{'c'}, [32]byte{'a'}, [32]byte{'C'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+	state, blkRoot, err = prepareForkchoiceState(ctx, 102, [32]byte{'d'}, [32]byte{'c'}, [32]byte{'D'}, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, state, blkRoot))
+
+	require.DeepEqual(t, [][32]byte{{'b'}, {'c'}}, f.NodesAtSlot(101))
+	require.DeepEqual(t, [][32]byte{{'d'}}, f.NodesAtSlot(102))
+	require.Equal(t, 0, len(f.NodesAtSlot(103)))
+
+	// Removing c also removes its descendant d.
+	_, err = f.SetOptimisticToInvalid(ctx, [32]byte{'c'}, [32]byte{'a'}, [32]byte{'A'})
+	require.NoError(t, err)
+	require.DeepEqual(t, [][32]byte{{'b'}}, f.NodesAtSlot(101))
+	require.Equal(t, 0, len(f.NodesAtSlot(102)))
+	_, ok := f.store.nodesBySlot[102]
+	require.Equal(t, false, ok)
+
+	// Pruning removes the nodes before the finalized one.
+	f.store.finalizedCheckpoint.Root = [32]byte{'b'}
+	require.NoError(t, f.store.prune(ctx))
+	require.Equal(t, 0, len(f.NodesAtSlot(100)))
+	require.DeepEqual(t, [][32]byte{{'b'}}, f.NodesAtSlot(101))
+	require.Equal(t, 1, len(f.store.nodesBySlot))
+}
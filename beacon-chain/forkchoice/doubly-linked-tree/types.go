@@ -35,12 +35,20 @@ type Store struct {
 	headNode                      *Node                                  // last head Node
 	nodeByRoot                    map[[fieldparams.RootLength]byte]*Node // nodes indexed by roots.
 	nodeByPayload                 map[[fieldparams.RootLength]byte]*Node // nodes indexed by payload Hash
+	nodesBySlot                   map[primitives.Slot][]*Node            // nodes indexed by slot
 	slashedIndices                map[primitives.ValidatorIndex]bool     // the list of equivocating validator indices
 	originRoot                    [fieldparams.RootLength]byte           // The genesis block root
 	genesisTime                   uint64
 	highestReceivedNode           *Node                                      // The highest slot node.
 	receivedBlocksLastEpoch       [fieldparams.SlotsPerEpoch]primitives.Slot // Using `highestReceivedSlot`. The slot of blocks received in the last epoch.
 	allTipsAreInvalid             bool                                       // tracks if all tips are not viable for head
+	mutationVersion               uint64                                     // monotonic counter incremented whenever nodes or their balances change
+	lastReorgDepth                primitives.Slot                            // slots between the previous head and its common ancestor with the current head
+	stagedBalanceDeltas           map[[fieldparams.RootLength]byte]int64     // balance changes staged to be applied in a single weight update
+	lastInvalidatedRoots          [][32]byte                                 // roots removed by the most recent invalidation
+	headSubscriptions             *headSubscriptions                         // channels notified when the head changes
+	reorgHistory                  *historyRing[primitives.Slot]              // depths of the most recent reorgs
+	invalidationHistory           *historyRing[[][32]byte]                   // roots removed by the most recent invalidations
 }
 
 // Node defines the individual block which includes its block parent, ancestor and how much weight accounted for it.
@@ -57,9 +65,11 @@ type Node struct {
 	unrealizedFinalizedEpoch primitives.Epoch             // the epoch that would be finalized if the block would be advanced to the next epoch.
 	balance                  uint64                       // the balance that voted for this node directly
 	weight                   uint64                       // weight of this node: the total balance including children
+	attestationCount         uint64                       // the number of validators whose latest vote is counted in balance
 	bestDescendant           *Node                        // bestDescendant node of this node.
 	optimistic               bool                         // whether the block has been fully validated or not
 	timestamp                uint64                       // The timestamp when the node was inserted.
+	firstSeenSecsIntoSlot    uint64                       // seconds into the node's slot at which it was inserted.
 }
 
 // Vote defines an individual validator's vote.
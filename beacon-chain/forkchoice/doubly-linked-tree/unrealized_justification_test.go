@@ -337,3 +337,45 @@ func TestStore_PullTips_Heuristics(t *testing.T) {
 		require.Equal(tt, primitives.Epoch(2), f.store.nodeByRoot[[32]byte{'h'}].unrealizedJustifiedEpoch)
 	})
 }
+
+func TestForkChoice_UnrealizedCheckpoints(t *testing.T) {
+	ctx := context.Background()
+	f := setup(1, 1)
+	uj, uf := f.UnrealizedCheckpoints()
+	require.DeepEqual(t, f.store.unrealizedJustifiedCheckpoint, uj)
+	require.DeepEqual(t, f.store.unrealizedFinalizedCheckpoint, uf)
+
+	st, root, err := prepareForkchoiceState(ctx, 128, [32]byte{'p'}, [32]byte{}, [32]byte{}, 2, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, root))
+	driftGenesisTime(f, 129, 0)
+	st, root, err = prepareForkchoiceState(ctx, 129, [32]byte{'h'}, [32]byte{'p'}, [32]byte{}, 2, 1)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, root))
+
+	// pullTips advanced the unrealized justification of the store.
+	uj, uf = f.UnrealizedCheckpoints()
+	require.Equal(t, primitives.Epoch(2), uj.Epoch)
+	require.Equal(t, primitives.Epoch(1), uf.Epoch)
+	require.Equal(t, f.store.unrealizedJustifiedCheckpoint.Root, uj.Root)
+
+	// The returned checkpoints are copies.
+	uj.Epoch = 10
+	uf.Epoch = 10
+	require.Equal(t, primitives.Epoch(2), f.store.unrealizedJustifiedCheckpoint.Epoch)
+	require.Equal(t, primitives.Epoch(1), f.store.unrealizedFinalizedCheckpoint.Epoch)
+}
+
+func TestForkChoice_UpdateUnrealizedCheckpoints_FirstEpochTransition(t *testing.T) {
+	ctx := context.Background()
+	f := setup(0, 0)
+	st, root, err := prepareForkchoiceState(ctx, 1, [32]byte{'a'}, params.BeaconConfig().ZeroHash, [32]byte{'A'}, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.InsertNode(ctx, st, root))
+
+	// The justified epoch does not increase at the first epoch transition.
+	require.NoError(t, f.NewSlot(ctx, params.BeaconConfig().SlotsPerEpoch))
+	require.Equal(t, primitives.Epoch(0), f.JustifiedCheckpoint().Epoch)
+	require.Equal(t, primitives.Epoch(0), f.FinalizedCheckpoint().Epoch)
+	require.Equal(t, primitives.Epoch(0), f.store.nodeByRoot[[32]byte{'a'}].justifiedEpoch)
+}
@@ -69,6 +69,7 @@ type Getter interface {
 	ShouldOverrideFCU() bool
 	Slot([32]byte) (primitives.Slot, error)
 	LastRoot(primitives.Epoch) [32]byte
+	TreeStats() (depth, width int)
 }
 
 // Setter allows to set forkchoice information
@@ -430,6 +430,7 @@ func prepareForkChoiceResponse(response interface{}) (apimiddleware.RunDefault,
 				Balance:                  n.Balance,
 				ExecutionOptimistic:      n.ExecutionOptimistic,
 				TimeStamp:                n.TimeStamp,
+				FirstSeenSecsIntoSlot:    n.FirstSeenSecsIntoSlot,
 			},
 		}
 	}
@@ -724,6 +724,7 @@ func TestPrepareForkChoiceResponse(t *testing.T) {
 				ExecutionBlockHash:       "node1_execution_block_hash",
 				TimeStamp:                "node1_time_stamp",
 				Validity:                 "node1_validity",
+				FirstSeenSecsIntoSlot:    "node1_first_seen_secs_into_slot",
 			},
 			{
 				Slot:                     "node2_slot",
@@ -776,6 +777,7 @@ func TestPrepareForkChoiceResponse(t *testing.T) {
 	assert.Equal(t, false, node1.ExtraData.ExecutionOptimistic)
 	assert.Equal(t, "node1_execution_block_hash", node1.ExecutionBlockHash)
 	assert.Equal(t, "node1_time_stamp", node1.ExtraData.TimeStamp)
+	assert.Equal(t, "node1_first_seen_secs_into_slot", node1.ExtraData.FirstSeenSecsIntoSlot)
 	assert.Equal(t, "node1_validity", node1.Validity)
 	node2 := result.ForkChoiceNodes[1]
 	require.NotNil(t, node2)
@@ -102,6 +102,7 @@ type ForkChoiceNodeExtraDataJson struct {
 	Balance                  string `json:"balance"`
 	ExecutionOptimistic      bool   `json:"execution_optimistic"`
 	TimeStamp                string `json:"timestamp"`
+	FirstSeenSecsIntoSlot    string `json:"first_seen_secs_into_slot"`
 }
 
 type ForkChoiceResponseJson struct {
@@ -705,6 +706,7 @@ type ForkChoiceNodeJson struct {
 	ExecutionBlockHash       string `json:"execution_block_hash" hex:"true"`
 	TimeStamp                string `json:"timestamp"`
 	Validity                 string `json:"validity" enum:"true"`
+	FirstSeenSecsIntoSlot    string `json:"first_seen_secs_into_slot"`
 }
 
 type ForkChoiceDumpJson struct {
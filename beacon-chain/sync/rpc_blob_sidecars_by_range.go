@@ -119,13 +119,18 @@ func BlobsByRangeMinStartSlot(current primitives.Slot) (primitives.Slot, error)
 	if params.BeaconConfig().DenebForkEpoch == math.MaxUint64 {
 		return primitives.Slot(math.MaxUint64), nil
 	}
-	minReqEpochs := params.BeaconNetworkConfig().MinEpochsForBlobsSidecarsRequest
-	currEpoch := slots.ToEpoch(current)
-	minStart := params.BeaconConfig().DenebForkEpoch
-	if currEpoch > minReqEpochs && currEpoch-minReqEpochs > minStart {
-		minStart = currEpoch - minReqEpochs
+	denebStart, err := slots.EpochStart(params.BeaconConfig().DenebForkEpoch)
+	if err != nil {
+		return 0, err
+	}
+	currStart, err := slots.EpochStart(slots.ToEpoch(current))
+	if err != nil {
+		return 0, err
+	}
+	if minStart := params.BlobRetentionBoundarySlot(currStart); minStart > denebStart {
+		return minStart, nil
 	}
-	return slots.EpochStart(minStart)
+	return denebStart, nil
 }
 
 func blobBatchLimit() uint64 {
@@ -155,6 +155,54 @@ func TestBlobByRangeOK(t *testing.T) {
 	}
 }
 
+func TestBlobsByRangeMinStartSlot(t *testing.T) {
+	cfg := params.BeaconConfig()
+	repositionFutureEpochs(cfg)
+	undo, err := params.SetActiveWithUndo(cfg)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, undo())
+	}()
+	denebSlot, err := slots.EpochStart(params.BeaconConfig().DenebForkEpoch)
+	require.NoError(t, err)
+	minReqSlots, err := slots.EpochStart(params.BeaconNetworkConfig().MinEpochsForBlobsSidecarsRequest)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name    string
+		current types.Slot
+		want    types.Slot
+	}{
+		{
+			name:    "before deneb",
+			current: 1,
+			want:    denebSlot,
+		},
+		{
+			name:    "retention window reaches deneb",
+			current: denebSlot + minReqSlots,
+			want:    denebSlot,
+		},
+		{
+			name:    "retention window past deneb",
+			current: denebSlot + minReqSlots + 2*params.BeaconConfig().SlotsPerEpoch,
+			want:    denebSlot + 2*params.BeaconConfig().SlotsPerEpoch,
+		},
+		{
+			name:    "aligned to the start of the epoch",
+			current: denebSlot + minReqSlots + 2*params.BeaconConfig().SlotsPerEpoch + 3,
+			want:    denebSlot + 2*params.BeaconConfig().SlotsPerEpoch,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := BlobsByRangeMinStartSlot(c.current)
+			require.NoError(t, err)
+			require.Equal(t, c.want, got)
+		})
+	}
+}
+
 func TestBlobsByRangeValidation(t *testing.T) {
 	cfg := params.BeaconConfig()
 	repositionFutureEpochs(cfg)
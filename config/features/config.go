@@ -72,6 +72,8 @@ type Flags struct {
 
 	AggregateParallel bool // AggregateParallel aggregates attestations in parallel.
 
+	DisableForkchoiceSlotTieBreak bool // DisableForkchoiceSlotTieBreak breaks forkchoice ties between equal weight children by root only, not by head slot first.
+
 	// KeystoreImportDebounceInterval specifies the time duration the validator waits to reload new keys if they have
 	// changed on disk. This feature is for advanced use cases only.
 	KeystoreImportDebounceInterval time.Duration
@@ -247,6 +249,10 @@ func ConfigureBeaconChain(ctx *cli.Context) error {
 		logEnabled(disableAggregateParallel)
 		cfg.AggregateParallel = false
 	}
+	if ctx.IsSet(disableForkchoiceSlotTieBreak.Name) {
+		logDisabled(disableForkchoiceSlotTieBreak)
+		cfg.DisableForkchoiceSlotTieBreak = true
+	}
 	if ctx.IsSet(disableResourceManager.Name) {
 		logEnabled(disableResourceManager)
 		cfg.DisableResourceManager = true
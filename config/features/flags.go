@@ -163,6 +163,10 @@ var (
 		Name:  "disable-aggregate-parallel",
 		Usage: "Disables parallel aggregation of attestations",
 	}
+	disableForkchoiceSlotTieBreak = &cli.BoolFlag{
+		Name:  "disable-forkchoice-slot-tiebreak",
+		Usage: "Breaks ties between equal weight branches in forkchoice by root only, instead of preferring the branch with the lower head slot first",
+	}
 )
 
 // devModeFlags holds list of flags that are set when development mode is on.
@@ -220,6 +224,7 @@ var BeaconChainFlags = append(deprecatedBeaconFlags, append(deprecatedFlags, []c
 	disableResourceManager,
 	DisableRegistrationCache,
 	disableAggregateParallel,
+	disableForkchoiceSlotTieBreak,
 }...)...)
 
 // E2EBeaconChainFlags contains a list of the beacon chain feature flags to be tested in E2E.
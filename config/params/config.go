@@ -295,3 +295,13 @@ func DenebEnabled() bool {
 func WithinDAPeriod(block, current primitives.Epoch) bool {
 	return block+BeaconNetworkConfig().MinEpochsForBlobsSidecarsRequest >= current
 }
+
+// BlobRetentionBoundarySlot returns the lowest slot for which blobs need to be retained at the given current slot,
+// that is current_slot - MIN_EPOCHS_FOR_BLOB_SIDECARS_REQUESTS * SLOTS_PER_EPOCH, clamped at 0.
+func BlobRetentionBoundarySlot(current primitives.Slot) primitives.Slot {
+	retention := primitives.Slot(uint64(BeaconNetworkConfig().MinEpochsForBlobsSidecarsRequest) * uint64(BeaconConfig().SlotsPerEpoch))
+	if current < retention {
+		return 0
+	}
+	return current - retention
+}
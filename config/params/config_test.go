@@ -92,3 +92,38 @@ func TestConfig_WithinDAPeriod(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_BlobRetentionBoundarySlot(t *testing.T) {
+	retention := primitives.Slot(uint64(params.BeaconNetworkConfig().MinEpochsForBlobsSidecarsRequest) * uint64(params.BeaconConfig().SlotsPerEpoch))
+	cases := []struct {
+		name     string
+		current  primitives.Slot
+		boundary primitives.Slot
+	}{
+		{
+			name:     "genesis",
+			current:  0,
+			boundary: 0,
+		},
+		{
+			name:     "early slot clamped",
+			current:  retention - 1,
+			boundary: 0,
+		},
+		{
+			name:     "exactly retention",
+			current:  retention,
+			boundary: 0,
+		},
+		{
+			name:     "steady state",
+			current:  retention + 100,
+			boundary: 100,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.boundary, params.BlobRetentionBoundarySlot(c.current))
+		})
+	}
+}